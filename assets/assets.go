@@ -1,24 +1,21 @@
 package assets
 
-import _ "embed"
+import "embed"
 
 //go:embed pathlist
 var PathList string
 
-//go:embed item_white.png
-var ItemWhite []byte
+//go:embed backgrounds/*.png
+var Backgrounds embed.FS
 
-//go:embed item_bronze.png
-var ItemBronze []byte
+//go:embed schemas.json
+var Schemas []byte
 
-//go:embed item_silver.png
-var ItemSilver []byte
+//go:embed keys.json
+var Keys []byte
 
-//go:embed item_gold.png
-var ItemGold []byte
+//go:embed profiles/*.json
+var Profiles embed.FS
 
-//go:embed item_rainbow.png
-var ItemRainbow []byte
-
-//go:embed item_rainbow_enhanced.png
-var ItemRainbowEnhanced []byte
+//go:embed relations.json
+var Relations []byte
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"log"
+	"path/filepath"
+
+	"github.com/blead/wfax/pkg/wf"
+	"github.com/spf13/cobra"
+)
+
+var animatePaths []string
+var animateFormats []string
+var animateScale float32
+var animateSmooth bool
+var animateFrameRate int
+var animateConcurrency int
+var animateArchives []string
+var animateManifest string
+
+var animateCmd = &cobra.Command{
+	Use:   "animate [src] [dest]",
+	Short: "Render pixel art sheets from src into animated GIF and APNG files at dest",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		config := wf.AnimatorConfig{
+			SrcPath:      filepath.Clean(args[0]),
+			Archives:     animateArchives,
+			DestPath:     filepath.Clean(args[1]),
+			Paths:        animatePaths,
+			ManifestPath: animateManifest,
+			Formats:      animateFormats,
+			Scale:        animateScale,
+			Smooth:       animateSmooth,
+			FrameRate:    animateFrameRate,
+			Concurrency:  animateConcurrency,
+		}
+
+		animator, err := wf.NewAnimator(&config)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		err = animator.Animate()
+		if err != nil {
+			log.Fatalln(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(animateCmd)
+	animateCmd.Flags().StringArrayVarP(&animatePaths, "path", "p", nil, "Internal path of pixel art sheet, e.g. character/alk/pixelart/pixelart, all character pixel art if not supplied (can be repeated)")
+	animateCmd.Flags().StringSliceVarP(&animateFormats, "format", "f", []string{wf.AnimationGIF, wf.AnimationAPNG}, "Output formats, gif and/or apng")
+	animateCmd.Flags().Float32VarP(&animateScale, "scale", "s", 4, "Frame size scaling (default 4.0)")
+	animateCmd.Flags().BoolVar(&animateSmooth, "smooth", false, "Scale frames with Lanczos filter instead of nearest-neighbor")
+	animateCmd.Flags().IntVarP(&animateFrameRate, "frame-rate", "r", 30, "Timeline ticks per second")
+	animateCmd.Flags().IntVarP(&animateConcurrency, "concurrency", "c", 5, "Maximum number of concurrent sheet processing")
+	animateCmd.Flags().StringArrayVarP(&animateArchives, "archive", "a", nil, "Read raw assets from downloaded zip archive layered on top of src, later archives take precedence (can be repeated)")
+	animateCmd.Flags().StringVarP(&animateManifest, "manifest", "m", "", "Write manifest of written animations with sha256 hashes and sizes to file")
+}
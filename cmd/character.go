@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"log"
+	"path/filepath"
+
+	"github.com/blead/wfax/pkg/wf"
+	"github.com/spf13/cobra"
+)
+
+var characterAll bool
+var characterIndent int
+var characterConcurrency int
+var characterArchives []string
+
+var characterCmd = &cobra.Command{
+	Use:   "character [src] [dest] [devname...]",
+	Short: "Gather assets and master table rows of characters from src into a directory per devname at dest",
+	Args:  cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		config := wf.CharacterConfig{
+			SrcPath:     filepath.Clean(args[0]),
+			Archives:    characterArchives,
+			DestPath:    filepath.Clean(args[1]),
+			Devnames:    args[2:],
+			All:         characterAll,
+			Indent:      characterIndent,
+			Concurrency: characterConcurrency,
+		}
+
+		bundler, err := wf.NewCharacterBundler(&config)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		err = bundler.BundleCharacters()
+		if err != nil {
+			log.Fatalln(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(characterCmd)
+	characterCmd.Flags().BoolVar(&characterAll, "all", false, "Bundle every character of the character table")
+	characterCmd.Flags().IntVarP(&characterIndent, "indent", "i", 0, "Indentation of JSON output")
+	characterCmd.Flags().IntVarP(&characterConcurrency, "concurrency", "c", 5, "Maximum number of concurrent file extraction")
+	characterCmd.Flags().StringArrayVarP(&characterArchives, "archive", "a", nil, "Read raw assets from downloaded zip archive layered on top of src, later archives take precedence (can be repeated)")
+}
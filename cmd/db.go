@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"log"
+	"path/filepath"
+
+	"github.com/blead/wfax/pkg/wf"
+	"github.com/spf13/cobra"
+)
+
+var dbPathList string
+var dbNoDefaultPaths bool
+var dbSchema string
+var dbVersion string
+var dbConcurrency int
+var dbArchives []string
+
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Manage SQLite databases of master tables",
+}
+
+var dbBuildCmd = &cobra.Command{
+	Use:   "build [src...] [dest]",
+	Short: "Write master tables from src into SQLite database at dest, updating only changed tables if dest exists, later src dumps override earlier ones",
+	Args:  cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		config := wf.DatabaseConfig{
+			SrcPath:        filepath.Clean(args[0]),
+			SrcPaths:       args[1 : len(args)-1],
+			Archives:       dbArchives,
+			DestPath:       filepath.Clean(args[len(args)-1]),
+			PathList:       dbPathList,
+			NoDefaultPaths: dbNoDefaultPaths,
+			SchemaPath:     dbSchema,
+			Version:        dbVersion,
+			Concurrency:    dbConcurrency,
+		}
+
+		builder, err := wf.NewDatabaseBuilder(&config)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		err = builder.BuildDatabase()
+		if err != nil {
+			log.Fatalln(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(dbCmd)
+	dbCmd.AddCommand(dbBuildCmd)
+	dbBuildCmd.Flags().StringVarP(&dbPathList, "path-list", "p", "", "Path to newline delimited file containing possible master table paths")
+	dbBuildCmd.Flags().BoolVarP(&dbNoDefaultPaths, "no-default-paths", "n", false, "Ignore default paths and only use supplied path list")
+	dbBuildCmd.Flags().StringVarP(&dbSchema, "schema", "s", "", "Path to JSON file containing table schemas used to name columns")
+	dbBuildCmd.Flags().StringVarP(&dbVersion, "version", "v", "", "Game version of src recorded in database metadata")
+	dbBuildCmd.Flags().IntVarP(&dbConcurrency, "concurrency", "c", 5, "Maximum number of concurrent table parsing")
+	dbBuildCmd.Flags().StringArrayVarP(&dbArchives, "archive", "a", nil, "Read raw assets from downloaded zip archive layered on top of src, later archives take precedence (can be repeated)")
+}
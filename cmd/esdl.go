@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"log"
+	"path/filepath"
+
+	"github.com/blead/wfax/pkg/wf"
+	"github.com/spf13/cobra"
+)
+
+var esdlReadableKeys bool
+var esdlKeys string
+var esdlIndent int
+
+var esdlCmd = &cobra.Command{
+	Use:   "esdl",
+	Short: "Inspect extracted enemy ESDL files",
+}
+
+var esdlGraphCmd = &cobra.Command{
+	Use:   "graph [src] [path] [dest...]",
+	Short: "Render forms, states, actions and watches of the enemy ESDL at path, extracted into src (a directory or an archive written by extract), as state machines at dest, as Graphviz DOT if dest ends with .dot or JSON otherwise",
+	Args:  cobra.MinimumNArgs(3),
+	Run: func(cmd *cobra.Command, args []string) {
+		var dest []string
+		for _, p := range args[2:] {
+			dest = append(dest, filepath.Clean(p))
+		}
+		config := wf.ESDLGraphConfig{
+			SrcPath:      filepath.Clean(args[0]),
+			Path:         args[1],
+			DestPaths:    dest,
+			ReadableKeys: esdlReadableKeys,
+			KeysPath:     esdlKeys,
+			Indent:       esdlIndent,
+		}
+
+		grapher, err := wf.NewESDLGrapher(&config)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		err = grapher.WriteGraph()
+		if err != nil {
+			log.Fatalln(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(esdlCmd)
+	esdlCmd.AddCommand(esdlGraphCmd)
+	esdlGraphCmd.Flags().BoolVarP(&esdlReadableKeys, "readable-keys", "r", false, "Read files extracted with readable keys")
+	esdlGraphCmd.Flags().StringVar(&esdlKeys, "keys", "", "Path to JSON file containing key dictionaries used when extracting with readable keys")
+	esdlGraphCmd.Flags().IntVarP(&esdlIndent, "indent", "i", 0, "Indentation of JSON output")
+}
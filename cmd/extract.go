@@ -1,7 +1,9 @@
 package cmd
 
 import (
+	"errors"
 	"log"
+	"os"
 	"path/filepath"
 
 	"github.com/blead/wfax/pkg/wf"
@@ -12,23 +14,64 @@ var extractPathList string
 var extractConcurrency int
 var extractIndent int
 var extractFlattenCSV bool
+var extractNamedColumns bool
+var extractTypedValues bool
+var extractSchema string
+var extractFormat string
+var extractReadableKeys bool
+var extractKeys string
+var extractNormalize bool
+var extractSortKeys bool
+var extractIncremental bool
+var extractState string
+var extractManifest string
+var extractGraph []string
+var extractInclude []string
+var extractExclude []string
+var extractTraverseExcluded bool
+var extractMaxDepth int
+var extractKeepGoing bool
+var extractReport string
+var extractArchives []string
 var extractNoDefaultPaths bool
+var extractProfile string
 var extractEliyabot bool
 
 var extractCmd = &cobra.Command{
-	Use:   "extract [src] [dest]",
-	Short: "Extract files from src into readable format at dest",
-	Args:  cobra.ExactArgs(2),
+	Use:   "extract [src...] [dest]",
+	Short: "Extract files from src into readable format at dest, later src dumps override earlier ones",
+	Args:  cobra.MinimumNArgs(2),
 	Run: func(cmd *cobra.Command, args []string) {
 		config := wf.ExtractorConfig{
-			SrcPath:        filepath.Clean(args[0]),
-			DestPath:       filepath.Clean(args[1]),
-			PathList:       filepath.Clean(extractPathList),
-			NoDefaultPaths: extractNoDefaultPaths,
-			Concurrency:    extractConcurrency,
-			Indent:         extractIndent,
-			FlattenCSV:     extractFlattenCSV,
-			Eliyabot:       extractEliyabot,
+			SrcPath:          filepath.Clean(args[0]),
+			SrcPaths:         args[1 : len(args)-1],
+			Archives:         extractArchives,
+			DestPath:         filepath.Clean(args[len(args)-1]),
+			PathList:         filepath.Clean(extractPathList),
+			NoDefaultPaths:   extractNoDefaultPaths,
+			Concurrency:      extractConcurrency,
+			Indent:           extractIndent,
+			FlattenCSV:       extractFlattenCSV,
+			NamedColumns:     extractNamedColumns,
+			TypedValues:      extractTypedValues,
+			SchemaPath:       extractSchema,
+			OutputFormat:     extractFormat,
+			ReadableKeys:     extractReadableKeys,
+			KeysPath:         extractKeys,
+			Normalize:        extractNormalize,
+			SortKeys:         extractSortKeys,
+			Incremental:      extractIncremental,
+			StatePath:        extractState,
+			ManifestPath:     extractManifest,
+			GraphPaths:       extractGraph,
+			Include:          extractInclude,
+			Exclude:          extractExclude,
+			TraverseExcluded: extractTraverseExcluded,
+			MaxDepth:         extractMaxDepth,
+			KeepGoing:        extractKeepGoing,
+			ReportPath:       extractReport,
+			Profile:          extractProfile,
+			Eliyabot:         extractEliyabot,
 		}
 
 		extractor, err := wf.NewExtractor(&config)
@@ -37,6 +80,10 @@ var extractCmd = &cobra.Command{
 		}
 
 		err = extractor.ExtractAssets()
+		if errors.Is(err, wf.ErrPartialFailure) {
+			log.Println("[WARN]", err)
+			os.Exit(exitCodePartialFailure)
+		}
 		if err != nil {
 			log.Fatalln(err)
 		}
@@ -45,10 +92,30 @@ var extractCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(extractCmd)
-	extractCmd.Flags().StringVarP(&extractPathList, "path-list", "p", "", "Path to newline delimited file containing possible asset paths (default \"[dest]/.pathlist\")")
+	extractCmd.Flags().StringVarP(&extractPathList, "path-list", "p", "", "Path to newline delimited file containing possible asset paths (default \"[dest]/.pathlist\", none if dest is an archive)")
 	extractCmd.Flags().IntVarP(&extractConcurrency, "concurrency", "c", 5, "Maximum number of concurrent file extractions")
 	extractCmd.Flags().IntVarP(&extractIndent, "indent", "i", 0, "Number of spaces used as indentation in extracted JSON (default 0)")
 	extractCmd.Flags().BoolVarP(&extractFlattenCSV, "flatten-csv", "f", false, "Ignore newlines in multi-line CSVs")
+	extractCmd.Flags().BoolVarP(&extractNamedColumns, "named-columns", "N", false, "Convert CSV rows of tables with schemas into objects with named fields")
+	extractCmd.Flags().BoolVarP(&extractTypedValues, "typed-values", "t", false, "Convert CSV cells into numbers, booleans and nulls by schema types or inferred column types")
+	extractCmd.Flags().StringVarP(&extractSchema, "schema", "s", "", "Path to JSON file containing table schemas overriding the default schemas")
+	extractCmd.Flags().StringVarP(&extractFormat, "format", "F", "json", "Output format of orderedmap tables: json, csv or tsv (nested map keys become leading columns in csv and tsv)")
+	extractCmd.Flags().BoolVarP(&extractReadableKeys, "readable-keys", "r", false, "Rename obfuscated keys of ESDL and action DSL files to readable names")
+	extractCmd.Flags().StringVar(&extractKeys, "keys", "", "Path to JSON file containing key dictionaries overriding the default dictionaries per file extension")
+	extractCmd.Flags().BoolVar(&extractNormalize, "normalize", false, "Rewrite extracted JSON of all parsers with canonical number formatting, indentation and a trailing newline")
+	extractCmd.Flags().BoolVar(&extractSortKeys, "sort-keys", false, "Sort keys of extracted JSON objects (implies --normalize), orderedmap tables are not sorted and keep their source key order to pack back into identical tables")
+	extractCmd.Flags().BoolVarP(&extractIncremental, "incremental", "I", false, "Only parse sources changed since the previous incremental extraction")
+	extractCmd.Flags().StringVar(&extractState, "state", "", "Path to extraction state file used by incremental extraction (default \"[dest]/.extractstate\")")
+	extractCmd.Flags().StringVarP(&extractManifest, "manifest", "m", "", "Write manifest of written outputs with asset paths, parsers, source files, sha256 hashes and sizes to file, outputs of the previous manifest not written again are listed as stale")
+	extractCmd.Flags().StringArrayVarP(&extractGraph, "graph", "g", nil, "Write path provenance graph to file, as Graphviz DOT if it ends with .dot or JSON otherwise (can be repeated)")
+	extractCmd.Flags().StringArrayVar(&extractInclude, "include", nil, "Only write paths matching glob pattern, or regular expression prefixed with re:, matched against asset paths and output paths such as orderedmap/item/equipment.json (can be repeated)")
+	extractCmd.Flags().StringArrayVar(&extractExclude, "exclude", nil, "Do not write paths matching glob pattern, or regular expression prefixed with re: (can be repeated)")
+	extractCmd.Flags().BoolVar(&extractTraverseExcluded, "traverse-excluded", false, "Parse paths filtered out by --include and --exclude to discover referenced paths without writing them")
+	extractCmd.Flags().IntVar(&extractMaxDepth, "max-depth", 0, "Maximum number of references followed from initial paths, 0 for unlimited and negative to follow none")
+	extractCmd.Flags().BoolVarP(&extractKeepGoing, "keep-going", "k", false, "Record files failing to extract into a report and continue, exiting with code 3 if any failed")
+	extractCmd.Flags().StringVar(&extractReport, "report", "", "Path to failure report written by --keep-going (default \"[dest]/.failures.json\")")
+	extractCmd.Flags().StringArrayVarP(&extractArchives, "archive", "a", nil, "Read raw assets from downloaded zip archive layered on top of src, later archives take precedence (can be repeated)")
 	extractCmd.Flags().BoolVarP(&extractNoDefaultPaths, "no-default-paths", "n", false, "Ignore default paths and only extract from supplied path list")
-	extractCmd.Flags().BoolVarP(&extractEliyabot, "eliyabot", "e", false, "Extract and resize image assets for eliyabot (requires a path list with internal names)")
+	extractCmd.Flags().StringVarP(&extractProfile, "profile", "P", "", "Export images described by an export profile file, or a built-in profile name such as eliyabot")
+	extractCmd.Flags().BoolVarP(&extractEliyabot, "eliyabot", "e", false, "Extract and resize character image assets for eliyabot (same as --profile eliyabot)")
 }
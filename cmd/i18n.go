@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"log"
+	"path/filepath"
+
+	"github.com/blead/wfax/pkg/wf"
+	"github.com/spf13/cobra"
+)
+
+var i18nRegions []string
+var i18nInclude []string
+var i18nFormat string
+var i18nIndent int
+var i18nReport string
+
+var i18nCmd = &cobra.Command{
+	Use:   "i18n",
+	Short: "Compare text of several regions",
+}
+
+var i18nMergeCmd = &cobra.Command{
+	Use:   "merge [src...] [dest]",
+	Short: "Merge master tables extracted from several regions in src into tables at dest with text columns keyed by region, matching rows by key path",
+	Args:  cobra.MinimumNArgs(3),
+	Run: func(cmd *cobra.Command, args []string) {
+		config := wf.I18nConfig{
+			SrcPaths:   args[:len(args)-1],
+			Regions:    i18nRegions,
+			DestPath:   filepath.Clean(args[len(args)-1]),
+			Include:    i18nInclude,
+			Format:     i18nFormat,
+			Indent:     i18nIndent,
+			ReportPath: i18nReport,
+		}
+
+		merger, err := wf.NewI18nMerger(&config)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		err = merger.MergeI18n()
+		if err != nil {
+			log.Fatalln(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(i18nCmd)
+	i18nCmd.AddCommand(i18nMergeCmd)
+	i18nMergeCmd.Flags().StringArrayVarP(&i18nRegions, "region", "r", nil, "Region name of each src in order, base names of src if not supplied (can be repeated)")
+	i18nMergeCmd.Flags().StringArrayVar(&i18nInclude, "include", nil, "Only merge tables matching glob pattern, or regular expression prefixed with re: (can be repeated)")
+	i18nMergeCmd.Flags().StringVarP(&i18nFormat, "format", "f", wf.FormatJSON, "Output format of merged tables, json or csv")
+	i18nMergeCmd.Flags().IntVarP(&i18nIndent, "indent", "i", 0, "Indentation of JSON output")
+	i18nMergeCmd.Flags().StringVar(&i18nReport, "report", "", "Path to report of tables and rows missing from some regions (default \"[dest]/.i18n-report.json\")")
+}
@@ -9,6 +9,10 @@ import (
 )
 
 var packConcurrency int
+var packSchema string
+var packReadableKeys bool
+var packKeys string
+var packManifest string
 
 var packCmd = &cobra.Command{
 	Use:   "pack [src] [dest]",
@@ -16,9 +20,13 @@ var packCmd = &cobra.Command{
 	Args:  cobra.ExactArgs(2),
 	Run: func(cmd *cobra.Command, args []string) {
 		config := wf.PackerConfig{
-			SrcPath:     filepath.Clean(args[0]),
-			DestPath:    filepath.Clean(args[1]),
-			Concurrency: packConcurrency,
+			SrcPath:      filepath.Clean(args[0]),
+			DestPath:     filepath.Clean(args[1]),
+			SchemaPath:   packSchema,
+			ReadableKeys: packReadableKeys,
+			KeysPath:     packKeys,
+			ManifestPath: packManifest,
+			Concurrency:  packConcurrency,
 		}
 
 		packer, err := wf.NewPacker(&config)
@@ -35,5 +43,9 @@ var packCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(packCmd)
+	packCmd.Flags().StringVarP(&packSchema, "schema", "s", "", "Path to JSON file containing table schemas used to pack named columns")
+	packCmd.Flags().BoolVarP(&packReadableKeys, "readable-keys", "r", false, "Restore obfuscated keys of ESDL and action DSL files extracted with readable keys")
+	packCmd.Flags().StringVar(&packKeys, "keys", "", "Path to JSON file containing key dictionaries used to restore readable keys of ESDL and action DSL files")
+	packCmd.Flags().StringVarP(&packManifest, "manifest", "m", "", "Write manifest of packed files with asset paths, parsers, source files, sha256 hashes and sizes to file")
 	packCmd.Flags().IntVarP(&packConcurrency, "concurrency", "c", 5, "Maximum number of concurrent file extractions")
 }
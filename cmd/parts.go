@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"log"
+	"path/filepath"
+
+	"github.com/blead/wfax/pkg/wf"
+	"github.com/spf13/cobra"
+)
+
+var partsPaths []string
+var partsScale float32
+var partsConcurrency int
+var partsArchives []string
+var partsManifest string
+
+var partsCmd = &cobra.Command{
+	Use:   "parts [src] [dest]",
+	Short: "Compose images described by .parts assets from src into PNGs per part set at dest",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		config := wf.PartsConfig{
+			SrcPath:      filepath.Clean(args[0]),
+			Archives:     partsArchives,
+			DestPath:     filepath.Clean(args[1]),
+			Paths:        partsPaths,
+			ManifestPath: partsManifest,
+			Scale:        partsScale,
+			Concurrency:  partsConcurrency,
+		}
+
+		renderer, err := wf.NewPartsRenderer(&config)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		err = renderer.RenderParts()
+		if err != nil {
+			log.Fatalln(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(partsCmd)
+	partsCmd.Flags().StringArrayVarP(&partsPaths, "path", "p", nil, "Internal path of .parts asset, all known paths with .parts files in src if not supplied (can be repeated)")
+	partsCmd.Flags().Float32VarP(&partsScale, "scale", "s", 1, "Image size scaling (default 1.0)")
+	partsCmd.Flags().IntVarP(&partsConcurrency, "concurrency", "c", 5, "Maximum number of concurrent parts processing")
+	partsCmd.Flags().StringArrayVarP(&partsArchives, "archive", "a", nil, "Read raw assets from downloaded zip archive layered on top of src, later archives take precedence (can be repeated)")
+	partsCmd.Flags().StringVarP(&partsManifest, "manifest", "m", "", "Write manifest of written images with sha256 hashes and sizes to file")
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"log"
+	"path/filepath"
+
+	"github.com/blead/wfax/pkg/wf"
+	"github.com/spf13/cobra"
+)
+
+var resolveRelations string
+var resolveSchema string
+var resolveNames []string
+var resolveIndent int
+var resolveArchives []string
+
+var resolveCmd = &cobra.Command{
+	Use:   "resolve [src] [dest]",
+	Short: "Join master tables in src by relation definitions into denormalized JSON documents at dest, one file per definition",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		config := wf.ResolveConfig{
+			SrcPath:       filepath.Clean(args[0]),
+			Archives:      resolveArchives,
+			DestPath:      filepath.Clean(args[1]),
+			RelationsPath: resolveRelations,
+			SchemaPath:    resolveSchema,
+			Names:         resolveNames,
+			Indent:        resolveIndent,
+		}
+
+		resolver, err := wf.NewResolver(&config)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		err = resolver.Resolve()
+		if err != nil {
+			log.Fatalln(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(resolveCmd)
+	resolveCmd.Flags().StringVarP(&resolveRelations, "relations", "r", "", "Path to JSON file containing relation definitions, overriding default definitions of the same name")
+	resolveCmd.Flags().StringVarP(&resolveSchema, "schema", "s", "", "Path to JSON file containing table schemas used to look up columns by name")
+	resolveCmd.Flags().StringArrayVar(&resolveNames, "only", nil, "Only resolve the relation definition of name (can be repeated)")
+	resolveCmd.Flags().IntVarP(&resolveIndent, "indent", "i", 0, "Indentation of JSON output")
+	resolveCmd.Flags().StringArrayVarP(&resolveArchives, "archive", "a", nil, "Read raw assets from downloaded zip archive layered on top of src, later archives take precedence (can be repeated)")
+}
@@ -6,6 +6,12 @@ import (
 	"github.com/spf13/cobra"
 )
 
+// exitCodePartialFailure is returned by commands which kept going after some files failed.
+const exitCodePartialFailure = 3
+
+// exitCodeSchemaChanged is returned by schema inference which found changes from the previous schemas.
+const exitCodeSchemaChanged = 4
+
 var rootCmd = &cobra.Command{
 	Use:   "wfax",
 	Short: "World Flipper Asset Extractor CLI",
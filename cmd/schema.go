@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/blead/wfax/pkg/wf"
+	"github.com/spf13/cobra"
+)
+
+var schemaPathList string
+var schemaNoDefaultPaths bool
+var schemaPrevious string
+var schemaReport string
+var schemaVersion string
+var schemaIndent int
+var schemaConcurrency int
+var schemaArchives []string
+
+var schemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Infer master table schemas and detect changes between versions",
+}
+
+var schemaInferCmd = &cobra.Command{
+	Use:   "infer [src...] [dest]",
+	Short: "Write column counts, types and value domains inferred from master tables in src into dest, later src dumps override earlier ones",
+	Args:  cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		config := wf.SchemaInferConfig{
+			SrcPath:        filepath.Clean(args[0]),
+			SrcPaths:       args[1 : len(args)-1],
+			Archives:       schemaArchives,
+			DestPath:       filepath.Clean(args[len(args)-1]),
+			PathList:       schemaPathList,
+			NoDefaultPaths: schemaNoDefaultPaths,
+			PreviousPath:   schemaPrevious,
+			ReportPath:     schemaReport,
+			Version:        schemaVersion,
+			Indent:         schemaIndent,
+			Concurrency:    schemaConcurrency,
+		}
+
+		inferrer, err := wf.NewSchemaInferrer(&config)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		err = inferrer.InferSchemas()
+		if errors.Is(err, wf.ErrSchemaChanged) {
+			log.Println("[WARN]", err)
+			os.Exit(exitCodeSchemaChanged)
+		}
+		if err != nil {
+			log.Fatalln(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(schemaCmd)
+	schemaCmd.AddCommand(schemaInferCmd)
+	schemaInferCmd.Flags().StringVarP(&schemaPathList, "path-list", "p", "", "Path to newline delimited file containing possible master table paths")
+	schemaInferCmd.Flags().BoolVarP(&schemaNoDefaultPaths, "no-default-paths", "n", false, "Ignore default paths and only use supplied path list")
+	schemaInferCmd.Flags().StringVar(&schemaPrevious, "previous", "", "Path to schemas inferred from the previous version, exiting with code 4 if any table changed (may be dest itself)")
+	schemaInferCmd.Flags().StringVar(&schemaReport, "report", "", "Path to JSON report of changes from the previous schemas")
+	schemaInferCmd.Flags().StringVarP(&schemaVersion, "version", "v", "", "Game version of src recorded in the schemas")
+	schemaInferCmd.Flags().IntVarP(&schemaIndent, "indent", "i", 0, "Indentation of JSON output")
+	schemaInferCmd.Flags().IntVarP(&schemaConcurrency, "concurrency", "c", 5, "Maximum number of concurrent table parsing")
+	schemaInferCmd.Flags().StringArrayVarP(&schemaArchives, "archive", "a", nil, "Read raw assets from downloaded zip archive layered on top of src, later archives take precedence (can be repeated)")
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+
+	"github.com/blead/wfax/pkg/wf"
+	"github.com/spf13/cobra"
+)
+
+var sniffExport string
+var sniffPathList string
+var sniffNoDefaultPaths bool
+var sniffUnresolved bool
+var sniffConcurrency int
+var sniffIndent int
+
+var sniffCmd = &cobra.Command{
+	Use:   "sniff [file|dir]",
+	Short: "Identify content types of raw asset files and print them to stdout",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		config := wf.SnifferConfig{
+			SrcPath:        filepath.Clean(args[0]),
+			DestPath:       sniffExport,
+			PathList:       sniffPathList,
+			NoDefaultPaths: sniffNoDefaultPaths,
+			Unresolved:     sniffUnresolved,
+			Concurrency:    sniffConcurrency,
+			Indent:         sniffIndent,
+		}
+
+		sniffer, err := wf.NewSniffer(&config)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		results, err := sniffer.SniffFiles()
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		for _, r := range results {
+			fmt.Printf("%s\t%s\t%d\n", r.Hash, r.Type, r.Size)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(sniffCmd)
+	sniffCmd.Flags().StringVarP(&sniffExport, "export", "x", "", "Export decoded content of files unresolvable from known asset paths into [export]/unknown/<hash>.<ext>")
+	sniffCmd.Flags().StringVarP(&sniffPathList, "path-list", "p", "", "Path to newline delimited file containing possible asset paths used with --unresolved")
+	sniffCmd.Flags().BoolVarP(&sniffNoDefaultPaths, "no-default-paths", "n", false, "Ignore default paths and only resolve hashes from supplied path list")
+	sniffCmd.Flags().BoolVarP(&sniffUnresolved, "unresolved", "u", false, "Skip files whose hashes can be resolved from known asset paths")
+	sniffCmd.Flags().IntVarP(&sniffConcurrency, "concurrency", "c", 5, "Maximum number of concurrent file sniffing")
+	sniffCmd.Flags().IntVarP(&sniffIndent, "indent", "i", 0, "Number of spaces used as indentation in exported JSON (default 0)")
+}
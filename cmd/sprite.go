@@ -11,7 +11,10 @@ import (
 var spritePath string
 var spriteScale float32
 var spriteConcurrency int
+var spriteProfile string
 var spriteEliyabot bool
+var spriteArchives []string
+var spriteManifest string
 
 var spriteCmd = &cobra.Command{
 	Use:   "sprite [src] [dest]",
@@ -19,12 +22,15 @@ var spriteCmd = &cobra.Command{
 	Args:  cobra.ExactArgs(2),
 	Run: func(cmd *cobra.Command, args []string) {
 		config := wf.SpriterConfig{
-			SrcPath:     filepath.Clean(args[0]),
-			DestPath:    filepath.Clean(args[1]),
-			SpritePath:  spritePath,
-			Scale:       spriteScale,
-			Concurrency: spriteConcurrency,
-			Eliyabot:    spriteEliyabot,
+			SrcPath:      filepath.Clean(args[0]),
+			Archives:     spriteArchives,
+			DestPath:     filepath.Clean(args[1]),
+			SpritePath:   spritePath,
+			ManifestPath: spriteManifest,
+			Scale:        spriteScale,
+			Concurrency:  spriteConcurrency,
+			Profile:      spriteProfile,
+			Eliyabot:     spriteEliyabot,
 		}
 
 		spriter, err := wf.NewSpriter(&config)
@@ -44,5 +50,8 @@ func init() {
 	spriteCmd.Flags().StringVarP(&spritePath, "path", "p", "item/sprite_sheet", "Internal path of target sprite sheet (default \"item/sprite_sheet\")")
 	spriteCmd.Flags().Float32VarP(&spriteScale, "scale", "s", 4, "Sprite size scaling (default 4.0)")
 	spriteCmd.Flags().IntVarP(&spriteConcurrency, "concurrency", "c", 5, "Maximum number of concurrent sprite processing")
-	spriteCmd.Flags().BoolVarP(&spriteEliyabot, "eliyabot", "e", false, "Extract weapon sprites with rarity backgrounds for eliyabot")
+	spriteCmd.Flags().StringArrayVarP(&spriteArchives, "archive", "a", nil, "Read raw assets from downloaded zip archive layered on top of src, later archives take precedence (can be repeated)")
+	spriteCmd.Flags().StringVarP(&spriteManifest, "manifest", "m", "", "Write manifest of written sprites with sha256 hashes and sizes to file")
+	spriteCmd.Flags().StringVarP(&spriteProfile, "profile", "P", "", "Compose sprites onto rarity backgrounds described by an export profile file, or a built-in profile name such as eliyabot")
+	spriteCmd.Flags().BoolVarP(&spriteEliyabot, "eliyabot", "e", false, "Extract weapon sprites with rarity backgrounds for eliyabot (same as --profile eliyabot)")
 }
@@ -0,0 +1,208 @@
+package encoding
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"sort"
+
+	"github.com/disintegration/imaging"
+)
+
+// AnimationFrame is a frame of an animation and its display time in milliseconds.
+type AnimationFrame struct {
+	Image image.Image
+	Delay int
+}
+
+// gifAlphaThreshold is the minimum alpha of opaque GIF pixels, GIF only supports a single transparent color.
+const gifAlphaThreshold = 0x80
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+func checkAnimationFrames(frames []*AnimationFrame) (image.Rectangle, error) {
+	if len(frames) == 0 {
+		return image.Rectangle{}, fmt.Errorf("checkAnimationFrames: no frames")
+	}
+	bounds := frames[0].Image.Bounds()
+	for i, f := range frames {
+		if f.Image.Bounds().Size() != bounds.Size() {
+			return image.Rectangle{}, fmt.Errorf("checkAnimationFrames: frame size mismatch, idx=%d, size=%v, expected=%v", i, f.Image.Bounds().Size(), bounds.Size())
+		}
+	}
+	return image.Rect(0, 0, bounds.Dx(), bounds.Dy()), nil
+}
+
+// gifPalette returns exact colors of frames with a transparent color first,
+// or a fixed palette if frames have too many colors, e.g. after smooth scaling.
+func gifPalette(frames []*image.NRGBA) color.Palette {
+	colors := map[color.NRGBA]struct{}{}
+	for _, img := range frames {
+		for i := 0; i < len(img.Pix); i += 4 {
+			if img.Pix[i+3] < gifAlphaThreshold {
+				continue
+			}
+			colors[color.NRGBA{img.Pix[i], img.Pix[i+1], img.Pix[i+2], 0xff}] = struct{}{}
+			if len(colors) > 255 {
+				return append(color.Palette{color.Transparent}, palette.Plan9[:255]...)
+			}
+		}
+	}
+
+	var sorted []color.NRGBA
+	for c := range colors {
+		sorted = append(sorted, c)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		return a.R < b.R || a.R == b.R && (a.G < b.G || a.G == b.G && a.B < b.B)
+	})
+
+	p := color.Palette{color.Transparent}
+	for _, c := range sorted {
+		p = append(p, c)
+	}
+	return p
+}
+
+// EncodeGIF encodes frames of the same size into a looping GIF.
+// Pixels below half opacity become transparent and delays are rounded to hundredths of a second.
+func EncodeGIF(frames []*AnimationFrame) ([]byte, error) {
+	bounds, err := checkAnimationFrames(frames)
+	if err != nil {
+		return nil, err
+	}
+
+	images := make([]*image.NRGBA, len(frames))
+	for i, f := range frames {
+		images[i] = imaging.Clone(f.Image)
+	}
+	p := gifPalette(images)
+
+	indices := map[color.NRGBA]uint8{}
+	anim := &gif.GIF{Config: image.Config{ColorModel: p, Width: bounds.Dx(), Height: bounds.Dy()}}
+	for i, img := range images {
+		paletted := image.NewPaletted(bounds, p)
+		for y := 0; y < bounds.Dy(); y++ {
+			for x := 0; x < bounds.Dx(); x++ {
+				c := img.NRGBAAt(x, y)
+				if c.A < gifAlphaThreshold {
+					continue
+				}
+				c.A = 0xff
+				idx, ok := indices[c]
+				if !ok {
+					idx = uint8(p[1:].Index(c) + 1)
+					indices[c] = idx
+				}
+				paletted.SetColorIndex(x, y, idx)
+			}
+		}
+
+		// most viewers slow down delays below 2
+		delay := (frames[i].Delay + 5) / 10
+		if delay < 2 {
+			delay = 2
+		}
+		anim.Image = append(anim.Image, paletted)
+		anim.Delay = append(anim.Delay, delay)
+		anim.Disposal = append(anim.Disposal, gif.DisposalBackground)
+	}
+
+	var output bytes.Buffer
+	err = gif.EncodeAll(&output, anim)
+	if err != nil {
+		return nil, err
+	}
+	return output.Bytes(), nil
+}
+
+func writePNGChunk(w *bytes.Buffer, name string, data []byte) {
+	binary.Write(w, binary.BigEndian, uint32(len(data)))
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(name))
+	crc.Write(data)
+	w.WriteString(name)
+	w.Write(data)
+	binary.Write(w, binary.BigEndian, crc.Sum32())
+}
+
+// pngImageData compresses unfiltered 8-bit RGBA scanlines of img.
+func pngImageData(img image.Image) ([]byte, error) {
+	nrgba := imaging.Clone(img)
+	var output bytes.Buffer
+	zw, err := zlib.NewWriterLevel(&output, zlib.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	for y := 0; y < nrgba.Rect.Dy(); y++ {
+		zw.Write([]byte{0})
+		zw.Write(nrgba.Pix[y*nrgba.Stride : y*nrgba.Stride+nrgba.Rect.Dx()*4])
+	}
+	err = zw.Close()
+	if err != nil {
+		return nil, err
+	}
+	return output.Bytes(), nil
+}
+
+// EncodeAPNG encodes frames of the same size into a looping APNG.
+func EncodeAPNG(frames []*AnimationFrame) ([]byte, error) {
+	bounds, err := checkAnimationFrames(frames)
+	if err != nil {
+		return nil, err
+	}
+
+	var output bytes.Buffer
+	output.Write(pngSignature)
+
+	// 8-bit truecolor with alpha
+	ihdr := binary.BigEndian.AppendUint32(nil, uint32(bounds.Dx()))
+	ihdr = binary.BigEndian.AppendUint32(ihdr, uint32(bounds.Dy()))
+	ihdr = append(ihdr, 8, 6, 0, 0, 0)
+	writePNGChunk(&output, "IHDR", ihdr)
+
+	// loop forever
+	actl := binary.BigEndian.AppendUint32(nil, uint32(len(frames)))
+	actl = binary.BigEndian.AppendUint32(actl, 0)
+	writePNGChunk(&output, "acTL", actl)
+
+	var seq uint32
+	for i, f := range frames {
+		delay := f.Delay
+		if delay > 0xffff {
+			delay = 0xffff
+		}
+		fctl := binary.BigEndian.AppendUint32(nil, seq)
+		fctl = binary.BigEndian.AppendUint32(fctl, uint32(bounds.Dx()))
+		fctl = binary.BigEndian.AppendUint32(fctl, uint32(bounds.Dy()))
+		fctl = binary.BigEndian.AppendUint32(fctl, 0)
+		fctl = binary.BigEndian.AppendUint32(fctl, 0)
+		fctl = binary.BigEndian.AppendUint16(fctl, uint16(delay))
+		fctl = binary.BigEndian.AppendUint16(fctl, 1000)
+		// frames cover the canvas: no disposal, replace previous pixels
+		fctl = append(fctl, 0, 0)
+		writePNGChunk(&output, "fcTL", fctl)
+		seq++
+
+		data, err := pngImageData(f.Image)
+		if err != nil {
+			return nil, fmt.Errorf("EncodeAPNG: compress error, idx=%d, %w", i, err)
+		}
+		if i == 0 {
+			writePNGChunk(&output, "IDAT", data)
+			continue
+		}
+		writePNGChunk(&output, "fdAT", append(binary.BigEndian.AppendUint32(nil, seq), data...))
+		seq++
+	}
+
+	writePNGChunk(&output, "IEND", nil)
+	return output.Bytes(), nil
+}
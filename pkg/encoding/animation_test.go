@@ -0,0 +1,57 @@
+package encoding
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"testing"
+)
+
+func TestEncodeAnimation(t *testing.T) {
+	red := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+	red.SetNRGBA(0, 0, color.NRGBA{0xff, 0, 0, 0xff})
+	blue := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+	blue.SetNRGBA(1, 1, color.NRGBA{0, 0, 0xff, 0xff})
+	frames := []*AnimationFrame{{Image: red, Delay: 100}, {Image: blue, Delay: 50}}
+
+	data, err := EncodeGIF(frames)
+	if err != nil {
+		t.Fatal(err)
+	}
+	anim, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(anim.Image) != 2 || anim.Delay[0] != 10 || anim.Delay[1] != 5 {
+		t.Errorf("EncodeGIF() frames=%d, delays=%v", len(anim.Image), anim.Delay)
+	}
+	if _, _, _, a := anim.Image[1].At(0, 0).RGBA(); a != 0 {
+		t.Errorf("EncodeGIF() transparent pixel alpha=%d", a)
+	}
+	if r, g, b, _ := anim.Image[1].At(1, 1).RGBA(); r != 0 || g != 0 || b != 0xffff {
+		t.Errorf("EncodeGIF() pixel=%d,%d,%d", r, g, b)
+	}
+
+	data, err = EncodeAPNG(frames)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// decoders without APNG support show the first frame
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := color.NRGBAModel.Convert(img.At(0, 0)).(color.NRGBA); c != (color.NRGBA{0xff, 0, 0, 0xff}) {
+		t.Errorf("EncodeAPNG() first frame pixel=%v", c)
+	}
+	if !bytes.Contains(data, []byte("acTL")) || bytes.Count(data, []byte("fcTL")) != 2 || bytes.Count(data, []byte("fdAT")) != 1 {
+		t.Errorf("EncodeAPNG() missing animation chunks")
+	}
+
+	_, err = EncodeGIF([]*AnimationFrame{{Image: red}, {Image: image.NewNRGBA(image.Rect(0, 0, 1, 1))}})
+	if err == nil {
+		t.Errorf("EncodeGIF() with different frame sizes, want error")
+	}
+}
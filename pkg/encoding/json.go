@@ -3,7 +3,12 @@ package encoding
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
 
 	omap "github.com/iancoleman/orderedmap"
 )
@@ -61,3 +66,162 @@ func shallowUnmarshalJSONObject(b []byte) (*omap.OrderedMap, error) {
 
 	return o, nil
 }
+
+// NormalizeOptions configures NormalizeJSON.
+type NormalizeOptions struct {
+	Indent int
+	// SortKeys sorts object keys, otherwise keys keep their source order.
+	SortKeys bool
+	// KeepNumbers keeps number literals as written, otherwise floats are formatted in their shortest form.
+	KeepNumbers bool
+}
+
+type jsonMember struct {
+	key   string
+	value any
+}
+
+// decodeOrderedJSON decodes the next JSON value of dec with objects as []jsonMember in source order.
+func decodeOrderedJSON(dec *json.Decoder) (any, error) {
+	t, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	delim, ok := t.(json.Delim)
+	if !ok {
+		return t, nil
+	}
+	switch delim {
+	case '{':
+		members := []jsonMember{}
+		for dec.More() {
+			k, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			v, err := decodeOrderedJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			members = append(members, jsonMember{key: k.(string), value: v})
+		}
+		_, err = dec.Token()
+		return members, err
+	case '[':
+		values := []any{}
+		for dec.More() {
+			v, err := decodeOrderedJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		_, err = dec.Token()
+		return values, err
+	}
+	return nil, fmt.Errorf("decodeOrderedJSON: unexpected delimiter, delim=%s", delim)
+}
+
+// normalizeNumber formats floats in their shortest form, e.g. 1.50 as 1.5 and 1e3 as 1000.
+// Integers are kept as is so that they do not lose precision.
+func normalizeNumber(n json.Number) string {
+	s := string(n)
+	if !strings.ContainsAny(s, ".eE") {
+		if s == "-0" {
+			return "0"
+		}
+		return s
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return s
+	}
+	if f == 0 {
+		return "0"
+	}
+	output, err := json.Marshal(f)
+	if err != nil {
+		return s
+	}
+	return string(output)
+}
+
+func writeNormalizedJSON(output *bytes.Buffer, v any, options *NormalizeOptions) error {
+	switch val := v.(type) {
+	case []jsonMember:
+		if options.SortKeys {
+			sort.SliceStable(val, func(i, j int) bool { return val[i].key < val[j].key })
+		}
+		output.WriteByte('{')
+		for i, m := range val {
+			if i > 0 {
+				output.WriteByte(',')
+			}
+			err := writeNormalizedJSON(output, m.key, options)
+			if err != nil {
+				return err
+			}
+			output.WriteByte(':')
+			err = writeNormalizedJSON(output, m.value, options)
+			if err != nil {
+				return err
+			}
+		}
+		output.WriteByte('}')
+	case []any:
+		output.WriteByte('[')
+		for i, e := range val {
+			if i > 0 {
+				output.WriteByte(',')
+			}
+			err := writeNormalizedJSON(output, e, options)
+			if err != nil {
+				return err
+			}
+		}
+		output.WriteByte(']')
+	case json.Number:
+		if options.KeepNumbers {
+			output.WriteString(string(val))
+		} else {
+			output.WriteString(normalizeNumber(val))
+		}
+	default:
+		js, err := jsonMarshalNoEscape(val)
+		if err != nil {
+			return err
+		}
+		output.Write(bytes.TrimSuffix(js, []byte("\n")))
+	}
+	return nil
+}
+
+// NormalizeJSON rewrites JSON with consistent key ordering, number formatting, indentation and a single trailing newline.
+// Identical values produce byte-identical outputs regardless of how they were originally formatted.
+func NormalizeJSON(data []byte, options *NormalizeOptions) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	v, err := decodeOrderedJSON(dec)
+	if err != nil {
+		return nil, fmt.Errorf("NormalizeJSON: decode error, %w", err)
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("NormalizeJSON: unexpected data after JSON value")
+	}
+
+	var compact bytes.Buffer
+	err = writeNormalizedJSON(&compact, v, options)
+	if err != nil {
+		return nil, err
+	}
+
+	var output bytes.Buffer
+	err = json.Indent(&output, compact.Bytes(), "", strings.Repeat(" ", options.Indent))
+	if err != nil {
+		return nil, err
+	}
+	output.WriteByte('\n')
+	return output.Bytes(), nil
+}
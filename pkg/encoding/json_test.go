@@ -0,0 +1,47 @@
+package encoding
+
+import (
+	"testing"
+)
+
+func TestNormalizeJSON(t *testing.T) {
+	inputs := []string{
+		`{"b":[1.50,1e3,-0.0,12345678901234567890],"a":{"y":"<&>","x":true},"c":null}`,
+		"{\n  \"b\": [1.5, 1000, 0, 12345678901234567890],\n  \"a\": {\"y\": \"<&>\", \"x\": true},\n  \"c\": null\n}\n\n",
+	}
+
+	sourceOrder := "{\n\"b\": [\n1.5,\n1000,\n0,\n12345678901234567890\n],\n\"a\": {\n\"y\": \"<&>\",\n\"x\": true\n},\n\"c\": null\n}\n"
+	sorted := "{\n \"a\": {\n  \"x\": true,\n  \"y\": \"<&>\"\n },\n \"b\": [\n  1.5,\n  1000,\n  0,\n  12345678901234567890\n ],\n \"c\": null\n}\n"
+
+	for _, input := range inputs {
+		got, err := NormalizeJSON([]byte(input), &NormalizeOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != sourceOrder {
+			t.Errorf("NormalizeJSON(%q) = %q, want %q", input, got, sourceOrder)
+		}
+
+		got, err = NormalizeJSON([]byte(input), &NormalizeOptions{Indent: 1, SortKeys: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != sorted {
+			t.Errorf("NormalizeJSON(%q, SortKeys) = %q, want %q", input, got, sorted)
+		}
+	}
+
+	got, err := NormalizeJSON([]byte(inputs[0]), &NormalizeOptions{KeepNumbers: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keepNumbers := "{\n\"b\": [\n1.50,\n1e3,\n-0.0,\n12345678901234567890\n],\n\"a\": {\n\"y\": \"<&>\",\n\"x\": true\n},\n\"c\": null\n}\n"
+	if string(got) != keepNumbers {
+		t.Errorf("NormalizeJSON(%q, KeepNumbers) = %q, want %q", inputs[0], got, keepNumbers)
+	}
+
+	_, err = NormalizeJSON([]byte(`{} {}`), &NormalizeOptions{})
+	if err == nil {
+		t.Errorf("NormalizeJSON() with trailing data, want error")
+	}
+}
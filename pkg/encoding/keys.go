@@ -0,0 +1,145 @@
+package encoding
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// KeyDictionary maps obfuscated keys of JSON objects to readable names depending on their location.
+type KeyDictionary struct {
+	// Keys maps obfuscated keys of this object to readable names.
+	Keys map[string]string `json:"keys,omitempty"`
+	// Fields are dictionaries of values under obfuscated keys, or indices of arrays.
+	Fields map[string]*KeyDictionary `json:"fields,omitempty"`
+	// Items is the dictionary of every other value of this object or array.
+	Items *KeyDictionary `json:"items,omitempty"`
+	// Variants are dictionaries of enum arrays by their tag in the first element, e.g. ["T1", {...}].
+	Variants map[string]*KeyDictionary `json:"variants,omitempty"`
+
+	// names maps readable names back to obfuscated keys.
+	names map[string]string
+}
+
+// Validate checks that renaming is reversible and prepares the dictionary for use.
+func (dict *KeyDictionary) Validate() error {
+	if dict == nil {
+		return nil
+	}
+
+	dict.names = map[string]string{}
+	for key, name := range dict.Keys {
+		if name == "" {
+			return fmt.Errorf("KeyDictionary: empty name, key=%s", key)
+		}
+		if other, ok := dict.names[name]; ok {
+			return fmt.Errorf("KeyDictionary: duplicate name, name=%s, keys=%s,%s", name, key, other)
+		}
+		// names colliding with other keys of the same object cannot be reversed
+		if _, ok := dict.Keys[name]; ok && name != key {
+			return fmt.Errorf("KeyDictionary: name collides with key, name=%s, key=%s", name, key)
+		}
+		dict.names[name] = key
+	}
+
+	for key, field := range dict.Fields {
+		err := field.Validate()
+		if err != nil {
+			return fmt.Errorf("%w, field=%s", err, key)
+		}
+	}
+	for tag, variant := range dict.Variants {
+		err := variant.Validate()
+		if err != nil {
+			return fmt.Errorf("%w, variant=%s", err, tag)
+		}
+	}
+	return dict.Items.Validate()
+}
+
+// field returns the dictionary of the value under an obfuscated key or array index.
+func (dict *KeyDictionary) field(key string) *KeyDictionary {
+	if field, ok := dict.Fields[key]; ok {
+		return field
+	}
+	return dict.Items
+}
+
+// rename renames keys of v, or restores obfuscated keys if reverse is set.
+func (dict *KeyDictionary) rename(v any, reverse bool) (any, error) {
+	if dict == nil {
+		return v, nil
+	}
+
+	switch val := v.(type) {
+	case map[string]any:
+		output := make(map[string]any, len(val))
+		for k, value := range val {
+			key, name := k, k
+			if reverse {
+				if obfuscated, ok := dict.names[k]; ok {
+					key = obfuscated
+				}
+				name = key
+			} else if readable, ok := dict.Keys[k]; ok {
+				name = readable
+			}
+			if _, ok := output[name]; ok {
+				return nil, fmt.Errorf("rename KeyDictionary: duplicate key after renaming, key=%s, name=%s", k, name)
+			}
+
+			renamed, err := dict.field(key).rename(value, reverse)
+			if err != nil {
+				return nil, err
+			}
+			output[name] = renamed
+		}
+		return output, nil
+	case []any:
+		if len(val) > 0 {
+			if tag, ok := val[0].(string); ok {
+				if variant, ok := dict.Variants[tag]; ok {
+					return variant.rename(val, reverse)
+				}
+			}
+		}
+		output := make([]any, len(val))
+		for i, value := range val {
+			renamed, err := dict.field(strconv.Itoa(i)).rename(value, reverse)
+			if err != nil {
+				return nil, err
+			}
+			output[i] = renamed
+		}
+		return output, nil
+	}
+	return v, nil
+}
+
+// RenameJSONKeys renames obfuscated keys of JSON according to dict, or restores them if reverse is set.
+// The dictionary needs to be validated first.
+func RenameJSONKeys(js []byte, dict *KeyDictionary, reverse bool, indent int) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.UseNumber()
+	var v any
+	err := dec.Decode(&v)
+	if err != nil {
+		return nil, err
+	}
+
+	renamed, err := dict.rename(v, reverse)
+	if err != nil {
+		return nil, err
+	}
+	output, err := jsonMarshalNoEscape(renamed)
+	if err != nil {
+		return nil, err
+	}
+
+	var indented bytes.Buffer
+	err = json.Indent(&indented, output, "", strings.Repeat(" ", indent))
+
+	return indented.Bytes(), err
+}
@@ -0,0 +1,77 @@
+package encoding
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestRenameJSONKeys(t *testing.T) {
+	dict := &KeyDictionary{}
+	err := json.Unmarshal([]byte(`{
+		"keys": {"au": "forms", "bx": "type"},
+		"fields": {
+			"au": {"items": {
+				"keys": {"g": "states", "i": "stunActions"},
+				"fields": {"g": {"items": {"keys": {"i": "actions"}}}}
+			}},
+			"bx": {"variants": {"T1": {"fields": {"1": {"keys": {"g": "preActionPath"}}}}}}
+		}
+	}`), dict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dict.Validate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obfuscated := `{"au":[{"g":{"idle":{"i":[1.5]}},"i":[2]}],"bx":["T1",{"g":"a/b"}],"x":{"g":0}}`
+	readable := `{"forms":[{"states":{"idle":{"actions":[1.5]}},"stunActions":[2]}],"type":["T1",{"preActionPath":"a/b"}],"x":{"g":0}}`
+
+	got, err := RenameJSONKeys([]byte(obfuscated), dict, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var compact bytes.Buffer
+	json.Compact(&compact, got)
+	if compact.String() != readable {
+		t.Errorf("RenameJSONKeys() = %s, want %s", compact.String(), readable)
+	}
+
+	got, err = RenameJSONKeys(got, dict, true, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compact.Reset()
+	json.Compact(&compact, got)
+	if compact.String() != obfuscated {
+		t.Errorf("RenameJSONKeys(reverse) = %s, want %s", compact.String(), obfuscated)
+	}
+
+	// other variants are not renamed
+	got, err = RenameJSONKeys([]byte(`{"bx":["T2",{"g":1}]}`), dict, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compact.Reset()
+	json.Compact(&compact, got)
+	if want := `{"type":["T2",{"g":1}]}`; compact.String() != want {
+		t.Errorf("RenameJSONKeys() = %s, want %s", compact.String(), want)
+	}
+
+	_, err = RenameJSONKeys([]byte(`{"au":[],"forms":[]}`), dict, false, 0)
+	if err == nil {
+		t.Errorf("RenameJSONKeys() with colliding keys, want error")
+	}
+
+	for _, invalid := range []*KeyDictionary{
+		{Keys: map[string]string{"a": "x", "b": "x"}},
+		{Keys: map[string]string{"a": "b", "b": "c"}},
+		{Fields: map[string]*KeyDictionary{"a": {Keys: map[string]string{"a": ""}}}},
+	} {
+		if invalid.Validate() == nil {
+			t.Errorf("Validate(%+v), want error", invalid)
+		}
+	}
+}
@@ -11,12 +11,176 @@ import (
 	omap "github.com/iancoleman/orderedmap"
 )
 
+// OrderedmapOptions configures conversions between WF orderedmap and JSON.
+type OrderedmapOptions struct {
+	Indent     int
+	FlattenCSV bool
+	// Schema describes names and types of CSV columns.
+	Schema *TableSchema
+	// NamedColumns converts rows into JSON objects keyed by column names from Schema instead of arrays.
+	NamedColumns bool
+	// TypedValues converts CSV cells into numbers, booleans and nulls according to schema types or inferred column types.
+	TypedValues bool
+}
+
 type orderedMapOffset struct {
 	KeyEndOffset   int32
 	ValueEndOffset int32
 }
 
-func readOrderedMap(raw []byte, flattenCSV bool) (json.Marshaler, error) {
+// orderedmapNode is a decoded orderedmap, either CSV records or entries of nested orderedmaps.
+type orderedmapNode struct {
+	leaf     bool
+	records  [][]string
+	keys     []string
+	children []*orderedmapNode
+}
+
+// walkRecords calls f with CSV records of every leaf in order.
+func (node *orderedmapNode) walkRecords(f func([][]string)) {
+	if node.leaf {
+		f(node.records)
+		return
+	}
+	for _, c := range node.children {
+		c.walkRecords(f)
+	}
+}
+
+// columnTypes returns the type of each column across all records, enforced by schema or inferred from values.
+func (node *orderedmapNode) columnTypes(schema *TableSchema) []string {
+	return inferColumnTypes(node.walkRecords, schema)
+}
+
+// inferColumnTypes returns the type of each column across records supplied by walk, enforced by schema or inferred from values.
+func inferColumnTypes(walk func(func([][]string)), schema *TableSchema) []string {
+	var numbers, bools []bool
+	walk(func(rec [][]string) {
+		for _, row := range rec {
+			for i, cell := range row {
+				for len(numbers) <= i {
+					numbers = append(numbers, true)
+					bools = append(bools, true)
+				}
+				if cell == "" {
+					continue
+				}
+				numbers[i] = numbers[i] && isNumber(cell)
+				bools[i] = bools[i] && isBool(cell)
+			}
+		}
+	})
+
+	types := make([]string, len(numbers))
+	for i := range types {
+		if c := schema.column(i); c != nil && c.Type != "" {
+			types[i] = c.Type
+			continue
+		}
+		switch {
+		case numbers[i] && !bools[i]:
+			types[i] = ColumnNumber
+		case bools[i] && !numbers[i]:
+			types[i] = ColumnBool
+		default:
+			types[i] = ColumnString
+		}
+	}
+	return types
+}
+
+// typedRow converts CSV cells into JSON values according to column types.
+// Values are only converted if the original text can be written back exactly.
+func typedRow(row []string, types []string) []any {
+	output := make([]any, len(row))
+	for i, cell := range row {
+		switch {
+		case cell == "":
+			output[i] = nil
+		case types[i] == ColumnNumber && isNumber(cell):
+			output[i] = json.Number(cell)
+		case types[i] == ColumnBool && isBool(cell):
+			output[i] = cell == "true"
+		default:
+			output[i] = cell
+		}
+	}
+	return output
+}
+
+// namedRow converts a row into an object keyed by column names.
+func namedRow(row []any, schema *TableSchema) *omap.OrderedMap {
+	o := omap.New()
+	o.SetEscapeHTML(false)
+	for i, cell := range row {
+		o.Set(schema.ColumnName(i), cell)
+	}
+	return o
+}
+
+// cellString converts a JSON value back into the CSV cell it was converted from.
+func cellString(data json.RawMessage) (string, error) {
+	data = bytes.TrimSpace(data)
+	switch {
+	case len(data) == 0:
+		return "", fmt.Errorf("cellString: empty value")
+	case data[0] == '"':
+		var s string
+		err := json.Unmarshal(data, &s)
+		return s, err
+	case string(data) == "null":
+		return "", nil
+	case isBool(string(data)), isNumber(string(data)):
+		return string(data), nil
+	}
+	return "", fmt.Errorf("cellString: unexpected value, value=%s", string(data))
+}
+
+// positionalRow converts a JSON row, either an array or an object keyed by column names, back into a CSV row.
+func positionalRow(data []byte, schema *TableSchema) ([]string, error) {
+	data = bytes.TrimLeft(data, " \t\r\n")
+	if len(data) > 0 && data[0] == '[' {
+		var cells []json.RawMessage
+		err := json.Unmarshal(data, &cells)
+		if err != nil {
+			return nil, err
+		}
+
+		row := make([]string, len(cells))
+		for i, c := range cells {
+			row[i], err = cellString(c)
+			if err != nil {
+				return nil, fmt.Errorf("positionalRow: column value error, column=%d, %w", i, err)
+			}
+		}
+		return row, nil
+	}
+
+	o, err := shallowUnmarshalJSONObject(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var row []string
+	for _, k := range o.Keys() {
+		i, ok := schema.ColumnIndex(k)
+		if !ok {
+			return nil, fmt.Errorf("positionalRow: unknown column, column=%s", k)
+		}
+		for len(row) <= i {
+			row = append(row, "")
+		}
+
+		v, _ := o.Get(k)
+		row[i], err = cellString(v.(json.RawMessage))
+		if err != nil {
+			return nil, fmt.Errorf("positionalRow: column value error, column=%s, %w", k, err)
+		}
+	}
+	return row, nil
+}
+
+func decodeOrderedmap(raw []byte) (*orderedmapNode, error) {
 	// data can be plain zlib-compressed csv or map structure
 	data, err := readZlib(raw)
 	if err == nil {
@@ -26,28 +190,22 @@ func readOrderedMap(raw []byte, flattenCSV bool) (json.Marshaler, error) {
 		if err != nil {
 			return nil, err
 		}
-
-		output, err := jsonMarshalNoEscape(
-			func() any {
-				if flattenCSV {
-					return Flatten(rec)
-				}
-				return rec
-			}(),
-		)
-		if err != nil {
-			return nil, err
-		}
-		return json.RawMessage(output), nil
+		return &orderedmapNode{leaf: true, records: rec}, nil
 	}
 
 	// map structure
 	// first 4 bytes = header size in little endian
+	if len(raw) < 4 {
+		return nil, fmt.Errorf("decodeOrderedmap: data too short, size=%d", len(raw))
+	}
 	var headerSize int32
 	err = binary.Read(bytes.NewReader(raw[0:4]), binary.LittleEndian, &headerSize)
 	if err != nil {
 		return nil, err
 	}
+	if headerSize < 0 || int(headerSize) > len(raw)-4 {
+		return nil, fmt.Errorf("decodeOrderedmap: header size out of range, headerSize=%d, size=%d", headerSize, len(raw))
+	}
 
 	// header is zlib-compressed
 	header, err := readZlib(raw[4 : 4+headerSize])
@@ -56,11 +214,17 @@ func readOrderedMap(raw []byte, flattenCSV bool) (json.Marshaler, error) {
 	}
 
 	// first 4 bytes of header = number of mapped entries
+	if len(header) < 4 {
+		return nil, fmt.Errorf("decodeOrderedmap: header too short, size=%d", len(header))
+	}
 	var entriesCount int32
 	err = binary.Read(bytes.NewReader(header[0:4]), binary.LittleEndian, &entriesCount)
 	if err != nil {
 		return nil, err
 	}
+	if entriesCount < 0 || int(entriesCount) > (len(header)-4)/8 {
+		return nil, fmt.Errorf("decodeOrderedmap: entries count out of range, entriesCount=%d, headerSize=%d", entriesCount, len(header))
+	}
 
 	// offsets = header[4:4 + entriesCount*8], each entry = (keyEndOffset, valueEndOffset) (4 + 4 bytes)
 	var offsets []*orderedMapOffset
@@ -79,26 +243,99 @@ func readOrderedMap(raw []byte, flattenCSV bool) (json.Marshaler, error) {
 	valueSection := raw[4+headerSize:]
 	currentKeyOffset := int32(0)
 	currentValueOffset := int32(0)
-	output := omap.New()
-	output.SetEscapeHTML(false)
+	node := &orderedmapNode{}
 	for _, offset := range offsets {
+		if offset.KeyEndOffset < currentKeyOffset || int(offset.KeyEndOffset) > len(keySection) ||
+			offset.ValueEndOffset < currentValueOffset || int(offset.ValueEndOffset) > len(valueSection) {
+			return nil, fmt.Errorf("decodeOrderedmap: entry offset out of range, keyEndOffset=%d, valueEndOffset=%d", offset.KeyEndOffset, offset.ValueEndOffset)
+		}
 		key := keySection[currentKeyOffset:offset.KeyEndOffset]
 		value := valueSection[currentValueOffset:offset.ValueEndOffset]
 		currentKeyOffset = offset.KeyEndOffset
 		currentValueOffset = offset.ValueEndOffset
 
 		// value is a nested orderedmap
-		om, err := readOrderedMap(value, flattenCSV)
+		child, err := decodeOrderedmap(value)
 		if err != nil {
 			return nil, err
 		}
-		output.Set(string(key), om)
+		node.keys = append(node.keys, string(key))
+		node.children = append(node.children, child)
 	}
 
+	return node, nil
+}
+
+// marshaler converts node into a JSON marshaler, types are column types used to convert cells if not nil.
+func (node *orderedmapNode) marshaler(options *OrderedmapOptions, types []string) (json.Marshaler, error) {
+	if node.leaf {
+		output, err := jsonMarshalNoEscape(
+			func() any {
+				named := options.NamedColumns && options.Schema != nil
+				if types == nil && !named {
+					if options.FlattenCSV {
+						return Flatten(node.records)
+					}
+					return node.records
+				}
+
+				rows := make([][]any, len(node.records))
+				for i, row := range node.records {
+					if types != nil {
+						rows[i] = typedRow(row, types)
+					} else {
+						rows[i] = make([]any, len(row))
+						for j, cell := range row {
+							rows[i][j] = cell
+						}
+					}
+				}
+
+				if options.FlattenCSV {
+					return Flatten(rows)
+				}
+				if named {
+					objects := make([]*omap.OrderedMap, len(rows))
+					for i, row := range rows {
+						objects[i] = namedRow(row, options.Schema)
+					}
+					return objects
+				}
+				return rows
+			}(),
+		)
+		if err != nil {
+			return nil, err
+		}
+		return json.RawMessage(output), nil
+	}
+
+	output := omap.New()
+	output.SetEscapeHTML(false)
+	for i, child := range node.children {
+		om, err := child.marshaler(options, types)
+		if err != nil {
+			return nil, err
+		}
+		output.Set(node.keys[i], om)
+	}
 	return output, nil
 }
 
-func writeOrderedmap(jsonData []byte) ([]byte, error) {
+func readOrderedMap(raw []byte, options *OrderedmapOptions) (json.Marshaler, error) {
+	node, err := decodeOrderedmap(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	var types []string
+	if options.TypedValues {
+		types = node.columnTypes(options.Schema)
+	}
+	return node.marshaler(options, types)
+}
+
+func writeOrderedmap(jsonData []byte, options *OrderedmapOptions) ([]byte, error) {
 	// trim potential whitespaces
 	data := bytes.TrimLeft(jsonData, "\t\r\n")
 	if len(data) == 0 {
@@ -107,12 +344,20 @@ func writeOrderedmap(jsonData []byte) ([]byte, error) {
 
 	// array: convert to zlib-compressed csv
 	if data[0] == '[' {
-		var rec [][]string
-		err := json.Unmarshal(data, &rec)
+		var rows []json.RawMessage
+		err := json.Unmarshal(data, &rows)
 		if err != nil {
 			return nil, err
 		}
 
+		rec := make([][]string, len(rows))
+		for i, row := range rows {
+			rec[i], err = positionalRow(row, options.Schema)
+			if err != nil {
+				return nil, fmt.Errorf("writeOrderedmap: row error, row=%d, %w", i, err)
+			}
+		}
+
 		var csvData bytes.Buffer
 		w := csv.NewWriter(&csvData)
 		err = w.WriteAll(rec)
@@ -144,7 +389,7 @@ func writeOrderedmap(jsonData []byte) ([]byte, error) {
 			if !ok {
 				return nil, fmt.Errorf("writeOrderedmap: value type assertion failed, key=%s, data=%s", k, string(data))
 			}
-			valueBytes, err := writeOrderedmap(valueJSON)
+			valueBytes, err := writeOrderedmap(valueJSON, options)
 			if err != nil {
 				return nil, err
 			}
@@ -188,7 +433,12 @@ func writeOrderedmap(jsonData []byte) ([]byte, error) {
 
 // OrderedmapToJSON converts WF orderedmap to JSON.
 func OrderedmapToJSON(raw []byte, indent int, flattenCSV bool) ([]byte, error) {
-	om, err := readOrderedMap(raw, flattenCSV)
+	return OrderedmapToJSONWithOptions(raw, &OrderedmapOptions{Indent: indent, FlattenCSV: flattenCSV})
+}
+
+// OrderedmapToJSONWithOptions converts WF orderedmap to JSON with the supplied options.
+func OrderedmapToJSONWithOptions(raw []byte, options *OrderedmapOptions) ([]byte, error) {
+	om, err := readOrderedMap(raw, options)
 	if err != nil {
 		return nil, err
 	}
@@ -199,12 +449,18 @@ func OrderedmapToJSON(raw []byte, indent int, flattenCSV bool) ([]byte, error) {
 	}
 
 	var output bytes.Buffer
-	err = json.Indent(&output, js, "", strings.Repeat(" ", indent))
+	err = json.Indent(&output, js, "", strings.Repeat(" ", options.Indent))
 
 	return output.Bytes(), err
 }
 
 // JSONToOrderedmap converts JSON back to WF orderedmap.
 func JSONToOrderedmap(jsonData []byte) ([]byte, error) {
-	return writeOrderedmap(jsonData)
+	return JSONToOrderedmapWithOptions(jsonData, &OrderedmapOptions{})
+}
+
+// JSONToOrderedmapWithOptions converts JSON back to WF orderedmap with the supplied options.
+// Rows converted into objects with Schema are converted back into positional CSV rows.
+func JSONToOrderedmapWithOptions(jsonData []byte, options *OrderedmapOptions) ([]byte, error) {
+	return writeOrderedmap(jsonData, options)
 }
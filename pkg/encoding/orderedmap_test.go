@@ -0,0 +1,142 @@
+package encoding
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestOrderedmapNamedColumns(t *testing.T) {
+	schema := &TableSchema{Columns: []*ColumnSchema{
+		{Index: 0, Name: "devname"},
+		{Index: 2, Name: "rarity"},
+	}}
+	positional := []byte(`{"1":[["alk","","5"]],"2":{"a":[["bob","x","4"],["eve","y","3"]]}}`)
+
+	raw, err := JSONToOrderedmap(positional)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	named, err := OrderedmapToJSONWithOptions(raw, &OrderedmapOptions{Schema: schema, NamedColumns: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got bytes.Buffer
+	err = json.Compact(&got, named)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"1":[{"devname":"alk","1":"","rarity":"5"}],"2":{"a":[{"devname":"bob","1":"x","rarity":"4"},{"devname":"eve","1":"y","rarity":"3"}]}}`
+	if got.String() != want {
+		t.Errorf("OrderedmapToJSONWithOptions() = %s, want %s", got.String(), want)
+	}
+
+	repacked, err := JSONToOrderedmapWithOptions(named, &OrderedmapOptions{Schema: schema})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(raw, repacked) {
+		t.Errorf("JSONToOrderedmapWithOptions() = %x, want %x", repacked, raw)
+	}
+}
+
+func TestOrderedmapTypedValues(t *testing.T) {
+	schema := &TableSchema{Columns: []*ColumnSchema{
+		{Index: 3, Name: "code", Type: ColumnString},
+	}}
+	positional := []byte(`{"1":[["alk","1.50","true","10",""]],"2":[["bob","-2","false","20","x"]],"3":[["eve","01","","30",""]]}`)
+
+	raw, err := JSONToOrderedmap(positional)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	typed, err := OrderedmapToJSONWithOptions(raw, &OrderedmapOptions{Schema: schema, TypedValues: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got bytes.Buffer
+	err = json.Compact(&got, typed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// "01" is not a valid number so the column stays a string column
+	want := `{"1":[["alk","1.50",true,"10",null]],"2":[["bob","-2",false,"20","x"]],"3":[["eve","01",null,"30",null]]}`
+	if got.String() != want {
+		t.Errorf("OrderedmapToJSONWithOptions() = %s, want %s", got.String(), want)
+	}
+
+	repacked, err := JSONToOrderedmap(typed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(raw, repacked) {
+		t.Errorf("JSONToOrderedmap() = %x, want %x", repacked, raw)
+	}
+
+	numbers := []byte(`{"1":[["1","1.50","-3e5"]],"2":[["2","0.25",""]]}`)
+	raw, err = JSONToOrderedmap(numbers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	typed, err = OrderedmapToJSONWithOptions(raw, &OrderedmapOptions{TypedValues: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got.Reset()
+	err = json.Compact(&got, typed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = `{"1":[[1,1.50,-3e5]],"2":[[2,0.25,null]]}`
+	if got.String() != want {
+		t.Errorf("OrderedmapToJSONWithOptions() = %s, want %s", got.String(), want)
+	}
+	repacked, err = JSONToOrderedmap(typed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(raw, repacked) {
+		t.Errorf("JSONToOrderedmap() = %x, want %x", repacked, raw)
+	}
+}
+
+func TestOrderedmapCSV(t *testing.T) {
+	schema := &TableSchema{Columns: []*ColumnSchema{{Index: 0, Name: "devname"}}}
+	raw, err := JSONToOrderedmap([]byte(`{"1":{"a":[["alk","x,y"],["bob",""]],"b":[]},"2":{"c":[["eve","multi\nline"]]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, comma := range []rune{',', '\t'} {
+		data, err := OrderedmapToCSV(raw, schema, comma)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		header, _, _ := strings.Cut(string(data), "\n")
+		want := strings.Join([]string{"_key1", "_key2", "devname", "1"}, string(comma))
+		if header != want {
+			t.Errorf("OrderedmapToCSV() header = %q, want %q", header, want)
+		}
+
+		repacked, err := CSVToOrderedmap(data, comma)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(raw, repacked) {
+			t.Errorf("CSVToOrderedmap() = %x, want %x", repacked, raw)
+		}
+	}
+
+	mixed, err := JSONToOrderedmap([]byte(`{"1":[["alk"]],"2":{"a":[["bob"]]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = OrderedmapToCSV(mixed, nil, ',')
+	if err == nil {
+		t.Errorf("OrderedmapToCSV() error = nil, want mixed depth error")
+	}
+}
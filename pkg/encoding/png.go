@@ -2,28 +2,76 @@ package encoding
 
 import (
 	"bytes"
+	"fmt"
+	"image"
 	"image/color"
 	"image/png"
 
 	"github.com/disintegration/imaging"
 )
 
-func FitPNG(src []byte, width int, height int) ([]byte, error) {
+// Fit modes of ResizePNG.
+const (
+	// FitContain scales images to fit inside the canvas, keeping their aspect ratio.
+	FitContain = "contain"
+	// FitCover scales and crops images to fill the canvas, keeping their aspect ratio.
+	FitCover = "cover"
+	// FitStretch scales images to the canvas size.
+	FitStretch = "stretch"
+	// FitNone keeps the image size, centering it on the canvas.
+	FitNone = "none"
+)
+
+// ResizeOptions configures ResizePNG.
+type ResizeOptions struct {
+	// Width and Height are the canvas size, the image size is kept if either is 0 with FitNone.
+	Width  int
+	Height int
+	Fit    string
+	// Background fills the canvas around the image, transparent if nil.
+	Background color.Color
+}
+
+// ResizePNG resizes a PNG image onto a canvas according to options.
+func ResizePNG(src []byte, options *ResizeOptions) ([]byte, error) {
 	img, err := imaging.Decode(bytes.NewReader(src))
 	if err != nil {
 		return nil, err
 	}
 
-	img = imaging.PasteCenter(
-		imaging.New(width, height, color.Transparent),
-		imaging.Fit(img, width, height, imaging.Lanczos),
-	)
+	width, height := options.Width, options.Height
+	switch options.Fit {
+	case FitContain, "":
+		img = imaging.Fit(img, width, height, imaging.Lanczos)
+	case FitCover:
+		img = imaging.Fill(img, width, height, imaging.Center, imaging.Lanczos)
+	case FitStretch:
+		img = imaging.Resize(img, width, height, imaging.Lanczos)
+	case FitNone:
+		if width == 0 || height == 0 {
+			width, height = img.Bounds().Dx(), img.Bounds().Dy()
+		}
+	default:
+		return nil, fmt.Errorf("ResizePNG: unknown fit mode, fit=%s", options.Fit)
+	}
+
+	var canvas image.Image
+	if options.Background == nil {
+		canvas = imaging.PasteCenter(imaging.New(width, height, color.Transparent), img)
+	} else {
+		canvas = imaging.OverlayCenter(imaging.New(width, height, options.Background), img, 1)
+	}
 
 	var output bytes.Buffer
-	err = imaging.Encode(&output, img, imaging.PNG, imaging.PNGCompressionLevel(png.BestCompression))
+	err = imaging.Encode(&output, canvas, imaging.PNG, imaging.PNGCompressionLevel(png.BestCompression))
 	if err != nil {
 		return nil, err
 	}
 
 	return output.Bytes(), nil
 }
+
+// FitPNG scales a PNG image to fit inside a transparent canvas of width and height.
+func FitPNG(src []byte, width int, height int) ([]byte, error) {
+	return ResizePNG(src, &ResizeOptions{Width: width, Height: height, Fit: FitContain})
+}
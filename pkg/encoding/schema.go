@@ -0,0 +1,103 @@
+package encoding
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// Column types of orderedmap CSV rows.
+const (
+	ColumnString = "string"
+	ColumnNumber = "number"
+	ColumnBool   = "bool"
+)
+
+var numberPattern = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][-+]?[0-9]+)?$`)
+
+// isNumber reports whether s is a valid JSON number literal.
+func isNumber(s string) bool {
+	return numberPattern.MatchString(s)
+}
+
+func isBool(s string) bool {
+	return s == "true" || s == "false"
+}
+
+// ColumnSchema describes a column of orderedmap CSV rows.
+type ColumnSchema struct {
+	Index int    `json:"index"`
+	Name  string `json:"name"`
+	Type  string `json:"type,omitempty"`
+}
+
+// TableSchema describes the columns of an orderedmap table.
+type TableSchema struct {
+	Columns []*ColumnSchema `json:"columns"`
+}
+
+// Validate checks that column indexes and names are unique and names cannot be mistaken for indexes.
+func (schema *TableSchema) Validate() error {
+	indexes := map[int]bool{}
+	names := map[string]bool{}
+	for _, c := range schema.Columns {
+		if c.Index < 0 {
+			return fmt.Errorf("Validate: negative column index, index=%d, name=%s", c.Index, c.Name)
+		}
+		if c.Name == "" {
+			return fmt.Errorf("Validate: empty column name, index=%d", c.Index)
+		}
+		if _, err := strconv.Atoi(c.Name); err == nil {
+			return fmt.Errorf("Validate: numeric column name, index=%d, name=%s", c.Index, c.Name)
+		}
+		if c.Type != "" && c.Type != ColumnString && c.Type != ColumnNumber && c.Type != ColumnBool {
+			return fmt.Errorf("Validate: unknown column type, index=%d, type=%s", c.Index, c.Type)
+		}
+		if indexes[c.Index] {
+			return fmt.Errorf("Validate: duplicate column index, index=%d", c.Index)
+		}
+		if names[c.Name] {
+			return fmt.Errorf("Validate: duplicate column name, name=%s", c.Name)
+		}
+		indexes[c.Index] = true
+		names[c.Name] = true
+	}
+	return nil
+}
+
+// column returns the schema of column i or nil if the column is not described.
+func (schema *TableSchema) column(i int) *ColumnSchema {
+	if schema == nil {
+		return nil
+	}
+	for _, c := range schema.Columns {
+		if c.Index == i {
+			return c
+		}
+	}
+	return nil
+}
+
+// ColumnName returns the name of column i, falling back to its index.
+func (schema *TableSchema) ColumnName(i int) string {
+	if c := schema.column(i); c != nil {
+		return c.Name
+	}
+	return strconv.Itoa(i)
+}
+
+// ColumnIndex returns the index of a column by its name or index string.
+func (schema *TableSchema) ColumnIndex(name string) (int, bool) {
+	if schema != nil {
+		for _, c := range schema.Columns {
+			if c.Name == name {
+				return c.Index, true
+			}
+		}
+	}
+	i, err := strconv.Atoi(name)
+	if err != nil || i < 0 {
+		return 0, false
+	}
+	return i, true
+}
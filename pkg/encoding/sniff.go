@@ -0,0 +1,226 @@
+package encoding
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"unicode/utf8"
+
+	amf "github.com/remyoudompheng/goamf"
+)
+
+// ContentType is the format of a raw asset identified by Sniff.
+type ContentType string
+
+// Content types identified by Sniff.
+const (
+	ContentUnknown    ContentType = "unknown"
+	ContentPNG        ContentType = "png"
+	ContentMaskedPNG  ContentType = "masked-png"
+	ContentOrderedmap ContentType = "orderedmap"
+	ContentAmf3       ContentType = "amf3"
+	ContentCSV        ContentType = "csv"
+	ContentText       ContentType = "text"
+	ContentZip        ContentType = "zip"
+	ContentSWF        ContentType = "swf"
+	ContentATF        ContentType = "atf"
+	ContentOgg        ContentType = "ogg"
+	ContentMP3        ContentType = "mp3"
+	ContentWAV        ContentType = "wav"
+	ContentM4A        ContentType = "m4a"
+	ContentMP4        ContentType = "mp4"
+	ContentWebM       ContentType = "webm"
+	ContentFLV        ContentType = "flv"
+)
+
+// Ext returns the file extension used when exporting decoded content of type t.
+func (t ContentType) Ext() string {
+	switch t {
+	case ContentPNG, ContentMaskedPNG:
+		return ".png"
+	case ContentOrderedmap, ContentAmf3:
+		return ".json"
+	case ContentCSV:
+		return ".csv"
+	case ContentText:
+		return ".txt"
+	case ContentUnknown:
+		return ".bin"
+	default:
+		return "." + string(t)
+	}
+}
+
+// Sniff identifies the content type of raw asset data.
+func Sniff(raw []byte) ContentType {
+	switch {
+	case len(raw) < 4:
+		if len(raw) > 0 && utf8.Valid(raw) {
+			return ContentText
+		}
+		return ContentUnknown
+	case bytes.HasPrefix(raw, []byte("\x89PNG")):
+		return ContentPNG
+	// png header masked as "pnG" by pngParser
+	case raw[0] == 0x89 && bytes.Equal(raw[1:4], []byte("png")):
+		return ContentMaskedPNG
+	case bytes.HasPrefix(raw, []byte("PK\x03\x04")), bytes.HasPrefix(raw, []byte("PK\x05\x06")):
+		return ContentZip
+	case bytes.HasPrefix(raw, []byte("FWS")), bytes.HasPrefix(raw, []byte("CWS")), bytes.HasPrefix(raw, []byte("ZWS")):
+		return ContentSWF
+	case bytes.HasPrefix(raw, []byte("ATF")):
+		return ContentATF
+	case bytes.HasPrefix(raw, []byte("OggS")):
+		return ContentOgg
+	case bytes.HasPrefix(raw, []byte("ID3")), isMPEGAudio(raw):
+		return ContentMP3
+	case bytes.HasPrefix(raw, []byte("RIFF")) && len(raw) >= 12 && bytes.Equal(raw[8:12], []byte("WAVE")):
+		return ContentWAV
+	case len(raw) >= 12 && bytes.Equal(raw[4:8], []byte("ftyp")):
+		if bytes.HasPrefix(raw[8:12], []byte("M4A")) {
+			return ContentM4A
+		}
+		return ContentMP4
+	case bytes.HasPrefix(raw, []byte{0x1a, 0x45, 0xdf, 0xa3}):
+		return ContentWebM
+	case bytes.HasPrefix(raw, []byte("FLV")):
+		return ContentFLV
+	}
+
+	if _, err := readOrderedMap(raw, &OrderedmapOptions{}); err == nil {
+		return ContentOrderedmap
+	}
+	if isAmf3(raw) {
+		return ContentAmf3
+	}
+	if utf8.Valid(raw) && !bytes.ContainsRune(raw, 0) {
+		if isCSV(raw) {
+			return ContentCSV
+		}
+		return ContentText
+	}
+	// compressed text
+	if text, err := DecodeText(raw); err == nil && !bytes.ContainsRune(text, 0) {
+		return ContentText
+	}
+
+	return ContentUnknown
+}
+
+// bitrates in kbps of MPEG audio frame headers by MPEG-1 layer I, II, III and MPEG-2/2.5 layer I, II and III
+var mpegBitrates = [5][15]int{
+	{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+	{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+	{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+	{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+}
+
+// sample rates in Hz of MPEG audio frame headers by MPEG-1, 2 and 2.5
+var mpegSampleRates = [3][3]int{
+	{44100, 48000, 32000},
+	{22050, 24000, 16000},
+	{11025, 12000, 8000},
+}
+
+// mpegFrameLength returns the length of the MPEG audio frame starting at raw, or 0 if raw does not start with a valid frame header.
+func mpegFrameLength(raw []byte) int {
+	if len(raw) < 4 || raw[0] != 0xff || raw[1]&0xe0 != 0xe0 {
+		return 0
+	}
+
+	version := 0
+	switch (raw[1] >> 3) & 0x03 {
+	case 0x03:
+		version = 0
+	case 0x02:
+		version = 1
+	case 0x00:
+		version = 2
+	default:
+		return 0
+	}
+	layer := 4 - int((raw[1]>>1)&0x03)
+	bitrateIndex := int(raw[2] >> 4)
+	sampleRateIndex := int((raw[2] >> 2) & 0x03)
+	// reserved layer, free or bad bitrate, and reserved sample rate
+	if layer == 4 || bitrateIndex == 0 || bitrateIndex == 15 || sampleRateIndex == 3 {
+		return 0
+	}
+
+	table := layer - 1
+	if version > 0 {
+		table = min(layer+2, 4)
+	}
+	bitrate := mpegBitrates[table][bitrateIndex] * 1000
+	sampleRate := mpegSampleRates[version][sampleRateIndex]
+	padding := int((raw[2] >> 1) & 0x01)
+	switch {
+	case layer == 1:
+		return (12*bitrate/sampleRate + padding) * 4
+	case layer == 3 && version > 0:
+		return 72*bitrate/sampleRate + padding
+	default:
+		return 144*bitrate/sampleRate + padding
+	}
+}
+
+// isMPEGAudio reports whether raw starts with a valid MPEG audio frame header, followed by another one if raw is longer than the frame.
+func isMPEGAudio(raw []byte) bool {
+	n := mpegFrameLength(raw)
+	if n == 0 {
+		return false
+	}
+	if len(raw) < n+4 {
+		return true
+	}
+	return mpegFrameLength(raw[n:]) > 0
+}
+
+func isAmf3(raw []byte) bool {
+	data, err := inflate(raw)
+	if err != nil || len(data) == 0 {
+		return false
+	}
+
+	// top level values are objects or arrays
+	if data[0] != 0x09 && data[0] != 0x0a {
+		return false
+	}
+
+	d := amf.NewDecoder()
+	_, err = d.DecodeAmf3(bytes.NewReader(data))
+	return err == nil
+}
+
+func isCSV(raw []byte) bool {
+	if !bytes.ContainsRune(raw, '\n') {
+		return false
+	}
+
+	r := csv.NewReader(bytes.NewReader(raw))
+	rec, err := r.ReadAll()
+	return err == nil && len(rec) > 0 && len(rec[0]) > 1
+}
+
+// DecodeContent converts raw asset data of type t into a readable format.
+// Content types without a readable representation are returned as is.
+func DecodeContent(raw []byte, t ContentType, indent int) ([]byte, error) {
+	switch t {
+	case ContentMaskedPNG:
+		if len(raw) < 4 {
+			return nil, fmt.Errorf("DecodeContent: masked png too short, size=%d", len(raw))
+		}
+		output := bytes.Clone(raw)
+		copy(output[1:4], "PNG")
+		return output, nil
+	case ContentOrderedmap:
+		return OrderedmapToJSON(raw, indent, false)
+	case ContentAmf3:
+		return Amf3ToJSON(raw, indent)
+	case ContentText:
+		return DecodeText(raw)
+	default:
+		return raw, nil
+	}
+}
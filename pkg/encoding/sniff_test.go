@@ -0,0 +1,67 @@
+package encoding
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSniff(t *testing.T) {
+	orderedmap, err := JSONToOrderedmap([]byte(`{"1":[["a","b"]],"2":[["c","d"]]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	amf3, err := JSONToAmf3([]byte(`{"a":[1,2,3]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// MPEG-1 layer III, 128 kbps, 44.1 kHz frames of 417 bytes
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xff, 0xfb, 0x90, 0x00})
+	mp3 := append(bytes.Clone(frame), frame...)
+	notMP3 := append(bytes.Clone(frame), make([]byte, 8)...)
+
+	tests := []struct {
+		name string
+		raw  []byte
+		want ContentType
+	}{
+		{"png", []byte("\x89PNG\r\n\x1a\n"), ContentPNG},
+		{"masked png", []byte("\x89png\r\n\x1a\n"), ContentMaskedPNG},
+		{"zip", []byte("PK\x03\x04\x14\x00"), ContentZip},
+		{"ogg", []byte("OggS\x00\x02"), ContentOgg},
+		{"wav", []byte("RIFF\x24\x00\x00\x00WAVEfmt "), ContentWAV},
+		{"mp4", []byte("\x00\x00\x00\x18ftypmp42"), ContentMP4},
+		{"m4a", []byte("\x00\x00\x00\x18ftypM4A "), ContentM4A},
+		{"mp3", mp3, ContentMP3},
+		{"mp3 id3", []byte("ID3\x04\x00"), ContentMP3},
+		{"mp3 single frame", frame, ContentMP3},
+		{"mp3 without second frame", notMP3, ContentUnknown},
+		{"mpeg sync reserved bits", []byte{0xff, 0xff, 0xff, 0xff, 0x00}, ContentUnknown},
+		{"orderedmap", orderedmap, ContentOrderedmap},
+		{"amf3", amf3, ContentAmf3},
+		{"csv", []byte("a,b,c\n1,2,3\n"), ContentCSV},
+		{"text", []byte("package flatomo.generated;\n"), ContentText},
+		{"unknown", []byte{0x00, 0x01, 0x02, 0x03, 0x04}, ContentUnknown},
+	}
+
+	for _, tt := range tests {
+		if got := Sniff(tt.raw); got != tt.want {
+			t.Errorf("Sniff(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeContentMaskedPNG(t *testing.T) {
+	raw := []byte("\x89png\r\n\x1a\n")
+	got, err := DecodeContent(raw, ContentMaskedPNG, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "\x89PNG\r\n\x1a\n" {
+		t.Errorf("DecodeContent() = %q, want unmasked png header", got)
+	}
+	if string(raw) != "\x89png\r\n\x1a\n" {
+		t.Errorf("DecodeContent() modified input, raw = %q", raw)
+	}
+}
@@ -0,0 +1,245 @@
+package encoding
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	omap "github.com/iancoleman/orderedmap"
+)
+
+// OrderedmapRow is a CSV row of WF orderedmap with the keys of its nested maps.
+type OrderedmapRow struct {
+	Keys []string
+	// Index is the position of the row in its CSV.
+	Index int
+	Cells []string
+}
+
+// OrderedmapTable is WF orderedmap flattened into CSV rows.
+type OrderedmapTable struct {
+	// Depth is the maximum number of nested map keys of all rows.
+	Depth int
+	// Width is the maximum number of cells of all rows.
+	Width int
+	Rows  []*OrderedmapRow
+}
+
+func (table *OrderedmapTable) flatten(node *orderedmapNode, keys []string) {
+	if node.leaf {
+		table.Depth = max(table.Depth, len(keys))
+		for i, row := range node.records {
+			table.Width = max(table.Width, len(row))
+			table.Rows = append(table.Rows, &OrderedmapRow{Keys: keys, Index: i, Cells: row})
+		}
+		return
+	}
+
+	for i, child := range node.children {
+		table.flatten(child, append(keys[:len(keys):len(keys)], node.keys[i]))
+	}
+}
+
+// ColumnTypes returns the type of each column, enforced by schema or inferred from values.
+func (table *OrderedmapTable) ColumnTypes(schema *TableSchema) []string {
+	types := inferColumnTypes(func(f func([][]string)) {
+		for _, row := range table.Rows {
+			f([][]string{row.Cells})
+		}
+	}, schema)
+
+	for len(types) < table.Width {
+		types = append(types, ColumnString)
+	}
+	return types
+}
+
+// OrderedmapToTable flattens WF orderedmap into CSV rows with their nested map keys.
+func OrderedmapToTable(raw []byte) (*OrderedmapTable, error) {
+	node, err := decodeOrderedmap(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	table := &OrderedmapTable{}
+	table.flatten(node, nil)
+	return table, nil
+}
+
+// ErrUnsupportedCSV is wrapped by errors of orderedmaps which cannot be written as a single CSV,
+// i.e. empty nested maps or nested maps of different depths.
+var ErrUnsupportedCSV = errors.New("unsupported structure for csv")
+
+// keyColumnPrefix prefixes header names of nested map key columns in orderedmap CSVs.
+const keyColumnPrefix = "_key"
+
+// depth returns the number of nested map keys of all leaves, or -1 for empty maps.
+func (node *orderedmapNode) depth() (int, error) {
+	if node.leaf {
+		return 0, nil
+	}
+
+	d := -1
+	for i, child := range node.children {
+		cd, err := child.depth()
+		if err != nil {
+			return 0, err
+		}
+		if cd < 0 {
+			return 0, fmt.Errorf("depth: empty nested map, key=%s", node.keys[i])
+		}
+		if d >= 0 && cd+1 != d {
+			return 0, fmt.Errorf("depth: nested maps with different depths, key=%s", node.keys[i])
+		}
+		d = cd + 1
+	}
+	return d, nil
+}
+
+func (node *orderedmapNode) writeCSV(w *csv.Writer, keys []string) error {
+	if node.leaf {
+		// rows with keys only are empty CSVs
+		if len(node.records) == 0 && len(keys) > 0 {
+			return w.Write(keys)
+		}
+		for _, row := range node.records {
+			err := w.Write(append(keys[:len(keys):len(keys)], row...))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for i, child := range node.children {
+		err := child.writeCSV(w, append(keys[:len(keys):len(keys)], node.keys[i]))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OrderedmapToCSV converts WF orderedmap into a single CSV with nested map keys as leading columns.
+// The header row names key columns _key1, _key2, ... followed by column names from schema.
+// comma is the field delimiter, e.g. ',' for CSV or '\t' for TSV.
+func OrderedmapToCSV(raw []byte, schema *TableSchema, comma rune) ([]byte, error) {
+	node, err := decodeOrderedmap(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	depth, err := node.depth()
+	if err != nil {
+		return nil, fmt.Errorf("OrderedmapToCSV: %w, %w", ErrUnsupportedCSV, err)
+	}
+	width := 0
+	node.walkRecords(func(rec [][]string) {
+		for _, row := range rec {
+			width = max(width, len(row))
+		}
+	})
+
+	var header []string
+	for i := 1; i <= depth; i++ {
+		header = append(header, keyColumnPrefix+strconv.Itoa(i))
+	}
+	for i := 0; i < width; i++ {
+		header = append(header, schema.ColumnName(i))
+	}
+
+	var output bytes.Buffer
+	w := csv.NewWriter(&output)
+	w.Comma = comma
+	if len(header) > 0 {
+		err = w.Write(header)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = node.writeCSV(w, nil)
+	if err != nil {
+		return nil, err
+	}
+	w.Flush()
+
+	return output.Bytes(), w.Error()
+}
+
+// csvNode is a nested map of CSV rows read from an orderedmap CSV.
+type csvNode struct {
+	keys     []string
+	children map[string]*csvNode
+	rows     [][]string
+}
+
+func (node *csvNode) child(key string) *csvNode {
+	if node.children == nil {
+		node.children = map[string]*csvNode{}
+	}
+	c, ok := node.children[key]
+	if !ok {
+		c = &csvNode{}
+		node.keys = append(node.keys, key)
+		node.children[key] = c
+	}
+	return c
+}
+
+func (node *csvNode) MarshalJSON() ([]byte, error) {
+	if node.children == nil {
+		if node.rows == nil {
+			return []byte("[]"), nil
+		}
+		return jsonMarshalNoEscape(node.rows)
+	}
+
+	o := omap.New()
+	o.SetEscapeHTML(false)
+	for _, k := range node.keys {
+		o.Set(k, node.children[k])
+	}
+	return jsonMarshalNoEscape(o)
+}
+
+// CSVToOrderedmap converts a CSV written by OrderedmapToCSV back to WF orderedmap.
+func CSVToOrderedmap(data []byte, comma rune) ([]byte, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comma = comma
+	r.FieldsPerRecord = -1
+	rec, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	root := &csvNode{}
+	if len(rec) > 0 {
+		depth := 0
+		for depth < len(rec[0]) && strings.HasPrefix(rec[0][depth], keyColumnPrefix) {
+			depth++
+		}
+
+		for i, row := range rec[1:] {
+			if len(row) < depth {
+				return nil, fmt.Errorf("CSVToOrderedmap: missing key columns, row=%d, depth=%d", i+1, depth)
+			}
+
+			node := root
+			for _, k := range row[:depth] {
+				node = node.child(k)
+			}
+			if len(row) > depth {
+				node.rows = append(node.rows, row[depth:])
+			}
+		}
+	}
+
+	js, err := jsonMarshalNoEscape(root)
+	if err != nil {
+		return nil, err
+	}
+	return writeOrderedmap(js, &OrderedmapOptions{})
+}
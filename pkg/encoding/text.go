@@ -0,0 +1,76 @@
+package encoding
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+var (
+	bomUTF8    = []byte{0xef, 0xbb, 0xbf}
+	bomUTF16LE = []byte{0xff, 0xfe}
+	bomUTF16BE = []byte{0xfe, 0xff}
+)
+
+// decodeUnicode converts text with an optional UTF-8 byte order mark, or UTF-16 text with a byte order mark, into UTF-8.
+func decodeUnicode(data []byte) ([]byte, bool) {
+	var order binary.ByteOrder
+	switch {
+	case bytes.HasPrefix(data, bomUTF8):
+		data = data[len(bomUTF8):]
+	case bytes.HasPrefix(data, bomUTF16LE):
+		order = binary.LittleEndian
+	case bytes.HasPrefix(data, bomUTF16BE):
+		order = binary.BigEndian
+	}
+
+	if order == nil {
+		return data, utf8.Valid(data)
+	}
+	if len(data)%2 != 0 {
+		return nil, false
+	}
+	units := make([]uint16, 0, len(data)/2-1)
+	for i := 2; i < len(data); i += 2 {
+		units = append(units, order.Uint16(data[i:]))
+	}
+	// unpaired surrogates are not text
+	for i := 0; i < len(units); i++ {
+		if utf16.IsSurrogate(rune(units[i])) {
+			if i+1 >= len(units) || utf16.DecodeRune(rune(units[i]), rune(units[i+1])) == utf8.RuneError {
+				return nil, false
+			}
+			i++
+		}
+	}
+	return []byte(string(utf16.Decode(units))), true
+}
+
+// DecodeText unwraps text assets which can be stored as zlib-compressed, deflated or plain text.
+// Text is UTF-8, optionally with a byte order mark, or UTF-16 with a byte order mark, and is returned as UTF-8 without byte order mark.
+func DecodeText(raw []byte) ([]byte, error) {
+	// zlib-compressed text
+	data, err := readZlib(raw)
+	if err == nil {
+		if text, ok := decodeUnicode(data); ok {
+			return text, nil
+		}
+	}
+
+	// deflated text
+	data, err = inflate(raw)
+	if err == nil && len(data) > 0 {
+		if text, ok := decodeUnicode(data); ok {
+			return text, nil
+		}
+	}
+
+	// plain text
+	if text, ok := decodeUnicode(raw); ok {
+		return text, nil
+	}
+
+	return nil, fmt.Errorf("DecodeText: unknown text encoding, header=%x", raw[0:min(len(raw), 4)])
+}
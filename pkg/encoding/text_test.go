@@ -0,0 +1,52 @@
+package encoding
+
+import (
+	"bytes"
+	"compress/flate"
+	"testing"
+)
+
+func TestDecodeText(t *testing.T) {
+	deflated := func(data []byte) []byte {
+		var buf bytes.Buffer
+		w, err := flate.NewWriter(&buf, flate.BestCompression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(data)
+		w.Close()
+		return buf.Bytes()
+	}
+	zlibbed, err := writeZlib([]byte("package a;"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		raw  []byte
+		want string
+		err  bool
+	}{
+		{"plain", []byte("package a;"), "package a;", false},
+		{"utf-8 bom", []byte("\xef\xbb\xbfpackage a;"), "package a;", false},
+		{"utf-16le bom", []byte("\xff\xfea\x00\x42\x30"), "aあ", false},
+		{"utf-16be bom", []byte("\xfe\xff\x00a\x30\x42"), "aあ", false},
+		{"utf-16 surrogate pair", []byte("\xff\xfe\x3d\xd8\x00\xde"), "😀", false},
+		{"zlib", zlibbed, "package a;", false},
+		{"deflated utf-8 bom", deflated([]byte("\xef\xbb\xbfpackage a;")), "package a;", false},
+		{"odd utf-16", []byte("\xff\xfea\x00\x42"), "", true},
+		{"unpaired surrogate", []byte("\xff\xfe\x3d\xd8a\x00"), "", true},
+		{"binary", []byte{0x00, 0xff, 0x80, 0x81}, "", true},
+	}
+	for _, tt := range tests {
+		got, err := DecodeText(tt.raw)
+		if (err != nil) != tt.err {
+			t.Errorf("DecodeText(%s) error = %v, want error %t", tt.name, err, tt.err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("DecodeText(%s) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
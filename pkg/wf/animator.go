@@ -0,0 +1,475 @@
+package wf
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"io/fs"
+	"log"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/blead/wfax/pkg/concurrency"
+	"github.com/blead/wfax/pkg/encoding"
+	"github.com/disintegration/imaging"
+)
+
+// Output formats of animations.
+const (
+	AnimationGIF  = "gif"
+	AnimationAPNG = "apng"
+)
+
+const (
+	pixelartPattern = "character/*/pixelart/*"
+	// animations are written as .apng, not .png, so that they are not packed back as assets
+	apngExt = ".apng"
+)
+
+// pixelartFramePattern splits numbered sprite names, e.g. walk_03, into an animation name and an index.
+var pixelartFramePattern = regexp.MustCompile(`^(.*?)[_-]?(\d+)$`)
+
+// AnimatorConfig is the configuration for the animator.
+// Sources are read like ExtractorConfig sources, without SrcPaths.
+// Paths are asset paths of pixel art sheets, every character/*/pixelart/* path of the default path list if empty.
+// Scale and Smooth scale frames like SpriterConfig.Scale, with nearest-neighbor unless Smooth is set.
+// FrameRate is the number of timeline ticks per second.
+// If DestPath ends with .zip, .tar.gz or .tgz, animations are written into a single archive.
+type AnimatorConfig struct {
+	SrcPath      string
+	SrcFS        fs.FS
+	Archives     []string
+	DestPath     string
+	Paths        []string
+	ManifestPath string
+	Formats      []string
+	Scale        float32
+	Smooth       bool
+	FrameRate    int
+	Concurrency  int
+}
+
+// DefaultAnimatorConfig generates a default configuration.
+func DefaultAnimatorConfig() *AnimatorConfig {
+	return &AnimatorConfig{
+		SrcPath:      "",
+		SrcFS:        nil,
+		Archives:     nil,
+		DestPath:     "",
+		Paths:        nil,
+		ManifestPath: "",
+		Formats:      []string{AnimationGIF, AnimationAPNG},
+		Scale:        4,
+		Smooth:       false,
+		FrameRate:    30,
+		Concurrency:  5,
+	}
+}
+
+// Animator renders pixel art sheets into animations.
+type Animator struct {
+	config *AnimatorConfig
+	sink   sink
+	// manifest is nil if no manifest is written
+	manifest *outputManifest
+}
+
+// NewAnimator creates a new animator with the supplied configuration.
+// If the configuration is nil, use DefaultAnimatorConfig.
+func NewAnimator(config *AnimatorConfig) (*Animator, error) {
+	def := DefaultAnimatorConfig()
+	if def == nil {
+		return nil, fmt.Errorf("NewAnimator: default configuration is nil")
+	}
+
+	if config == nil {
+		config = def
+	}
+
+	var err error
+	config.SrcPath, config.SrcFS, err = sourceConfig(config.SrcPath, nil, config.SrcFS, config.Archives)
+	if err != nil {
+		return nil, err
+	}
+	config.DestPath, err = workingPath(config.DestPath)
+	if err != nil {
+		return nil, err
+	}
+	if config.ManifestPath != "" {
+		config.ManifestPath = filepath.Clean(config.ManifestPath)
+	}
+
+	if len(config.Formats) == 0 {
+		config.Formats = def.Formats
+	}
+	for _, f := range config.Formats {
+		if f != AnimationGIF && f != AnimationAPNG {
+			return nil, fmt.Errorf("NewAnimator: unknown format, format=%s", f)
+		}
+	}
+
+	if config.Scale == 0 {
+		config.Scale = def.Scale
+	}
+	if config.Scale < 0 {
+		return nil, fmt.Errorf("NewAnimator: negative scale, scale=%f", config.Scale)
+	}
+
+	if config.FrameRate == 0 {
+		config.FrameRate = def.FrameRate
+	}
+	if config.FrameRate < 0 {
+		return nil, fmt.Errorf("NewAnimator: negative frame rate, frameRate=%d", config.FrameRate)
+	}
+
+	if config.Concurrency == 0 {
+		config.Concurrency = def.Concurrency
+	}
+
+	return &Animator{config: config}, nil
+}
+
+// pixelartFrame places an atlas sprite on the animation canvas.
+type pixelartFrame struct {
+	sprite *spriteParams
+	x      int
+	y      int
+}
+
+type pixelartKeyframe struct {
+	frame *pixelartFrame
+	// duration is the number of timeline ticks
+	duration int
+}
+
+type pixelartAnimation struct {
+	name      string
+	keyframes []*pixelartKeyframe
+}
+
+// pixelartFrameData is an entry of .frame data, placing the atlas sprite Sprite at X and Y as the frame Name.
+type pixelartFrameData struct {
+	Name   string `json:"name"`
+	Sprite string `json:"sprite"`
+	X      int    `json:"x"`
+	Y      int    `json:"y"`
+}
+
+// pixelartKeyframeData is a keyframe of .timeline data, showing the frame Frame for Duration ticks.
+type pixelartKeyframeData struct {
+	Frame    string `json:"frame"`
+	Duration int    `json:"duration"`
+}
+
+// pixelartTimelineData is an animation of .timeline data.
+type pixelartTimelineData struct {
+	Name   string                  `json:"name"`
+	Frames []*pixelartKeyframeData `json:"frames"`
+}
+
+// parsePixelartFrames reads the list of frames of .frame data.
+// Atlas sprites are also frames of their own name at the origin, which is all frames if data is nil.
+func parsePixelartFrames(data []byte, sprites map[string]*spriteParams) (map[string]*pixelartFrame, error) {
+	frames := make(map[string]*pixelartFrame)
+	for name, sprite := range sprites {
+		frames[name] = &pixelartFrame{sprite: sprite}
+	}
+	if data == nil {
+		return frames, nil
+	}
+
+	var entries []*pixelartFrameData
+	err := decodeStrict(data, &entries)
+	if err != nil {
+		return nil, fmt.Errorf("parsePixelartFrames: unable to parse frames, %w", err)
+	}
+	for idx, e := range entries {
+		if e == nil || e.Name == "" {
+			return nil, fmt.Errorf("parsePixelartFrames: empty frame name, idx=%d", idx)
+		}
+		sprite, ok := sprites[e.Sprite]
+		if !ok {
+			return nil, fmt.Errorf("parsePixelartFrames: unknown sprite, idx=%d, name=%s, sprite=%s", idx, e.Name, e.Sprite)
+		}
+		frames[e.Name] = &pixelartFrame{sprite: sprite, x: e.X, y: e.Y}
+	}
+	return frames, nil
+}
+
+// parsePixelartTimeline reads the list of animations of .timeline data.
+func parsePixelartTimeline(data []byte, frames map[string]*pixelartFrame) ([]*pixelartAnimation, error) {
+	var entries []*pixelartTimelineData
+	err := decodeStrict(data, &entries)
+	if err != nil {
+		return nil, fmt.Errorf("parsePixelartTimeline: unable to parse timeline, %w", err)
+	}
+
+	animations := make([]*pixelartAnimation, 0, len(entries))
+	names := make(map[string]bool)
+	for idx, e := range entries {
+		if e == nil || e.Name == "" {
+			return nil, fmt.Errorf("parsePixelartTimeline: empty animation name, idx=%d", idx)
+		}
+		if names[e.Name] {
+			return nil, fmt.Errorf("parsePixelartTimeline: duplicate animation name, name=%s", e.Name)
+		}
+		names[e.Name] = true
+
+		animation := &pixelartAnimation{name: e.Name}
+		for i, k := range e.Frames {
+			if k == nil {
+				return nil, fmt.Errorf("parsePixelartTimeline: empty keyframe, name=%s, idx=%d", e.Name, i)
+			}
+			frame, ok := frames[k.Frame]
+			if !ok {
+				return nil, fmt.Errorf("parsePixelartTimeline: unknown frame, name=%s, idx=%d, frame=%s", e.Name, i, k.Frame)
+			}
+			if k.Duration <= 0 {
+				return nil, fmt.Errorf("parsePixelartTimeline: non-positive duration, name=%s, idx=%d, duration=%d", e.Name, i, k.Duration)
+			}
+			animation.keyframes = append(animation.keyframes, &pixelartKeyframe{frame: frame, duration: k.Duration})
+		}
+		if len(animation.keyframes) == 0 {
+			return nil, fmt.Errorf("parsePixelartTimeline: empty animation, name=%s", e.Name)
+		}
+		animations = append(animations, animation)
+	}
+	return animations, nil
+}
+
+// groupPixelartFrames groups numbered sprites into animations of one tick per frame, for sheets without timelines.
+func groupPixelartFrames(sprites map[string]*spriteParams) []*pixelartAnimation {
+	type indexed struct {
+		index int
+		name  string
+	}
+	groups := make(map[string][]indexed)
+	for name := range sprites {
+		base := path.Base(name)
+		m := pixelartFramePattern.FindStringSubmatch(base)
+		if m == nil || m[1] == "" {
+			continue
+		}
+		index, err := strconv.Atoi(m[2])
+		if err != nil {
+			continue
+		}
+		group := path.Join(path.Dir(name), m[1])
+		groups[group] = append(groups[group], indexed{index: index, name: name})
+	}
+
+	var animations []*pixelartAnimation
+	for group, names := range groups {
+		sort.Slice(names, func(i, j int) bool { return names[i].index < names[j].index })
+		animation := &pixelartAnimation{name: strings.ReplaceAll(strings.TrimPrefix(group, "./"), "/", "_")}
+		for _, n := range names {
+			animation.keyframes = append(animation.keyframes, &pixelartKeyframe{frame: &pixelartFrame{sprite: sprites[n.name]}, duration: 1})
+		}
+		animations = append(animations, animation)
+	}
+	sort.Slice(animations, func(i, j int) bool { return animations[i].name < animations[j].name })
+	return animations
+}
+
+// renderAnimation composes keyframes on a canvas covering all of them.
+func (animator *Animator) renderAnimation(sheet image.Image, animation *pixelartAnimation) []*encoding.AnimationFrame {
+	var bounds image.Rectangle
+	images := make([]image.Image, len(animation.keyframes))
+	for i, k := range animation.keyframes {
+		images[i] = cropSprite(sheet, k.frame.sprite)
+		r := images[i].Bounds().Sub(images[i].Bounds().Min).Add(image.Pt(k.frame.x, k.frame.y))
+		if i == 0 {
+			bounds = r
+		} else {
+			bounds = bounds.Union(r)
+		}
+	}
+
+	filter := imaging.NearestNeighbor
+	if animator.config.Smooth {
+		filter = imaging.Lanczos
+	}
+	width := int(float32(bounds.Dx()) * animator.config.Scale)
+	height := int(float32(bounds.Dy()) * animator.config.Scale)
+
+	output := make([]*encoding.AnimationFrame, len(animation.keyframes))
+	for i, k := range animation.keyframes {
+		canvas := imaging.New(bounds.Dx(), bounds.Dy(), color.Transparent)
+		canvas = imaging.Paste(canvas, images[i], image.Pt(k.frame.x, k.frame.y).Sub(bounds.Min))
+		output[i] = &encoding.AnimationFrame{
+			Image: imaging.Resize(canvas, width, height, filter),
+			Delay: k.duration * 1000 / animator.config.FrameRate,
+		}
+	}
+	return output
+}
+
+// animate writes animations of the pixel art sheet at p.
+func (animator *Animator) animate(p string) error {
+	config := &ExtractorConfig{SrcPath: animator.config.SrcPath, SrcFS: animator.config.SrcFS}
+	sheetPNG, src, err := readAsset(p, &pngParser{}, config, false)
+	if err != nil {
+		return err
+	}
+	atlasJSON, _, err := readAsset(p, &amf3Parser{ext: ".atlas"}, config, false)
+	if err != nil {
+		return err
+	}
+	frameJSON, _, err := readAsset(p, &amf3Parser{ext: ".frame"}, config, true)
+	if err != nil {
+		return err
+	}
+	timelineJSON, _, err := readAsset(p, &amf3Parser{ext: ".timeline"}, config, true)
+	if err != nil {
+		return err
+	}
+
+	sheet, err := imaging.Decode(bytes.NewReader(sheetPNG))
+	if err != nil {
+		return fmt.Errorf("animate: sheet decode error, path=%s, %w", p, err)
+	}
+	sprites, err := parseAtlasNames(atlasJSON)
+	if err != nil {
+		return fmt.Errorf("animate: atlas error, path=%s, %w", p, err)
+	}
+	frames, err := parsePixelartFrames(frameJSON, sprites)
+	if err != nil {
+		return fmt.Errorf("animate: frame error, path=%s, %w", p, err)
+	}
+	// numbered sprites are grouped only for sheets without timelines
+	var animations []*pixelartAnimation
+	if timelineJSON == nil {
+		animations = groupPixelartFrames(sprites)
+	} else {
+		animations, err = parsePixelartTimeline(timelineJSON, frames)
+		if err != nil {
+			return fmt.Errorf("animate: timeline error, path=%s, %w", p, err)
+		}
+	}
+	if len(animations) == 0 {
+		log.Printf("[WARN] No animations found, path=%s\n", p)
+		return nil
+	}
+
+	for _, animation := range animations {
+		rendered := animator.renderAnimation(sheet, animation)
+		for _, format := range animator.config.Formats {
+			var data []byte
+			dest := path.Join(outputAssetsDir, path.Dir(p), "animation", animation.name)
+			switch format {
+			case AnimationGIF:
+				data, err = encoding.EncodeGIF(rendered)
+				dest += ".gif"
+			case AnimationAPNG:
+				data, err = encoding.EncodeAPNG(rendered)
+				dest += apngExt
+			}
+			if err != nil {
+				return fmt.Errorf("animate: encode error, path=%s, dest=%s, %w", p, dest, err)
+			}
+
+			err = animator.sink.write(dest, data)
+			if err != nil {
+				return fmt.Errorf("animate: dest write error, dest=%s, %w", dest, err)
+			}
+			if animator.manifest != nil {
+				entry, err := newManifestEntry(dest, p, "animate", src, data)
+				if err != nil {
+					return err
+				}
+				animator.manifest.add(entry)
+			}
+		}
+	}
+	return nil
+}
+
+// pixelartPaths returns the configured paths, or pixel art paths of the default path list.
+func (animator *Animator) pixelartPaths() ([]string, bool, error) {
+	if len(animator.config.Paths) > 0 {
+		return animator.config.Paths, false, nil
+	}
+
+	patterns, err := compileFilters([]string{pixelartPattern})
+	if err != nil {
+		return nil, false, err
+	}
+	var output []string
+	for _, p := range defaultPaths() {
+		if matchAny(patterns, p) {
+			output = append(output, p)
+		}
+	}
+	return output, true, nil
+}
+
+// Animate renders animations of pixel art sheets as GIF and APNG.
+func (animator *Animator) Animate() error {
+	log.Println("[INFO] Rendering animations")
+
+	paths, defaults, err := animator.pixelartPaths()
+	if err != nil {
+		return err
+	}
+
+	var items []*concurrency.Item[string, bool]
+	for _, p := range paths {
+		// default paths are skipped if they are not in the dump
+		if defaults {
+			src, err := (&pngParser{}).getSrc(p, &ExtractorConfig{})
+			if err != nil {
+				return err
+			}
+			config := &ExtractorConfig{SrcPath: animator.config.SrcPath, SrcFS: animator.config.SrcFS}
+			if _, err := fs.Stat(config.srcFS(), src); err != nil {
+				continue
+			}
+		}
+		items = append(items, &concurrency.Item[string, bool]{Data: p})
+	}
+
+	animator.sink, err = newSink(animator.config.DestPath)
+	if err != nil {
+		return err
+	}
+	if animator.config.ManifestPath != "" {
+		animator.manifest = newOutputManifest()
+	}
+
+	err = concurrency.Dispatcher(
+		func(i *concurrency.Item[string, bool]) ([]*concurrency.Item[string, bool], error) {
+			var output []*concurrency.Item[string, bool]
+			if !i.Output {
+				output = append(output, i)
+			}
+			return output, nil
+		},
+		func(i *concurrency.Item[string, bool]) (bool, error) {
+			return true, animator.animate(i.Data)
+		},
+		items,
+		animator.config.Concurrency,
+	)
+	if err != nil {
+		animator.sink.discard()
+		return err
+	}
+	err = animator.sink.close()
+	if err != nil {
+		return err
+	}
+
+	if animator.manifest != nil {
+		destDir := animator.config.DestPath
+		if archiveFormat(destDir) != "" {
+			destDir = ""
+		}
+		return animator.manifest.write(animator.config.ManifestPath, destDir, 0)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package wf
+
+import (
+	"image"
+	"testing"
+)
+
+func TestPixelartAnimations(t *testing.T) {
+	sprites, err := parseAtlasNames([]byte(`[{"n":"idle_0","x":0,"y":0,"w":2,"h":2},{"n":"idle_1","x":2,"y":0,"w":2,"h":3},{"n":"walk_1","x":0,"y":0,"w":2,"h":2},{"n":"walk_0","x":2,"y":0,"w":2,"h":3}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// without timelines, numbered sprites are grouped
+	grouped := groupPixelartFrames(sprites)
+	if len(grouped) != 2 || grouped[1].name != "walk" || grouped[1].keyframes[0].frame.sprite.name != "walk_0" {
+		t.Fatalf("groupPixelartFrames() = %+v", grouped)
+	}
+
+	frames, err := parsePixelartFrames([]byte(`[{"name":"a","sprite":"idle_0","x":-1,"y":0},{"name":"b","sprite":"idle_1","x":1,"y":1}]`), sprites)
+	if err != nil {
+		t.Fatal(err)
+	}
+	animations, err := parsePixelartTimeline([]byte(`[{"name":"attack","frames":[{"frame":"a","duration":3},{"frame":"b","duration":1},{"frame":"walk_0","duration":2}]}]`), frames)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(animations) != 1 || animations[0].name != "attack" || animations[0].keyframes[0].duration != 3 || animations[0].keyframes[2].frame.sprite.name != "walk_0" {
+		t.Fatalf("parsePixelartTimeline() = %+v", animations)
+	}
+
+	animator, err := NewAnimator(&AnimatorConfig{SrcPath: t.TempDir(), DestPath: t.TempDir(), Scale: 2, FrameRate: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rendered := animator.renderAnimation(image.NewNRGBA(image.Rect(0, 0, 4, 3)), animations[0])
+	// canvas covers x -1..3 and y 0..4
+	if size := rendered[0].Image.Bounds().Size(); size != image.Pt(8, 8) || rendered[0].Delay != 300 {
+		t.Errorf("renderAnimation() size=%v, delay=%d", size, rendered[0].Delay)
+	}
+}
+
+func TestPixelartInvalid(t *testing.T) {
+	sprites, err := parseAtlasNames([]byte(`[{"n":"idle_0","x":0,"y":0,"w":2,"h":2}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames, err := parsePixelartFrames(nil, sprites)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, data := range map[string]string{
+		"frames":   `[{"name":"a","sprite":"missing"}]`,
+		"unknown":  `[{"name":"a","sprite":"idle_0","scale":2}]`,
+		"notArray": `{"a":{"sprite":"idle_0"}}`,
+	} {
+		if _, err := parsePixelartFrames([]byte(data), sprites); err == nil {
+			t.Errorf("parsePixelartFrames(%s) error = nil", name)
+		}
+	}
+	for name, data := range map[string]string{
+		"frame":     `[{"name":"idle","frames":[{"frame":"missing","duration":1}]}]`,
+		"duration":  `[{"name":"idle","frames":[{"frame":"idle_0"}]}]`,
+		"name":      `[{"frames":[{"frame":"idle_0","duration":1}]}]`,
+		"empty":     `[{"name":"idle","frames":[]}]`,
+		"duplicate": `[{"name":"idle","frames":[{"frame":"idle_0","duration":1}]},{"name":"idle","frames":[{"frame":"idle_0","duration":1}]}]`,
+		"notArray":  `{"idle":["idle_0"]}`,
+	} {
+		if _, err := parsePixelartTimeline([]byte(data), frames); err == nil {
+			t.Errorf("parsePixelartTimeline(%s) error = nil", name)
+		}
+	}
+}
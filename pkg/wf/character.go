@@ -0,0 +1,340 @@
+package wf
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Jeffail/gabs/v2"
+)
+
+const (
+	characterBundleVersion  = 1
+	characterBundleManifest = "manifest.json"
+)
+
+// CharacterConfig is the configuration for character bundles.
+// Sources are read like ExtractorConfig sources, without SrcPaths.
+// Each character of Devnames, or of the character table if All is set, is bundled into [DestPath]/[devname].
+type CharacterConfig struct {
+	SrcPath     string
+	SrcFS       fs.FS
+	Archives    []string
+	DestPath    string
+	Devnames    []string
+	All         bool
+	Indent      int
+	Concurrency int
+}
+
+// DefaultCharacterConfig generates a default configuration.
+func DefaultCharacterConfig() *CharacterConfig {
+	return &CharacterConfig{
+		SrcPath:     "",
+		SrcFS:       nil,
+		Archives:    nil,
+		DestPath:    "",
+		Devnames:    nil,
+		All:         false,
+		Indent:      0,
+		Concurrency: 5,
+	}
+}
+
+// CharacterBundler gathers assets and master table rows of characters.
+type CharacterBundler struct {
+	config *CharacterConfig
+}
+
+// NewCharacterBundler creates a new character bundler with the supplied configuration.
+// If the configuration is nil, use DefaultCharacterConfig.
+func NewCharacterBundler(config *CharacterConfig) (*CharacterBundler, error) {
+	def := DefaultCharacterConfig()
+	if def == nil {
+		return nil, fmt.Errorf("NewCharacterBundler: default configuration is nil")
+	}
+
+	if config == nil {
+		config = def
+	}
+
+	var err error
+	config.SrcPath, config.SrcFS, err = sourceConfig(config.SrcPath, nil, config.SrcFS, config.Archives)
+	if err != nil {
+		return nil, err
+	}
+	config.DestPath, err = workingPath(config.DestPath)
+	if err != nil {
+		return nil, err
+	}
+	if archiveFormat(config.DestPath) != "" {
+		return nil, fmt.Errorf("NewCharacterBundler: archive destinations are not supported, dest=%s", config.DestPath)
+	}
+	if !config.All && len(config.Devnames) == 0 {
+		return nil, fmt.Errorf("NewCharacterBundler: no devname")
+	}
+
+	if config.Concurrency == 0 {
+		config.Concurrency = def.Concurrency
+	}
+
+	return &CharacterBundler{config: config}, nil
+}
+
+// characterBundle is the manifest of a character bundle.
+// Tables map master table paths to rows by their key path, e.g. 111001 or 111001.1.
+type characterBundle struct {
+	Version int                         `json:"version"`
+	Devname string                      `json:"devname"`
+	ID      string                      `json:"id"`
+	Name    string                      `json:"name"`
+	Tables  map[string]map[string][]any `json:"tables"`
+	Assets  []*manifestEntry            `json:"assets"`
+}
+
+func (bundle *characterBundle) addRows(table string, keys []string, rows []any) {
+	if bundle.Tables[table] == nil {
+		bundle.Tables[table] = map[string][]any{}
+	}
+	bundle.Tables[table][strings.Join(keys, ".")] = rows
+}
+
+// walkTableRows calls fn with the key path and rows of every entry of a master table.
+func walkTableRows(c *gabs.Container, keys []string, fn func([]string, []any)) {
+	switch val := c.Data().(type) {
+	case map[string]any:
+		for k, child := range c.ChildrenMap() {
+			walkTableRows(child, append(keys[:len(keys):len(keys)], k), fn)
+		}
+	case []any:
+		fn(keys, val)
+	}
+}
+
+// characterBundles creates bundles of characters in the character table, all of them if devnames is empty.
+func characterBundles(table *gabs.Container, devnames []string) (map[string]*characterBundle, error) {
+	s, err := loadSchemas("")
+	if err != nil {
+		return nil, err
+	}
+	nameColumn, err := characterNameColumn(s)
+	if err != nil {
+		return nil, err
+	}
+
+	all := make(map[string]*characterBundle)
+	for id, char := range table.ChildrenMap() {
+		devname, ok := char.Path("0.0").Data().(string)
+		if !ok || devname == "" {
+			continue
+		}
+		name, _ := char.Path(fmt.Sprintf("0.%d", nameColumn)).Data().(string)
+		all[devname] = &characterBundle{
+			Version: characterBundleVersion,
+			Devname: devname,
+			ID:      id,
+			Name:    name,
+			Tables:  map[string]map[string][]any{},
+			Assets:  []*manifestEntry{},
+		}
+	}
+	if len(devnames) == 0 {
+		return all, nil
+	}
+
+	output := make(map[string]*characterBundle)
+	for _, d := range devnames {
+		bundle, ok := all[d]
+		if !ok {
+			return nil, fmt.Errorf("characterBundles: unknown devname, devname=%s", d)
+		}
+		output[d] = bundle
+	}
+	return output, nil
+}
+
+// collectRows adds rows of a master table related to bundled characters.
+// Rows are related if their key path or cells contain a devname, or if they belong to a character/ table and are keyed by a character ID.
+func collectRows(tablePath string, table *gabs.Container, bundles map[string]*characterBundle, ids map[string]string) {
+	walkTableRows(table, nil, func(keys []string, rows []any) {
+		related := map[string]bool{}
+		for _, k := range keys {
+			if _, ok := bundles[k]; ok {
+				related[k] = true
+			}
+		}
+		if strings.HasPrefix(tablePath, "character/") && len(keys) > 0 {
+			if devname, ok := ids[keys[0]]; ok {
+				related[devname] = true
+			}
+		}
+		for _, row := range rows {
+			cells, _ := row.([]any)
+			for _, cell := range cells {
+				if s, ok := cell.(string); ok {
+					if _, ok := bundles[s]; ok {
+						related[s] = true
+					}
+				}
+			}
+		}
+		for devname := range related {
+			bundles[devname].addRows(tablePath, keys, rows)
+		}
+	})
+}
+
+// characterPathSuffixes splits the default path list into paths under character/[devname]/ of any character,
+// since the path list only contains assets of some characters, and other paths which may contain devnames.
+func characterPathSuffixes() (suffixes []string, others []string) {
+	seen := make(map[string]bool)
+	for _, p := range defaultPaths() {
+		p = strings.TrimPrefix(p, "/")
+		parts := strings.SplitN(p, "/", 3)
+		if len(parts) < 3 || parts[0] != "character" {
+			others = append(others, p)
+			continue
+		}
+		if parts[2] == "" || seen[parts[2]] {
+			continue
+		}
+		seen[parts[2]] = true
+		suffixes = append(suffixes, parts[2])
+	}
+	sort.Strings(suffixes)
+	return suffixes, others
+}
+
+// extractCharacter extracts assets with devname as a path segment into the bundle directory.
+func (bundler *CharacterBundler) extractCharacter(bundle *characterBundle, suffixes []string, others []string, tmp string) error {
+	include := `(^|/)` + regexp.QuoteMeta(bundle.Devname) + `(/|\.|$)`
+	pattern, err := regexp.Compile(include)
+	if err != nil {
+		return err
+	}
+
+	// discovered paths are written next to the temporary manifest instead of into bundles
+	pathList := filepath.Join(tmp, bundle.Devname+defaultPathList)
+	var pl strings.Builder
+	for _, s := range suffixes {
+		pl.WriteString(path.Join("character", bundle.Devname, s) + "\n")
+	}
+	for _, p := range others {
+		if pattern.MatchString(p) {
+			pl.WriteString(p + "\n")
+		}
+	}
+	err = os.WriteFile(pathList, []byte(pl.String()), 0666)
+	if err != nil {
+		return err
+	}
+
+	manifestPath := filepath.Join(tmp, bundle.Devname+".json")
+	extractor, err := NewExtractor(&ExtractorConfig{
+		SrcPath:        bundler.config.SrcPath,
+		SrcFS:          bundler.config.SrcFS,
+		PathList:       pathList,
+		NoDefaultPaths: true,
+		DestPath:       filepath.Join(bundler.config.DestPath, bundle.Devname),
+		ManifestPath:   manifestPath,
+		Include:        []string{regexFilterPrefix + include},
+		Indent:         bundler.config.Indent,
+		Concurrency:    bundler.config.Concurrency,
+		RawAssets:      true,
+	})
+	if err != nil {
+		return err
+	}
+	err = extractor.ExtractAssets()
+	if err != nil {
+		return err
+	}
+
+	entries, _, err := readManifestEntries(manifestPath)
+	if err != nil {
+		return err
+	}
+	if entries != nil {
+		bundle.Assets = entries
+	}
+	return nil
+}
+
+func (bundle *characterBundle) write(p string, indent int) error {
+	return writeJSON(p, bundle, indent)
+}
+
+// BundleCharacters gathers assets and related master table rows of each character into its own directory with a manifest.
+func (bundler *CharacterBundler) BundleCharacters() error {
+	log.Println("[INFO] Bundling characters")
+
+	extractorConfig := &ExtractorConfig{SrcPath: bundler.config.SrcPath, SrcFS: bundler.config.SrcFS}
+	table, err := readMasterTable(characterTable, extractorConfig)
+	if err != nil {
+		return err
+	}
+	var devnames []string
+	if !bundler.config.All {
+		devnames = bundler.config.Devnames
+	}
+	bundles, err := characterBundles(table, devnames)
+	if err != nil {
+		return err
+	}
+	ids := make(map[string]string)
+	for devname, bundle := range bundles {
+		ids[bundle.ID] = devname
+	}
+
+	tables := make(map[string]bool)
+	for _, p := range defaultPaths() {
+		// paths with a leading / resolve to the same table
+		p = strings.TrimPrefix(p, "/")
+		if tables[p] {
+			continue
+		}
+		tables[p] = true
+		t, err := readMasterTable(p, extractorConfig)
+		if err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				log.Printf("[WARN] Unable to read master table, path=%s, err=%v\n", p, err)
+			}
+			continue
+		}
+		collectRows(p, t, bundles, ids)
+	}
+
+	tmp, err := os.MkdirTemp("", "wfax-character-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	suffixes, others := characterPathSuffixes()
+	sorted := make([]string, 0, len(bundles))
+	for devname := range bundles {
+		sorted = append(sorted, devname)
+	}
+	sort.Strings(sorted)
+
+	for _, devname := range sorted {
+		log.Printf("[INFO] Bundling character, devname=%s\n", devname)
+		bundle := bundles[devname]
+		err = bundler.extractCharacter(bundle, suffixes, others, tmp)
+		if err != nil {
+			return fmt.Errorf("BundleCharacters: extract error, devname=%s, %w", devname, err)
+		}
+		err = bundle.write(filepath.Join(bundler.config.DestPath, devname, characterBundleManifest), bundler.config.Indent)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
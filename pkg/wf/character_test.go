@@ -0,0 +1,72 @@
+package wf
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/blead/wfax/pkg/encoding"
+)
+
+func TestBundleCharacters(t *testing.T) {
+	src := func(p string, ext string) string {
+		h, err := sha1Digest(addExt(p, ext), digestSalt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return dumpPath(h)
+	}
+	table := func(js string) []byte {
+		data, err := encoding.JSONToOrderedmap([]byte(js))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	dumped := []byte("\x89png\r\n\x1a\n")
+
+	dir := t.TempDir()
+	bundler, err := NewCharacterBundler(&CharacterConfig{
+		SrcFS: fstest.MapFS{
+			src(toMasterTablePath(characterTable), ""):               {Data: table(`{"1":[["alk","Alk"]],"2":[["other","Other"]]}`)},
+			src(toMasterTablePath("character/character_status"), ""): {Data: table(`{"1":[["100"]],"2":[["200"]]}`)},
+			src(toMasterTablePath("character/character_text"), ""):   {Data: table(`{"x":[["alk","hello"]]}`)},
+			src("character/alk/ui/square_0", ".png"):                 {Data: dumped},
+		},
+		DestPath: dir,
+		Devnames: []string{"alk"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = bundler.BundleCharacters()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "alk", characterBundleManifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bundle characterBundle
+	err = json.Unmarshal(data, &bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bundle.ID != "1" || bundle.Name != "Alk" {
+		t.Errorf("bundle id=%s, name=%s", bundle.ID, bundle.Name)
+	}
+	if len(bundle.Tables) != 3 || bundle.Tables["character/character_status"]["1"] == nil || bundle.Tables["character/character_status"]["2"] != nil {
+		t.Errorf("bundle tables = %v", bundle.Tables)
+	}
+	if len(bundle.Assets) != 1 || bundle.Assets[0].Path != "assets/character/alk/ui/square_0.png" {
+		t.Errorf("bundle assets = %+v", bundle.Assets)
+	}
+
+	_, err = os.Stat(filepath.Join(dir, "alk", outputAssetsDir, "character", "alk", "ui", "square_0.png"))
+	if err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,380 @@
+package wf
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blead/wfax/pkg/concurrency"
+	"github.com/blead/wfax/pkg/encoding"
+	_ "modernc.org/sqlite"
+)
+
+const (
+	dbMetadataTable = "_wfax_metadata"
+	dbTablesTable   = "_wfax_tables"
+	dbRowColumn     = "row"
+	// nested map keys are stored in key_1, key_2, ... columns
+	dbKeyColumnPrefix = "key_"
+)
+
+// DatabaseConfig is the configuration for the database builder.
+// Sources are read like ExtractorConfig sources.
+type DatabaseConfig struct {
+	SrcPath        string
+	SrcPaths       []string
+	SrcFS          fs.FS
+	Archives       []string
+	DestPath       string
+	PathList       string
+	NoDefaultPaths bool
+	SchemaPath     string
+	Version        string
+	Concurrency    int
+}
+
+// DefaultDatabaseConfig generates a default configuration.
+func DefaultDatabaseConfig() *DatabaseConfig {
+	return &DatabaseConfig{
+		SrcPath:        "",
+		SrcPaths:       nil,
+		SrcFS:          nil,
+		Archives:       nil,
+		DestPath:       "wf.db",
+		PathList:       "",
+		NoDefaultPaths: false,
+		SchemaPath:     "",
+		Version:        "",
+		Concurrency:    5,
+	}
+}
+
+// DatabaseBuilder writes WF master tables into a SQLite database.
+type DatabaseBuilder struct {
+	config  *DatabaseConfig
+	schemas schemas
+}
+
+// NewDatabaseBuilder creates a new database builder with the supplied configuration.
+// If the configuration is nil, use DefaultDatabaseConfig.
+func NewDatabaseBuilder(config *DatabaseConfig) (*DatabaseBuilder, error) {
+	def := DefaultDatabaseConfig()
+	if def == nil {
+		return nil, fmt.Errorf("NewDatabaseBuilder: default configuration is nil")
+	}
+
+	if config == nil {
+		config = def
+	}
+
+	var err error
+	config.SrcPath, config.SrcFS, err = sourceConfig(config.SrcPath, config.SrcPaths, config.SrcFS, config.Archives)
+	if err != nil {
+		return nil, err
+	}
+	if config.DestPath == "" {
+		config.DestPath = def.DestPath
+	}
+	config.DestPath = filepath.Clean(config.DestPath)
+	if config.PathList != "" {
+		config.PathList = filepath.Clean(config.PathList)
+	}
+
+	if config.Concurrency == 0 {
+		config.Concurrency = 5
+	}
+
+	s, err := loadSchemas(config.SchemaPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DatabaseBuilder{config: config, schemas: s}, nil
+}
+
+type dbTable struct {
+	path string
+	// sha256 is the hash of the source followed by the table schema, so that schema changes rewrite the table
+	sha256 string
+	// table is nil if the source is unchanged
+	table *encoding.OrderedmapTable
+}
+
+func quoteIdentifier(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+// masterTablePaths returns normalized master table paths from the path lists of config.
+func masterTablePaths(config *ExtractorConfig) ([]string, error) {
+	extractor := &Extractor{config: config}
+	paths, err := extractor.getInitialPaths()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	var output []string
+	for _, p := range paths {
+		tp := strings.TrimPrefix(path.Clean(string(p)), "/")
+		if len(p) > 0 && !seen[tp] {
+			seen[tp] = true
+			output = append(output, tp)
+		}
+	}
+	sort.Strings(output)
+	return output, nil
+}
+
+// tablePaths returns normalized master table paths from the path lists.
+func (builder *DatabaseBuilder) tablePaths() ([]string, error) {
+	return masterTablePaths(&ExtractorConfig{
+		SrcPath:        builder.config.SrcPath,
+		PathList:       builder.config.PathList,
+		NoDefaultPaths: builder.config.NoDefaultPaths,
+	})
+}
+
+func (builder *DatabaseBuilder) readHashes(db *sql.DB) (map[string]string, error) {
+	rows, err := db.Query(fmt.Sprintf("SELECT path, sha256 FROM %s", quoteIdentifier(dbTablesTable)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hashes := map[string]string{}
+	for rows.Next() {
+		var p, h string
+		err := rows.Scan(&p, &h)
+		if err != nil {
+			return nil, err
+		}
+		hashes[p] = h
+	}
+	return hashes, rows.Err()
+}
+
+func (builder *DatabaseBuilder) readTable(p string, hashes map[string]string) (*dbTable, error) {
+	config := &ExtractorConfig{SrcPath: builder.config.SrcPath, SrcFS: builder.config.SrcFS}
+	src, err := (&orderedmapParser{}).getSrc(p, config)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := fs.ReadFile(config.srcFS(), src)
+	if err != nil {
+		// tables missing from the dump are kept as is
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("readTable: src read error, src=%s, %w", src, err)
+	}
+
+	schema, err := json.Marshal(builder.schemas[p])
+	if err != nil {
+		return nil, err
+	}
+	checksum, err := sha256Checksum(io.MultiReader(bytes.NewReader(data), bytes.NewReader(schema)))
+	if err != nil {
+		return nil, err
+	}
+	t := &dbTable{path: p, sha256: hex.EncodeToString(checksum)}
+	if hashes[p] == t.sha256 {
+		return t, nil
+	}
+
+	t.table, err = encoding.OrderedmapToTable(data)
+	if err != nil {
+		return nil, fmt.Errorf("readTable: src parse error, src=%s, path=%s, %w", src, p, err)
+	}
+	return t, nil
+}
+
+func (builder *DatabaseBuilder) writeTable(db *sql.DB, t *dbTable, updatedAt string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	name := quoteIdentifier(t.path)
+	_, err = tx.Exec("DROP TABLE IF EXISTS " + name)
+	if err != nil {
+		return fmt.Errorf("writeTable: drop error, path=%s, %w", t.path, err)
+	}
+
+	schema := builder.schemas[t.path]
+	types := t.table.ColumnTypes(schema)
+
+	var columns []string
+	// column names are case insensitive in SQLite
+	names := map[string]bool{}
+	for i := 1; i <= t.table.Depth; i++ {
+		k := fmt.Sprintf("%s%d", dbKeyColumnPrefix, i)
+		names[k] = true
+		columns = append(columns, fmt.Sprintf("%s TEXT", quoteIdentifier(k)))
+	}
+	names[dbRowColumn] = true
+	columns = append(columns, fmt.Sprintf("%s INTEGER", quoteIdentifier(dbRowColumn)))
+	for i, typ := range types {
+		sqlType := "TEXT"
+		switch typ {
+		case encoding.ColumnNumber:
+			sqlType = "NUMERIC"
+		case encoding.ColumnBool:
+			sqlType = "BOOLEAN"
+		}
+		// schema names colliding with key, row or earlier columns fall back to indexes, which schemas cannot use as names
+		n := schema.ColumnName(i)
+		if names[strings.ToLower(n)] {
+			log.Printf("[WARN] Column name collision, using index instead, path=%s, index=%d, name=%s\n", t.path, i, n)
+			n = strconv.Itoa(i)
+		}
+		names[strings.ToLower(n)] = true
+		columns = append(columns, fmt.Sprintf("%s %s", quoteIdentifier(n), sqlType))
+	}
+
+	_, err = tx.Exec(fmt.Sprintf("CREATE TABLE %s (%s)", name, strings.Join(columns, ", ")))
+	if err != nil {
+		return fmt.Errorf("writeTable: create error, path=%s, %w", t.path, err)
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+	stmt, err := tx.Prepare(fmt.Sprintf("INSERT INTO %s VALUES (%s)", name, placeholders))
+	if err != nil {
+		return fmt.Errorf("writeTable: prepare error, path=%s, %w", t.path, err)
+	}
+	defer stmt.Close()
+
+	for _, row := range t.table.Rows {
+		values := make([]any, len(columns))
+		for i, k := range row.Keys {
+			values[i] = k
+		}
+		values[t.table.Depth] = row.Index
+		for i, cell := range row.Cells {
+			var v any = cell
+			switch {
+			case cell == "":
+				v = nil
+			case types[i] == encoding.ColumnBool && cell == "true":
+				v = 1
+			case types[i] == encoding.ColumnBool && cell == "false":
+				v = 0
+			}
+			values[t.table.Depth+1+i] = v
+		}
+
+		_, err = stmt.Exec(values...)
+		if err != nil {
+			return fmt.Errorf("writeTable: insert error, path=%s, %w", t.path, err)
+		}
+	}
+
+	_, err = tx.Exec(
+		fmt.Sprintf("INSERT OR REPLACE INTO %s (path, sha256, version, rows, updated_at) VALUES (?, ?, ?, ?, ?)", quoteIdentifier(dbTablesTable)),
+		t.path, t.sha256, builder.config.Version, len(t.table.Rows), updatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("writeTable: metadata error, path=%s, %w", t.path, err)
+	}
+
+	return tx.Commit()
+}
+
+func (builder *DatabaseBuilder) build() error {
+	err := os.MkdirAll(filepath.Dir(builder.config.DestPath), 0777)
+	if err != nil {
+		return err
+	}
+
+	db, err := sql.Open("sqlite", builder.config.DestPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (key TEXT PRIMARY KEY, value TEXT)", quoteIdentifier(dbMetadataTable)))
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (path TEXT PRIMARY KEY, sha256 TEXT, version TEXT, rows INTEGER, updated_at TEXT)", quoteIdentifier(dbTablesTable)))
+	if err != nil {
+		return err
+	}
+
+	hashes, err := builder.readHashes(db)
+	if err != nil {
+		return err
+	}
+
+	paths, err := builder.tablePaths()
+	if err != nil {
+		return err
+	}
+
+	var items []*concurrency.Item[string, *dbTable]
+	for _, p := range paths {
+		items = append(items, &concurrency.Item[string, *dbTable]{Data: p})
+	}
+	err = concurrency.Execute(
+		func(i *concurrency.Item[string, *dbTable]) (*dbTable, error) {
+			return builder.readTable(i.Data, hashes)
+		},
+		items,
+		builder.config.Concurrency,
+	)
+	if err != nil {
+		return err
+	}
+
+	updatedAt := time.Now().UTC().Format(time.RFC3339)
+	updated, unchanged := 0, 0
+	for _, i := range items {
+		if i.Output == nil {
+			continue
+		}
+		if i.Output.table == nil {
+			unchanged++
+			continue
+		}
+
+		err := builder.writeTable(db, i.Output, updatedAt)
+		if err != nil {
+			return err
+		}
+		updated++
+	}
+
+	metadata := map[string]string{"updated_at": updatedAt}
+	if builder.config.Version != "" {
+		metadata["version"] = builder.config.Version
+	}
+	for k, v := range metadata {
+		_, err := db.Exec(fmt.Sprintf("INSERT OR REPLACE INTO %s (key, value) VALUES (?, ?)", quoteIdentifier(dbMetadataTable)), k, v)
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Printf("[INFO] Database built, path=%s, updated=%d, unchanged=%d\n", builder.config.DestPath, updated, unchanged)
+	return nil
+}
+
+// BuildDatabase writes master tables from downloaded files into the database, only updating changed tables.
+func (builder *DatabaseBuilder) BuildDatabase() error {
+	log.Println("[INFO] Building database")
+	return builder.build()
+}
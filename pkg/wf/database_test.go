@@ -0,0 +1,114 @@
+package wf
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/blead/wfax/pkg/encoding"
+)
+
+func TestBuildDatabase(t *testing.T) {
+	h, err := sha1Digest(toMasterTablePath("item/test"), digestSalt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	table, err := encoding.JSONToOrderedmap([]byte(`{"1":{"a":[["sword","3","true"],["sword2","",""]]},"2":{"b":[["bow","5","false"]]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	pathList := filepath.Join(dir, "pathlist")
+	err = os.WriteFile(pathList, []byte("item/test\n"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest := filepath.Join(dir, "wf.db")
+	build := func(schema string) {
+		schemaPath := ""
+		if schema != "" {
+			schemaPath = filepath.Join(dir, "schemas.json")
+			err := os.WriteFile(schemaPath, []byte(schema), 0666)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		builder, err := NewDatabaseBuilder(&DatabaseConfig{
+			SrcFS:          fstest.MapFS{dumpPath(h): {Data: table}},
+			DestPath:       dest,
+			PathList:       pathList,
+			NoDefaultPaths: true,
+			SchemaPath:     schemaPath,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = builder.BuildDatabase()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db, err := sql.Open("sqlite", dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	columns := func() string {
+		rows, err := db.Query(`SELECT name, type FROM pragma_table_info('item/test')`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		var output []string
+		for rows.Next() {
+			var name, typ string
+			err = rows.Scan(&name, &typ)
+			if err != nil {
+				t.Fatal(err)
+			}
+			output = append(output, name+" "+typ)
+		}
+		return strings.Join(output, ", ")
+	}
+	query := func(q string) string {
+		var output string
+		err := db.QueryRow(q).Scan(&output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return output
+	}
+
+	build("")
+	if got, want := columns(), "key_1 TEXT, key_2 TEXT, row INTEGER, 0 TEXT, 1 NUMERIC, 2 BOOLEAN"; got != want {
+		t.Errorf("columns = %s, want %s", got, want)
+	}
+	if got := query(`SELECT group_concat(key_1 || key_2 || row || "0" || ifnull("1", '-') || ifnull("2", '-'), ',') FROM "item/test"`); got != "1a0sword31,1a1sword2--,2b0bow50" {
+		t.Errorf("rows = %s", got)
+	}
+
+	// unchanged sources and schemas are skipped, keeping rows added since
+	_, err = db.Exec(`INSERT INTO "item/test" (key_1, row) VALUES ('marker', 0)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	build("")
+	if got := query(`SELECT count(*) FROM "item/test" WHERE key_1 = 'marker'`); got != "1" {
+		t.Errorf("unchanged table rewritten, markers = %s", got)
+	}
+
+	// schema changes rewrite the table, names colliding with key and row columns fall back to indexes
+	build(`{"item/test":{"columns":[{"index":0,"name":"ROW"},{"index":1,"name":"key_2"},{"index":2,"name":"enabled"}]}}`)
+	if got := query(`SELECT count(*) FROM "item/test" WHERE key_1 = 'marker'`); got != "0" {
+		t.Errorf("table not rewritten after schema change, markers = %s", got)
+	}
+	if got, want := columns(), fmt.Sprintf("key_1 TEXT, key_2 TEXT, %s INTEGER, 0 TEXT, 1 NUMERIC, enabled BOOLEAN", dbRowColumn); got != want {
+		t.Errorf("columns = %s, want %s", got, want)
+	}
+}
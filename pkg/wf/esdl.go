@@ -0,0 +1,351 @@
+package wf
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Jeffail/gabs/v2"
+	"github.com/blead/wfax/pkg/encoding"
+)
+
+const (
+	esdlExt       = ".esdl"
+	actionDSLExt  = ".action.dsl"
+	extractedJSON = ".json"
+)
+
+// ESDLGraphConfig is the configuration for ESDL graph exports.
+// Extracted files are read from SrcFS if set, otherwise from SrcPath, which may be a .zip, .tar.gz or .tgz archive written by extract.
+// Path is the asset path of an enemy ESDL file, e.g. battle/enemy/boss/esdl/boss.
+// Each graph is written as Graphviz DOT if its path ends with .dot, as JSON otherwise.
+// ReadableKeys reads files extracted with readable keys by the default key dictionaries overridden per extension by KeysPath.
+type ESDLGraphConfig struct {
+	SrcPath      string
+	SrcFS        fs.FS
+	Path         string
+	DestPaths    []string
+	ReadableKeys bool
+	KeysPath     string
+	Indent       int
+}
+
+// DefaultESDLGraphConfig generates a default configuration.
+func DefaultESDLGraphConfig() *ESDLGraphConfig {
+	return &ESDLGraphConfig{
+		SrcPath:      "",
+		SrcFS:        nil,
+		Path:         "",
+		DestPaths:    nil,
+		ReadableKeys: false,
+		KeysPath:     "",
+		Indent:       0,
+	}
+}
+
+// ESDLGrapher renders enemy ESDL files as state machines.
+type ESDLGrapher struct {
+	config *ESDLGraphConfig
+	keys   *encoding.KeyDictionary
+}
+
+// NewESDLGrapher creates a new ESDL grapher with the supplied configuration.
+// If the configuration is nil, use DefaultESDLGraphConfig.
+func NewESDLGrapher(config *ESDLGraphConfig) (*ESDLGrapher, error) {
+	def := DefaultESDLGraphConfig()
+	if def == nil {
+		return nil, fmt.Errorf("NewESDLGrapher: default configuration is nil")
+	}
+
+	if config == nil {
+		config = def
+	}
+
+	if config.SrcPath == "" || config.SrcPath == "." {
+		wd, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		config.SrcPath = wd
+	}
+	config.SrcPath = filepath.Clean(config.SrcPath)
+	if config.SrcFS == nil {
+		config.SrcFS = os.DirFS(config.SrcPath)
+		if archiveFormat(config.SrcPath) != "" {
+			fsys, err := openArchiveFS(config.SrcPath)
+			if err != nil {
+				return nil, err
+			}
+			config.SrcFS = fsys
+		}
+	}
+	config.Path = strings.TrimSuffix(strings.TrimPrefix(path.Clean(filepath.ToSlash(config.Path)), "/"), esdlExt+extractedJSON)
+	if config.Path == "." {
+		return nil, fmt.Errorf("NewESDLGrapher: ESDL path is required")
+	}
+	if len(config.DestPaths) == 0 {
+		return nil, fmt.Errorf("NewESDLGrapher: no destination, path=%s", config.Path)
+	}
+
+	// files extracted with readable keys are read by obfuscated keys
+	var keys keyDictionaries
+	if config.ReadableKeys {
+		var err error
+		keys, err = loadKeyDictionaries(config.KeysPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &ESDLGrapher{config: config, keys: keys[esdlExt]}, nil
+}
+
+type esdlNode struct {
+	ID    string `json:"id"`
+	Kind  string `json:"kind"`
+	Label string `json:"label"`
+	// Form is the index of the form containing the node, empty for actions shared across forms.
+	Form string `json:"form,omitempty"`
+	// File is the extracted .action.dsl file of an action relative to the source, empty if it was not extracted.
+	File string `json:"file,omitempty"`
+}
+
+type esdlEdge struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Kind  string `json:"kind"`
+	Label string `json:"label,omitempty"`
+}
+
+// esdlGraph is the state machine of an enemy.
+// Transitions between states are not known and not included.
+type esdlGraph struct {
+	Path     string      `json:"path"`
+	BasePath string      `json:"basePath"`
+	Nodes    []*esdlNode `json:"nodes"`
+	Edges    []*esdlEdge `json:"edges"`
+
+	// fsys contains extracted files
+	fsys  fs.FS
+	nodes map[string]*esdlNode
+}
+
+func (graph *esdlGraph) node(n *esdlNode) string {
+	if _, ok := graph.nodes[n.ID]; !ok {
+		graph.nodes[n.ID] = n
+		graph.Nodes = append(graph.Nodes, n)
+	}
+	return n.ID
+}
+
+func (graph *esdlGraph) edge(from string, to string, kind string, label string) {
+	graph.Edges = append(graph.Edges, &esdlEdge{From: from, To: to, Kind: kind, Label: label})
+}
+
+// action adds the action at filePath relative to the base path, linked to its extracted file if it exists.
+func (graph *esdlGraph) action(filePath string) string {
+	p := graph.BasePath + filePath
+	file := path.Join(outputAssetsDir, p) + actionDSLExt + extractedJSON
+	if _, err := fs.Stat(graph.fsys, file); err != nil {
+		file = ""
+	}
+	return graph.node(&esdlNode{ID: "action:" + p, Kind: "action", Label: p, File: file})
+}
+
+// esdlChildren returns keys of objects in sorted order or indices of arrays with their values.
+func esdlChildren(c *gabs.Container) ([]string, []*gabs.Container) {
+	var keys []string
+	var children []*gabs.Container
+	switch c.Data().(type) {
+	case map[string]any:
+		m := c.ChildrenMap()
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			children = append(children, m[k])
+		}
+	case []any:
+		children = c.Children()
+		for i := range children {
+			keys = append(keys, strconv.Itoa(i))
+		}
+	}
+	return keys, children
+}
+
+// actions links from to actions of a list by their file paths.
+func (graph *esdlGraph) actions(from string, list *gabs.Container, kind string) {
+	_, children := esdlChildren(list)
+	for i, a := range children {
+		// b = filePath
+		if p, ok := a.Path("b").Data().(string); ok {
+			graph.edge(from, graph.action(p), kind, strconv.Itoa(i))
+		}
+	}
+}
+
+func (graph *esdlGraph) addForm(index string, form *gabs.Container) {
+	formID := graph.node(&esdlNode{ID: "form:" + index, Kind: "form", Label: "form " + index, Form: index})
+
+	// g = states
+	names, states := esdlChildren(form.Path("g"))
+	stateIDs := map[string]string{}
+	for _, name := range names {
+		stateIDs[name] = graph.node(&esdlNode{ID: "form:" + index + "/state:" + name, Kind: "state", Label: name, Form: index})
+		graph.edge(formID, stateIDs[name], "state", "")
+	}
+	for i, state := range states {
+		// i = actions
+		graph.actions(stateIDs[names[i]], state.Path("i"), "action")
+	}
+
+	// m = deadActions, i = stunActions, k = winceActions
+	graph.actions(formID, form.Path("m"), "deadAction")
+	graph.actions(formID, form.Path("i"), "stunAction")
+	graph.actions(formID, form.Path("k"), "winceAction")
+
+	// h = watches, i = content
+	watchKeys, watches := esdlChildren(form.Path("h"))
+	for i, watch := range watches {
+		watchID := graph.node(&esdlNode{ID: "form:" + index + "/watch:" + watchKeys[i], Kind: "watch", Label: "watch " + watchKeys[i], Form: index})
+		graph.edge(formID, watchID, "watch", "")
+		for _, content := range watch.Path("i").Children() {
+			// enum index "T4" references actions
+			if tag, ok := content.Search("0").Data().(string); ok && tag == "T4" {
+				if p, ok := content.Search("1").Data().(string); ok {
+					graph.edge(watchID, graph.action(p), "watchAction", "")
+				}
+			}
+		}
+	}
+}
+
+// newESDLGraph builds the state machine of ESDL JSON with obfuscated keys, linking actions to files extracted into fsys.
+func newESDLGraph(p string, data []byte, fsys fs.FS) (*esdlGraph, error) {
+	jsonParsed, err := gabs.ParseJSON(data)
+	if err != nil {
+		return nil, err
+	}
+
+	graph := &esdlGraph{Path: p, Nodes: []*esdlNode{}, Edges: []*esdlEdge{}, fsys: fsys, nodes: map[string]*esdlNode{}}
+	// bH = basePath
+	graph.BasePath, _ = jsonParsed.Path("bH").Data().(string)
+	root := graph.node(&esdlNode{ID: "enemy", Kind: "enemy", Label: p})
+
+	// au = forms
+	indices, forms := esdlChildren(jsonParsed.Path("au"))
+	for i, form := range forms {
+		graph.addForm(indices[i], form)
+		graph.edge(root, "form:"+indices[i], "form", "")
+	}
+
+	// bx = type, enum index "T1" has a pre action at g
+	if tag, ok := jsonParsed.Search("bx", "0").Data().(string); ok && tag == "T1" {
+		if pre, ok := jsonParsed.Search("bx", "1", "g").Data().(string); ok {
+			graph.edge(root, graph.action(pre), "preAction", "")
+		}
+	}
+
+	return graph, nil
+}
+
+func (graph *esdlGraph) marshalDOT() []byte {
+	var output bytes.Buffer
+	output.WriteString("digraph esdl {\n")
+	output.WriteString("\trankdir=LR;\n")
+
+	shapes := map[string]string{"enemy": "doubleoctagon", "form": "box3d", "state": "ellipse", "watch": "diamond", "action": "note"}
+	forms := map[string][]*esdlNode{}
+	var formOrder []string
+	for _, n := range graph.Nodes {
+		if n.Form == "" {
+			label := n.Label
+			if n.Kind == "action" && n.File == "" {
+				label += "\n(not extracted)"
+			}
+			fmt.Fprintf(&output, "\t%s [label=%s, shape=%s];\n", quoteDOT(n.ID), quoteDOT(label), shapes[n.Kind])
+			continue
+		}
+		if _, ok := forms[n.Form]; !ok {
+			formOrder = append(formOrder, n.Form)
+		}
+		forms[n.Form] = append(forms[n.Form], n)
+	}
+	for _, f := range formOrder {
+		fmt.Fprintf(&output, "\tsubgraph %s {\n", quoteDOT("cluster_form_"+f))
+		fmt.Fprintf(&output, "\t\tlabel=%s;\n", quoteDOT("form "+f))
+		for _, n := range forms[f] {
+			fmt.Fprintf(&output, "\t\t%s [label=%s, shape=%s];\n", quoteDOT(n.ID), quoteDOT(n.Label), shapes[n.Kind])
+		}
+		output.WriteString("\t}\n")
+	}
+
+	styles := map[string]string{"state": "dotted", "watch": "dotted", "form": "dotted"}
+	for _, e := range graph.Edges {
+		label := e.Kind
+		if e.Label != "" {
+			label += " " + e.Label
+		}
+		style := styles[e.Kind]
+		if style == "" {
+			style = "solid"
+		}
+		fmt.Fprintf(&output, "\t%s -> %s [label=%s, style=%s];\n", quoteDOT(e.From), quoteDOT(e.To), quoteDOT(label), style)
+	}
+	output.WriteString("}\n")
+
+	return output.Bytes()
+}
+
+// write writes the graph as Graphviz DOT if path ends with .dot, as JSON otherwise.
+func (graph *esdlGraph) write(p string, indent int) error {
+	var data []byte
+	if strings.EqualFold(filepath.Ext(p), graphDOTExt) {
+		data = graph.marshalDOT()
+	} else {
+		var err error
+		data, err = marshalIndentNoEscape(graph, indent)
+		if err != nil {
+			return err
+		}
+	}
+
+	return writeFile(p, data)
+}
+
+// WriteGraph renders the extracted ESDL file of an enemy as a state machine.
+func (grapher *ESDLGrapher) WriteGraph() error {
+	src := path.Join(outputAssetsDir, grapher.config.Path) + esdlExt + extractedJSON
+	data, err := fs.ReadFile(grapher.config.SrcFS, src)
+	if err != nil {
+		return fmt.Errorf("WriteGraph: src read error, src=%s, %w", src, err)
+	}
+
+	if grapher.keys != nil {
+		data, err = encoding.RenameJSONKeys(data, grapher.keys, true, 0)
+		if err != nil {
+			return fmt.Errorf("WriteGraph: key dictionary error, src=%s, %w", src, err)
+		}
+	}
+
+	graph, err := newESDLGraph(grapher.config.Path, data, grapher.config.SrcFS)
+	if err != nil {
+		return fmt.Errorf("WriteGraph: src parse error, src=%s, %w", src, err)
+	}
+
+	for _, dest := range grapher.config.DestPaths {
+		err = graph.write(dest, grapher.config.Indent)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package wf
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestESDLGraph(t *testing.T) {
+	fsys := fstest.MapFS{"assets/enemy/boss/attack.action.dsl.json": {Data: []byte("{}")}}
+
+	// the action roar has the same name as a state, which is not a transition
+	esdl := []byte(`{"bH":"enemy/boss/","au":[{"g":{"idle":{"i":[{"b":"attack"}]},"roar":{"i":[{"b":"attack"},{"b":"roar"}]}},"m":[{"b":"dead"}],"h":[{"i":[["T4","roar"]]}]}],"bx":["T1",{"g":"pre"}]}`)
+	graph, err := newESDLGraph("boss", esdl, fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{}
+	for _, n := range graph.Nodes {
+		if n.Kind == "action" {
+			files[n.ID] = n.File
+		}
+	}
+	if len(files) != 4 || files["action:enemy/boss/attack"] != "assets/enemy/boss/attack.action.dsl.json" || files["action:enemy/boss/roar"] != "" {
+		t.Errorf("newESDLGraph() actions = %v", files)
+	}
+
+	edges := map[string]bool{}
+	for _, e := range graph.Edges {
+		edges[e.Kind+" "+e.From+" "+e.To] = true
+	}
+	want := []string{
+		"form enemy form:0",
+		"state form:0 form:0/state:idle",
+		"state form:0 form:0/state:roar",
+		"action form:0/state:idle action:enemy/boss/attack",
+		"action form:0/state:roar action:enemy/boss/attack",
+		"action form:0/state:roar action:enemy/boss/roar",
+		"deadAction form:0 action:enemy/boss/dead",
+		"watch form:0 form:0/watch:0",
+		"watchAction form:0/watch:0 action:enemy/boss/roar",
+		"preAction enemy action:enemy/boss/pre",
+	}
+	for _, e := range want {
+		if !edges[e] {
+			t.Errorf("newESDLGraph() missing edge %s", e)
+		}
+	}
+	if len(edges) != len(want) {
+		t.Errorf("newESDLGraph() edges = %v, want %d", edges, len(want))
+	}
+}
+
+func TestESDLGraphArchive(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "output.zip")
+	s, err := newSink(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.write("assets/enemy/boss/esdl/boss.esdl.json", []byte(`{"bH":"enemy/boss/","au":[{"m":[{"b":"dead"}]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.write("assets/enemy/boss/dead.action.dsl.json", []byte("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dest := filepath.Join(dir, "boss.json")
+	grapher, err := NewESDLGrapher(&ESDLGraphConfig{SrcPath: src, Path: "enemy/boss/esdl/boss", DestPaths: []string{dest}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = grapher.WriteGraph()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var graph esdlGraph
+	err = json.Unmarshal(data, &graph)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range graph.Nodes {
+		if n.ID == "action:enemy/boss/dead" && n.File != "assets/enemy/boss/dead.action.dsl.json" {
+			t.Errorf("action file = %q, want extracted file in archive", n.File)
+		}
+	}
+	if len(graph.Nodes) != 3 {
+		t.Errorf("nodes = %d, want 3", len(graph.Nodes))
+	}
+}
@@ -3,9 +3,11 @@ package wf
 import (
 	"bufio"
 	"bytes"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
@@ -13,7 +15,6 @@ import (
 	"strings"
 
 	"github.com/Jeffail/gabs/v2"
-	"github.com/blead/wfax/assets"
 	"github.com/blead/wfax/pkg/concurrency"
 	"github.com/blead/wfax/pkg/encoding"
 )
@@ -23,31 +24,98 @@ const (
 	outputAssetsDir     = "assets"
 	outputOrderedMapDir = "orderedmap"
 	defaultPathList     = ".pathlist"
+	characterTable      = "character/character"
+)
+
+// Output formats of orderedmap tables.
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+	FormatTSV  = "tsv"
 )
 
 // ExtractorConfig is the configuration for the extractor.
+// Include and Exclude are glob patterns, or regular expressions prefixed with re:, of written paths.
+// MaxDepth limits the number of references followed from initial paths, 0 is unlimited and negative follows none.
+// Sources are read from SrcFS if set, otherwise from the dump root SrcPath with the dump roots SrcPaths
+// and then Archives layered on top in order of precedence, later roots take precedence per file.
+// ReadableKeys renames obfuscated keys of ESDL and action DSL files by the default key dictionaries overridden per extension by KeysPath.
+// There is no default dictionary of action DSL files, which are only renamed by a dictionary from KeysPath.
+// Normalize rewrites JSON outputs of all parsers with canonical numbers, indentation and a trailing newline,
+// SortKeys implies Normalize and also sorts object keys which otherwise keep their source order.
+// Orderedmap tables keep their key order and number literals so that they still pack into the source tables.
+// If DestPath ends with .zip, .tar.gz or .tgz, outputs and the discovered path list are written into a single archive.
+// If ManifestPath is set, a manifest of written outputs with their hashes is written to it.
+// KeepGoing records files failing to extract into a report at ReportPath instead of aborting,
+// the extraction then returns an error wrapping ErrPartialFailure.
+// Profile is an export profile file or the name of a built-in profile, Eliyabot is the same as the built-in eliyabot profile.
+// RawAssets also extracts images, atlases, pixel art and parts data and voices, which are not extracted by default.
 type ExtractorConfig struct {
-	SrcPath        string
-	DestPath       string
-	PathList       string
-	NoDefaultPaths bool
-	Concurrency    int
-	Indent         int
-	FlattenCSV     bool
-	Eliyabot       bool
+	SrcPath          string
+	SrcPaths         []string
+	SrcFS            fs.FS
+	Archives         []string
+	DestPath         string
+	PathList         string
+	NoDefaultPaths   bool
+	Concurrency      int
+	Indent           int
+	FlattenCSV       bool
+	NamedColumns     bool
+	TypedValues      bool
+	SchemaPath       string
+	OutputFormat     string
+	ReadableKeys     bool
+	KeysPath         string
+	Normalize        bool
+	SortKeys         bool
+	Incremental      bool
+	StatePath        string
+	ManifestPath     string
+	GraphPaths       []string
+	Include          []string
+	Exclude          []string
+	TraverseExcluded bool
+	MaxDepth         int
+	KeepGoing        bool
+	ReportPath       string
+	Profile          string
+	Eliyabot         bool
+	RawAssets        bool
 }
 
 // DefaultExtractorConfig generates a default configuration.
 func DefaultExtractorConfig() *ExtractorConfig {
 	return &ExtractorConfig{
-		SrcPath:        "",
-		DestPath:       "",
-		PathList:       "",
-		NoDefaultPaths: false,
-		Concurrency:    5,
-		Indent:         0,
-		FlattenCSV:     false,
-		Eliyabot:       false,
+		SrcPath:          "",
+		SrcPaths:         nil,
+		DestPath:         "",
+		PathList:         "",
+		NoDefaultPaths:   false,
+		Concurrency:      5,
+		Indent:           0,
+		FlattenCSV:       false,
+		NamedColumns:     false,
+		TypedValues:      false,
+		SchemaPath:       "",
+		OutputFormat:     FormatJSON,
+		ReadableKeys:     false,
+		KeysPath:         "",
+		Normalize:        false,
+		SortKeys:         false,
+		Incremental:      false,
+		StatePath:        "",
+		ManifestPath:     "",
+		GraphPaths:       nil,
+		Include:          nil,
+		Exclude:          nil,
+		TraverseExcluded: false,
+		MaxDepth:         0,
+		KeepGoing:        false,
+		ReportPath:       "",
+		Profile:          "",
+		Eliyabot:         false,
+		RawAssets:        false,
 	}
 }
 
@@ -55,6 +123,23 @@ func DefaultExtractorConfig() *ExtractorConfig {
 type Extractor struct {
 	config  *ExtractorConfig
 	parsers []parser
+	schemas schemas
+	// profile is nil if no export profile is used
+	profile *exportProfile
+	// keys is nil if keys are not renamed
+	keys keyDictionaries
+}
+
+// rawAssetParsers returns parsers of assets which are only extracted with RawAssets.
+func rawAssetParsers() []parser {
+	return []parser{
+		&pngParser{},
+		&amf3Parser{ext: ".atlas"},
+		&amf3Parser{ext: ".frame"},
+		&amf3Parser{ext: ".parts"},
+		&amf3Parser{ext: ".timeline"},
+		&rawParser{ext: ".mp3"},
+	}
 }
 
 // NewExtractor creates a new extractor with the supplied configuration.
@@ -69,72 +154,124 @@ func NewExtractor(config *ExtractorConfig) (*Extractor, error) {
 		config = def
 	}
 
-	if config.SrcPath == "" || config.SrcPath == "." {
-		wd, err := os.Getwd()
+	var err error
+	config.SrcPath, config.SrcFS, err = sourceConfig(config.SrcPath, config.SrcPaths, config.SrcFS, config.Archives)
+	if err != nil {
+		return nil, err
+	}
+	config.DestPath, err = workingPath(config.DestPath)
+	if err != nil {
+		return nil, err
+	}
+	if archiveFormat(config.DestPath) != "" {
+		// archives are written from scratch, nothing is read from a previous extraction
+		if config.Incremental {
+			return nil, fmt.Errorf("NewExtractor: incremental extraction is not supported with archive destinations, dest=%s", config.DestPath)
+		}
+		if config.PathList == "." {
+			config.PathList = ""
+		}
+		if config.StatePath == "." {
+			config.StatePath = ""
+		}
+	} else {
+		if config.PathList == "" || config.PathList == "." {
+			config.PathList = filepath.Join(config.DestPath, defaultPathList)
+		}
+		if config.StatePath == "" || config.StatePath == "." {
+			config.StatePath = filepath.Join(config.DestPath, defaultStatePath)
+		}
+	}
+	if config.PathList != "" {
+		config.PathList = filepath.Clean(config.PathList)
+	}
+	if config.StatePath != "" {
+		config.StatePath = filepath.Clean(config.StatePath)
+	}
+	if config.ManifestPath != "" {
+		config.ManifestPath = filepath.Clean(config.ManifestPath)
+	}
+	if config.KeepGoing && (config.ReportPath == "" || config.ReportPath == ".") {
+		if archiveFormat(config.DestPath) != "" {
+			config.ReportPath = strings.TrimSuffix(config.DestPath, filepath.Ext(config.DestPath)) + defaultReportPath
+		} else {
+			config.ReportPath = filepath.Join(config.DestPath, defaultReportPath)
+		}
+	}
+	if config.ReportPath != "" {
+		config.ReportPath = filepath.Clean(config.ReportPath)
+	}
+
+	if config.Concurrency == 0 {
+		config.Concurrency = 5
+	}
+
+	if config.OutputFormat == "" {
+		config.OutputFormat = def.OutputFormat
+	}
+	if config.SortKeys {
+		config.Normalize = true
+	}
+
+	omParser := &orderedmapParser{}
+	switch config.OutputFormat {
+	case FormatJSON:
+	case FormatCSV, FormatTSV:
+		if config.FlattenCSV || config.TypedValues {
+			return nil, fmt.Errorf("NewExtractor: flattened CSVs and typed values are only supported in JSON format, format=%s", config.OutputFormat)
+		}
+		omParser.format = config.OutputFormat
+	default:
+		return nil, fmt.Errorf("NewExtractor: unknown output format, format=%s", config.OutputFormat)
+	}
+	if config.NamedColumns && config.FlattenCSV {
+		return nil, fmt.Errorf("NewExtractor: named columns cannot be used with flattened CSVs")
+	}
+	// CSV headers are named by schemas
+	if config.NamedColumns || config.TypedValues || omParser.format != "" {
+		s, err := loadSchemas(config.SchemaPath)
 		if err != nil {
 			return nil, err
 		}
-		config.SrcPath = wd
+		omParser.schemas = s
 	}
-	config.SrcPath = filepath.Clean(config.SrcPath)
-	if config.DestPath == "" || config.DestPath == "." {
-		wd, err := os.Getwd()
+
+	scenarios := newScenarioDecoder()
+	var keys keyDictionaries
+	if config.ReadableKeys {
+		var err error
+		keys, err = loadKeyDictionaries(config.KeysPath)
 		if err != nil {
 			return nil, err
 		}
-		config.DestPath = wd
 	}
-	config.DestPath = filepath.Clean(config.DestPath)
-	if config.PathList == "" || config.PathList == "." {
-		config.PathList = filepath.Join(config.DestPath, defaultPathList)
+
+	parsers := []parser{
+		omParser,
+		&amf3Parser{ext: ".action.dsl", keys: keys[".action.dsl"]},
+		&esdlParser{&amf3Parser{ext: ".esdl", keys: keys[".esdl"]}},
+		&hxParser{},
+		&scenarioParser{ext: ".md", decoder: scenarios},
+		&scenarioParser{ext: ".json", decoder: scenarios},
+	}
+	if config.RawAssets {
+		parsers = append(parsers, rawAssetParsers()...)
 	}
-	config.PathList = filepath.Clean(config.PathList)
 
-	if config.Concurrency == 0 {
-		config.Concurrency = 5
+	profileName, err := profilePath(config.Profile, config.Eliyabot)
+	if err != nil {
+		return nil, err
+	}
+	var profile *exportProfile
+	if profileName != "" {
+		profile, err = loadProfile(profileName)
+		if err != nil {
+			return nil, err
+		}
+		parsers = append(parsers, profile.parsers()...)
 	}
 
-	parsers := []parser{
-		&orderedmapParser{},
-		&amf3Parser{ext: ".action.dsl"},
-		&esdlParser{&amf3Parser{ext: ".esdl"}},
-	}
-
-	if config.Eliyabot {
-		parsers = append(
-			parsers,
-			&charPngParser{
-				pngParser:    &pngParser{},
-				srcTemplate:  "character/%s/ui/full_shot_1440_1920_0",
-				destTemplate: "eliyabot/chars/%s/full_shot_0",
-				width:        500,
-				height:       500,
-			},
-			&charPngParser{
-				pngParser:    &pngParser{},
-				srcTemplate:  "character/%s/ui/full_shot_1440_1920_1",
-				destTemplate: "eliyabot/chars/%s/full_shot_1",
-				width:        500,
-				height:       500,
-			},
-			&charPngParser{
-				pngParser:    &pngParser{},
-				srcTemplate:  "character/%s/ui/square_0",
-				destTemplate: "eliyabot/chars/%s/square_0",
-				width:        82,
-				height:       82,
-			},
-			&charPngParser{
-				pngParser:    &pngParser{},
-				srcTemplate:  "character/%s/ui/square_1",
-				destTemplate: "eliyabot/chars/%s/square_1",
-				width:        82,
-				height:       82,
-			},
-		)
-	}
-
-	return &Extractor{config: config, parsers: parsers}, nil
+	return &Extractor{config: config, parsers: parsers, schemas: omParser.schemas, profile: profile, keys: keys}, nil
 }
 
 func (extractor *Extractor) readPathList() ([]string, error) {
@@ -151,22 +288,27 @@ func (extractor *Extractor) readPathList() ([]string, error) {
 	var pl []string
 	scanner := bufio.NewScanner(f)
 	for scanner.Scan() {
-		pl = append(pl, scanner.Text())
+		pl = append(pl, strings.TrimSpace(scanner.Text()))
 	}
 	return pl, scanner.Err()
 }
 
-func (extractor *Extractor) writePathList(pl []string) error {
+func (extractor *Extractor) writePathList(pl []string, out sink) (err error) {
 	sort.Strings(pl)
 
+	// the path list is stored alongside outputs in archives
+	if archiveFormat(extractor.config.DestPath) != "" {
+		return out.write(defaultPathList, []byte(strings.Join(pl, "\n")+"\n"))
+	}
+
 	f, err := os.OpenFile(extractor.config.PathList, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
 	if err != nil {
 		return fmt.Errorf("writePathList: open error, path=%s, %w", extractor.config.PathList, err)
 	}
 	defer func() {
-		err := f.Close()
-		if err != nil {
-			log.Fatal(fmt.Errorf("writePathList: close error, path=%s, %w", extractor.config.PathList, err))
+		closeErr := f.Close()
+		if closeErr != nil && err == nil {
+			err = fmt.Errorf("writePathList: close error, path=%s, %w", extractor.config.PathList, closeErr)
 		}
 	}()
 
@@ -185,59 +327,46 @@ func (extractor *Extractor) writePathList(pl []string) error {
 	return err
 }
 
-func (extractor *Extractor) extractChars() ([]string, error) {
+// readMasterTable reads and parses an orderedmap master table from the dump.
+func readMasterTable(path string, config *ExtractorConfig) (*gabs.Container, error) {
 	p := orderedmapParser{}
-	src, err := p.getSrc("character/character", extractor.config)
+	src, err := p.getSrc(path, config)
 	if err != nil {
 		return nil, err
 	}
 
-	srcFile, err := os.Open(src)
+	data, err := fs.ReadFile(config.srcFS(), src)
 	if err != nil {
-		return nil, fmt.Errorf("extractChars: src open error, src=%s, %w", src, err)
+		return nil, fmt.Errorf("readMasterTable: src read error, src=%s, %w", src, err)
 	}
-	defer srcFile.Close()
-
-	data, err := io.ReadAll(srcFile)
-	if err != nil {
-		return nil, fmt.Errorf("extractChars: src read error, src=%s, %w", src, err)
-	}
-	data, err = p.parse(data, extractor.config)
+	// positional string values regardless of extraction options
+	data, err = p.parse(path, data, &ExtractorConfig{})
 	if err != nil {
-		return nil, fmt.Errorf("extractChars: src parse error, src=%s, %w", src, err)
+		return nil, fmt.Errorf("readMasterTable: src parse error, src=%s, %w", src, err)
 	}
 
 	jsonParsed, err := gabs.ParseJSON(data)
 	if err != nil {
-		return nil, fmt.Errorf("extractChars: json parse error, src=%s, %w", src, err)
+		return nil, fmt.Errorf("readMasterTable: json parse error, src=%s, %w", src, err)
 	}
 
-	var output []string
-	for id, char := range jsonParsed.ChildrenMap() {
-		devname, ok := char.Path("0.0").Data().(string)
-		if !ok {
-			return nil, fmt.Errorf("extractChars: unable to parse devname, id=%s", id)
-		}
-		output = append(output, devname)
-	}
-
-	return output, nil
+	return jsonParsed, nil
 }
 
 func (extractor *Extractor) getInitialPaths() ([][]byte, error) {
 	paths := map[string]struct{}{}
 	if !extractor.config.NoDefaultPaths {
-		for _, p := range strings.Split(assets.PathList, "\n") {
+		for _, p := range defaultPaths() {
 			paths[p] = struct{}{}
 		}
 	}
-	if extractor.config.Eliyabot {
-		chars, err := extractor.extractChars()
+	if extractor.profile != nil {
+		keys, err := extractor.profile.keys(extractor.config)
 		if err != nil {
 			return nil, err
 		}
 
-		for _, p := range chars {
+		for _, p := range keys {
 			paths[p] = struct{}{}
 		}
 	}
@@ -259,102 +388,317 @@ func (extractor *Extractor) getInitialPaths() ([][]byte, error) {
 	return output, nil
 }
 
-func extractFile(path string, p parser, config *ExtractorConfig) ([][]byte, error) {
+// normalizeOptions returns options normalizing JSON outputs of p.
+// Orderedmap tables keep their key order and number literals which are packed back into the source tables.
+func normalizeOptions(p parser, config *ExtractorConfig) *encoding.NormalizeOptions {
+	if _, ok := p.(*orderedmapParser); ok {
+		return &encoding.NormalizeOptions{Indent: config.Indent, KeepNumbers: true}
+	}
+	return &encoding.NormalizeOptions{Indent: config.Indent, SortKeys: config.SortKeys}
+}
+
+func extractFile(params *extractParams, p parser) ([]*pathRef, error) {
+	path, config, state := params.path, params.config, params.state
 	src, err := p.getSrc(path, config)
 	if err != nil {
 		return nil, err
 	}
+	// return nil if path is not handled by p
+	if src == "" {
+		return nil, nil
+	}
 	dest, err := p.getDest(path, config)
 	if err != nil {
 		return nil, err
 	}
 
-	srcFile, err := os.Open(src)
+	rel, err := filepath.Rel(config.DestPath, dest)
+	if err != nil {
+		return nil, err
+	}
+	write := params.filter.match(path, filepath.ToSlash(rel))
+	if !write && !config.TraverseExcluded {
+		return nil, nil
+	}
+	if !write {
+		// excluded files are only parsed to discover paths
+		state = nil
+	}
+	// already dispatched files are only parsed again to follow references, unless unchanged in state
+	cache := state
+	if params.follow {
+		write = false
+		state = nil
+	}
+
+	fsys := config.srcFS()
+	srcFile, err := fsys.Open(src)
 	if err != nil {
 		// return nil if srcFile does not exist
-		if errors.Is(err, os.ErrNotExist) {
+		if errors.Is(err, fs.ErrNotExist) {
 			return nil, nil
 		}
 		return nil, fmt.Errorf("extractFile: src open error, src=%s, dest=%s, %w", src, dest, err)
 	}
 	defer srcFile.Close()
 
+	var info fs.FileInfo
+	var deps map[string]string
+	if cache != nil {
+		info, err = srcFile.Stat()
+		if err != nil {
+			return nil, fmt.Errorf("extractFile: src stat error, src=%s, dest=%s, %w", src, dest, err)
+		}
+
+		if dp, ok := p.(dependentParser); ok {
+			srcs, err := dp.dependencies(path, config)
+			if err != nil {
+				return nil, err
+			}
+			deps, err = cache.dependencies(fsys, srcs)
+			if err != nil {
+				return nil, fmt.Errorf("extractFile: state error, src=%s, dest=%s, %w", src, dest, err)
+			}
+		}
+
+		// skip parsing unchanged src, only follow its outputs in this or previous extractions
+		var entry *extractStateEntry
+		if params.follow {
+			entry = cache.current(dest)
+		}
+		if entry == nil {
+			entry, err = cache.cached(fsys, dest, src, info, deps)
+			if err != nil {
+				return nil, fmt.Errorf("extractFile: state error, src=%s, dest=%s, %w", src, dest, err)
+			}
+		}
+		if entry != nil {
+			if entry.Output != nil && state != nil {
+				params.manifest.add(entry.Output)
+			}
+			return entry.refs(), nil
+		}
+	}
+
 	data, err := io.ReadAll(srcFile)
 	if err != nil {
 		return nil, fmt.Errorf("extractFile: src read error, src=%s, dest=%s, %w", src, dest, err)
 	}
-	data, err = p.parse(data, config)
+	var checksum []byte
+	if state != nil {
+		// parse may modify data in place
+		checksum, err = sha256Checksum(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+	}
+	var ext string
+	if fp, ok := p.(fallbackParser); ok {
+		data, ext, err = fp.parseFallback(path, data, config)
+	} else {
+		data, err = p.parse(path, data, config)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("extractFile: src parse error, src=%s, dest=%s, %w", src, dest, err)
 	}
-
-	os.MkdirAll(filepath.Dir(dest), 0777)
-	destFile, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
-	if err != nil {
-		return nil, fmt.Errorf("extractFile: dest open error, src=%s, dest=%s, %w", src, dest, err)
+	// state entries stay keyed by the dest of getDest
+	outputDest := dest
+	if ext != "" {
+		outputDest = strings.TrimSuffix(dest, filepath.Ext(dest)) + ext
+		rel = strings.TrimSuffix(rel, filepath.Ext(rel)) + ext
 	}
-	defer func() {
-		err := destFile.Close()
+	if config.Normalize && strings.EqualFold(filepath.Ext(outputDest), ".json") {
+		data, err = encoding.NormalizeJSON(data, normalizeOptions(p, config))
 		if err != nil {
-			log.Fatal(fmt.Errorf("extractFile: dest close error, src=%s, dest=%s, %w", src, dest, err))
+			return nil, fmt.Errorf("extractFile: normalize error, src=%s, dest=%s, %w", src, dest, err)
 		}
-	}()
+	}
+
+	var written *manifestEntry
+	if write {
+		err = params.sink.write(filepath.ToSlash(rel), data)
+		if err != nil {
+			return nil, fmt.Errorf("extractFile: dest write error, src=%s, dest=%s, %w", src, dest, err)
+		}
+		// outputs are also recorded in state for manifests of later incremental extractions
+		if params.manifest != nil || state != nil {
+			written, err = newManifestEntry(filepath.ToSlash(rel), path, parserName(p), src, data)
+			if err != nil {
+				return nil, err
+			}
+			params.manifest.add(written)
+		}
+	}
 
-	_, err = io.Copy(destFile, bytes.NewReader(data))
+	output, err := p.output(data, config)
 	if err != nil {
-		return nil, fmt.Errorf("extractFile: dest write error, src=%s, dest=%s, %w", src, dest, err)
+		return nil, err
+	}
+	var refs []*pathRef
+	if len(config.GraphPaths) > 0 {
+		refs = findPathRefs(data, output)
+	} else {
+		refs = newPathRefs(output)
+	}
+
+	if state != nil {
+		entry := &extractStateEntry{
+			Path:    path,
+			Src:     src,
+			Size:    info.Size(),
+			ModTime: info.ModTime().UnixNano(),
+			SHA256:  hex.EncodeToString(checksum),
+			Dest:    outputDest,
+			Outputs: refs,
+			Deps:    deps,
+			Output:  written,
+		}
+		state.set(dest, entry)
 	}
 
-	return p.output(data, config)
+	return refs, nil
 }
 
 type extractParams struct {
 	path    string
 	parsers []parser
 	config  *ExtractorConfig
+	// state is nil if extraction is not incremental
+	state  *extractState
+	filter *pathFilter
+	sink   sink
+	// manifest is nil if no manifest is written
+	manifest *outputManifest
+	// report is nil if extraction aborts on errors
+	report *failureReport
+	// depth is the number of references followed from initial paths
+	depth int
+	// follow is true if path was already dispatched and is only parsed again to follow references
+	follow bool
+}
+
+// recoverExtractFile extracts a file like extractFile, returning panics of parsers on malformed sources as errors.
+func recoverExtractFile(params *extractParams, p parser) (refs []*pathRef, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("extractFile: parser panic, path=%s, parser=%s, panic=%v", params.path, parserName(p), r)
+		}
+	}()
+	return extractFile(params, p)
 }
 
-func extractPath(i *concurrency.Item[*extractParams, [][]byte]) ([][]byte, error) {
-	var output [][][]byte
+func extractPath(i *concurrency.Item[*extractParams, []*parserOutput]) ([]*parserOutput, error) {
+	var output []*parserOutput
 	for _, p := range i.Data.parsers {
 
-		o, err := extractFile(i.Data.path, p, i.Data.config)
+		o, err := recoverExtractFile(i.Data, p)
 		if err != nil {
-			return nil, err
+			if i.Data.report == nil {
+				return nil, err
+			}
+			// failures were already reported when path was first dispatched
+			if i.Data.follow {
+				continue
+			}
+			// keep going with other parsers and paths
+			src, _ := p.getSrc(i.Data.path, i.Data.config)
+			i.Data.report.add(&extractFailure{Path: i.Data.path, Parser: parserName(p), Source: src, Error: err.Error()})
+			log.Printf("[WARN] %v\n", err)
+			continue
 		}
 		// o = nil if file does not exist with format p
 		if o != nil {
-			output = append(output, o)
+			output = append(output, &parserOutput{parser: parserName(p), refs: o})
 		}
 	}
-	return encoding.Flatten(output), nil
+	return output, nil
 }
 
-func (extractor *Extractor) extract() error {
-	err := os.MkdirAll(extractor.config.DestPath, 0777)
+func (extractor *Extractor) extract() (err error) {
+	out, err := newSink(extractor.config.DestPath)
 	if err != nil {
 		return err
 	}
+	defer func() {
+		if err != nil {
+			out.discard()
+		}
+	}()
 
 	paths, err := extractor.getInitialPaths()
 	if err != nil {
 		return err
 	}
-	items := []*concurrency.Item[*extractParams, [][]byte]{{Output: paths}}
-	seenPaths := map[string]bool{}
+
+	var state *extractState
+	if extractor.config.Incremental {
+		fingerprint, err := stateFingerprint(extractor.config, extractor.schemas, extractor.profile, extractor.keys)
+		if err != nil {
+			return err
+		}
+		state, err = readExtractState(extractor.config.StatePath, fingerprint)
+		if err != nil {
+			return err
+		}
+	}
+
+	filter, err := newPathFilter(extractor.config.Include, extractor.config.Exclude)
+	if err != nil {
+		return err
+	}
+
+	var manifest *outputManifest
+	if extractor.config.ManifestPath != "" {
+		manifest = newOutputManifest()
+	}
+
+	var report *failureReport
+	if extractor.config.KeepGoing {
+		report = newFailureReport()
+	}
+
+	var graph *extractGraph
+	if len(extractor.config.GraphPaths) > 0 {
+		graph = newExtractGraph()
+	}
+
+	items := []*concurrency.Item[*extractParams, []*parserOutput]{{Output: []*parserOutput{{refs: newPathRefs(paths)}}}}
+	// seenPaths maps paths to the lowest depth they were reached at
+	seenPaths := map[string]int{}
 
 	err = concurrency.Dispatcher(
-		func(i *concurrency.Item[*extractParams, [][]byte]) ([]*concurrency.Item[*extractParams, [][]byte], error) {
-			var output []*concurrency.Item[*extractParams, [][]byte]
-			if i.Output != nil {
-				for _, p := range i.Output {
-					if !seenPaths[string(p)] {
-						seenPaths[string(p)] = true
-						output = append(output, &concurrency.Item[*extractParams, [][]byte]{
+		func(i *concurrency.Item[*extractParams, []*parserOutput]) ([]*concurrency.Item[*extractParams, []*parserOutput], error) {
+			var output []*concurrency.Item[*extractParams, []*parserOutput]
+			depth := 0
+			// initial paths have no parent
+			if i.Data != nil {
+				depth = i.Data.depth + 1
+				if graph != nil && !i.Data.follow {
+					graph.add(i.Data.path, i.Output)
+				}
+			}
+			if extractor.config.MaxDepth != 0 && depth > max(extractor.config.MaxDepth, 0) {
+				return nil, nil
+			}
+
+			for _, o := range i.Output {
+				for _, ref := range o.refs {
+					seenDepth, seen := seenPaths[ref.Path]
+					// paths reached at a lower depth are dispatched again only to follow more references
+					if !seen || (extractor.config.MaxDepth != 0 && depth < seenDepth) {
+						seenPaths[ref.Path] = depth
+						output = append(output, &concurrency.Item[*extractParams, []*parserOutput]{
 							Data: &extractParams{
-								path:    string(p),
-								parsers: extractor.parsers,
-								config:  extractor.config,
+								path:     ref.Path,
+								parsers:  extractor.parsers,
+								config:   extractor.config,
+								state:    state,
+								filter:   filter,
+								sink:     out,
+								manifest: manifest,
+								report:   report,
+								depth:    depth,
+								follow:   seen,
 							},
 							Output: nil,
 							Err:    nil,
@@ -372,13 +716,56 @@ func (extractor *Extractor) extract() error {
 		return err
 	}
 
+	if state != nil {
+		err = state.write(extractor.config.StatePath)
+		if err != nil {
+			return err
+		}
+	}
+
+	if manifest != nil {
+		destDir := extractor.config.DestPath
+		if archiveFormat(destDir) != "" {
+			destDir = ""
+		}
+		err = manifest.write(extractor.config.ManifestPath, destDir, extractor.config.Indent)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, gp := range extractor.config.GraphPaths {
+		err = graph.write(gp, extractor.config.Indent)
+		if err != nil {
+			return err
+		}
+	}
+
 	var pathList []string
 	for p := range seenPaths {
 		if len(p) > 0 {
 			pathList = append(pathList, p)
 		}
 	}
-	return extractor.writePathList(pathList)
+	err = extractor.writePathList(pathList, out)
+	if err != nil {
+		return err
+	}
+	err = out.close()
+	if err != nil {
+		return err
+	}
+
+	if report != nil {
+		err = report.write(extractor.config.ReportPath, extractor.config.Indent)
+		if err != nil {
+			return err
+		}
+		if n := report.len(); n > 0 {
+			return fmt.Errorf("extract: %d failures, report=%s, %w", n, extractor.config.ReportPath, ErrPartialFailure)
+		}
+	}
+	return nil
 }
 
 // ExtractAssets extracts assets from downloaded files.
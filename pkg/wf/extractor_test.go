@@ -0,0 +1,311 @@
+package wf
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"testing/fstest"
+
+	"github.com/blead/wfax/pkg/concurrency"
+	"github.com/blead/wfax/pkg/encoding"
+)
+
+// testDump returns a dump of master tables from JSON by path.
+func testDump(t *testing.T, tables map[string]string) fstest.MapFS {
+	fsys := fstest.MapFS{}
+	for p, js := range tables {
+		h, err := sha1Digest(toMasterTablePath(p), digestSalt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := encoding.JSONToOrderedmap([]byte(js))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fsys[dumpPath(h)] = &fstest.MapFile{Data: data}
+	}
+	return fsys
+}
+
+func TestExtractCSVFallback(t *testing.T) {
+	dir := t.TempDir()
+	pathList := filepath.Join(dir, "pathlist")
+	err := os.WriteFile(pathList, []byte("a/a\nb/b\n"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	extractor, err := NewExtractor(&ExtractorConfig{
+		SrcFS: testDump(t, map[string]string{
+			"a/a": `{"1":[["x"]]}`,
+			// nested maps of different depths cannot be a single CSV
+			"b/b": `{"1":[["x"]],"2":{"3":[["y"]]}}`,
+		}),
+		DestPath:       filepath.Join(dir, "output"),
+		PathList:       pathList,
+		NoDefaultPaths: true,
+		OutputFormat:   FormatCSV,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = extractor.ExtractAssets()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]bool{
+		"a/a.csv":  true,
+		"b/b.json": true,
+		"b/b.csv":  false,
+	}
+	for p, want := range tests {
+		_, err := os.Stat(filepath.Join(dir, "output", outputOrderedMapDir, p))
+		if got := err == nil; got != want {
+			t.Errorf("%s exists = %t, want %t", p, got, want)
+		}
+	}
+}
+
+// memorySink records written files by name.
+type memorySink map[string][]byte
+
+func (s memorySink) write(name string, data []byte) error {
+	s[name] = data
+	return nil
+}
+
+func (memorySink) close() error { return nil }
+
+func (memorySink) discard() {}
+
+func TestExtractPathFollow(t *testing.T) {
+	extractor, err := NewExtractor(&ExtractorConfig{
+		SrcFS:          testDump(t, map[string]string{"a/a": `{"1":[["character/alk/ui/icon"]]}`}),
+		DestPath:       t.TempDir(),
+		NoDefaultPaths: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter, err := newPathFilter(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, follow := range []bool{false, true} {
+		out := memorySink{}
+		manifest := newOutputManifest()
+		output, err := extractPath(&concurrency.Item[*extractParams, []*parserOutput]{Data: &extractParams{
+			path:     "a/a",
+			parsers:  extractor.parsers,
+			config:   extractor.config,
+			filter:   filter,
+			sink:     out,
+			manifest: manifest,
+			follow:   follow,
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var refs []string
+		for _, o := range output {
+			for _, ref := range o.refs {
+				refs = append(refs, ref.Path)
+			}
+		}
+		if !slices.Contains(refs, "character/alk/ui/icon") {
+			t.Errorf("follow=%t refs = %v, want character/alk/ui/icon", follow, refs)
+		}
+		want := 1
+		if follow {
+			want = 0
+		}
+		if got := len(out); got != want {
+			t.Errorf("follow=%t writes = %d, want %d", follow, got, want)
+		}
+		if got := len(manifest.entries); got != len(out) {
+			t.Errorf("follow=%t manifest entries = %d, want %d", follow, got, len(out))
+		}
+	}
+}
+
+func TestExtractPathFollowState(t *testing.T) {
+	dir := t.TempDir()
+	extractor, err := NewExtractor(&ExtractorConfig{
+		SrcFS:          testDump(t, map[string]string{"a/a": `{"1":[["character/alk/ui/icon"]]}`}),
+		DestPath:       dir,
+		NoDefaultPaths: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter, err := newPathFilter(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, err := readExtractState(filepath.Join(dir, "state"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	params := &extractParams{
+		path:    "a/a",
+		parsers: extractor.parsers,
+		config:  extractor.config,
+		state:   state,
+		filter:  filter,
+		sink:    memorySink{},
+	}
+	_, err = extractPath(&concurrency.Item[*extractParams, []*parserOutput]{Data: params})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Entries) != 1 {
+		t.Fatalf("state entries = %d, want 1", len(state.Entries))
+	}
+	// followed paths take outputs from state instead of parsing again
+	for _, entry := range state.Entries {
+		entry.Outputs = newPathRefs([][]byte{[]byte("cached/path")})
+	}
+
+	params.follow = true
+	output, err := extractPath(&concurrency.Item[*extractParams, []*parserOutput]{Data: params})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(output) != 1 || len(output[0].refs) != 1 || output[0].refs[0].Path != "cached/path" {
+		t.Errorf("followed output = %v, want cached/path from state", output)
+	}
+}
+
+func TestExtractLayeredSrcPaths(t *testing.T) {
+	dir := t.TempDir()
+	// roots are not split by os.PathListSeparator
+	base := filepath.Join(dir, "dump:1.500.0")
+	diff := filepath.Join(dir, "diff:1.550.0")
+	layers := map[string]fstest.MapFS{
+		base: testDump(t, map[string]string{"a/a": `{"1":[["base"]]}`, "b/b": `{"1":[["base"]]}`}),
+		diff: testDump(t, map[string]string{"a/a": `{"1":[["diff"]]}`}),
+	}
+	for root, fsys := range layers {
+		for name, f := range fsys {
+			dest := filepath.Join(root, filepath.FromSlash(name))
+			err := os.MkdirAll(filepath.Dir(dest), 0777)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = os.WriteFile(dest, f.Data, 0666)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	pathList := filepath.Join(dir, "pathlist")
+	err := os.WriteFile(pathList, []byte("a/a\nb/b\n"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	extractor, err := NewExtractor(&ExtractorConfig{
+		SrcPath:        base,
+		SrcPaths:       []string{diff},
+		DestPath:       filepath.Join(dir, "output"),
+		PathList:       pathList,
+		NoDefaultPaths: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = extractor.ExtractAssets()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]string{
+		"a/a.json": `{"1":[["diff"]]}`,
+		"b/b.json": `{"1":[["base"]]}`,
+	}
+	for p, want := range tests {
+		data, err := os.ReadFile(filepath.Join(dir, "output", outputOrderedMapDir, p))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		err = json.Compact(&buf, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != want {
+			t.Errorf("%s = %s, want %s", p, got, want)
+		}
+	}
+}
+
+func TestNormalizeRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	schemaPath := filepath.Join(dir, "schema.json")
+	err := os.WriteFile(schemaPath, []byte(`{"a/a":{"columns":[{"index":0,"name":"x","type":"number"}]}}`), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pathList := filepath.Join(dir, "pathlist")
+	err = os.WriteFile(pathList, []byte("a/a\n"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dump := testDump(t, map[string]string{"a/a": `{"2":[["1.50"]],"1":[["1e3"]]}`})
+
+	extractor, err := NewExtractor(&ExtractorConfig{
+		SrcFS:          dump,
+		DestPath:       filepath.Join(dir, "output"),
+		PathList:       pathList,
+		NoDefaultPaths: true,
+		Indent:         2,
+		TypedValues:    true,
+		SchemaPath:     schemaPath,
+		SortKeys:       true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = extractor.ExtractAssets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// orderedmap tables keep their source key order under SortKeys
+	data, err := os.ReadFile(filepath.Join(dir, "output", outputOrderedMapDir, "a", "a.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i, j := bytes.Index(data, []byte(`"2"`)), bytes.Index(data, []byte(`"1"`)); i < 0 || j < 0 || i > j {
+		t.Errorf("orderedmap table = %s, want source key order", data)
+	}
+
+	packer, err := NewPacker(&PackerConfig{
+		SrcPath:    filepath.Join(dir, "output"),
+		DestPath:   filepath.Join(dir, "packed"),
+		SchemaPath: schemaPath,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = packer.PackAssets()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, f := range dump {
+		got, err := os.ReadFile(filepath.Join(dir, "packed", filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, f.Data) {
+			t.Errorf("packed %s differs from source", name)
+		}
+	}
+}
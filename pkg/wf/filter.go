@@ -0,0 +1,111 @@
+package wf
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const regexFilterPrefix = "re:"
+
+// globToRegexp converts a glob pattern into an anchored regular expression.
+// * and ? do not match /, ** matches any characters including /, [!...] matches characters not in the class,
+// and a trailing / matches everything beneath.
+func globToRegexp(glob string) string {
+	if strings.HasSuffix(glob, "/") {
+		glob += "**"
+	}
+
+	var output strings.Builder
+	output.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				output.WriteString(".*")
+				i++
+			} else {
+				output.WriteString("[^/]*")
+			}
+		case '?':
+			output.WriteString("[^/]")
+		case '[':
+			// character classes are passed through, with [!...] negated as [^...]
+			end := strings.IndexByte(glob[i:], ']')
+			if end < 0 {
+				output.WriteString(regexp.QuoteMeta(glob[i:]))
+				i = len(glob)
+			} else {
+				class := glob[i : i+end+1]
+				if strings.HasPrefix(class, "[!") {
+					class = "[^" + class[2:]
+				}
+				output.WriteString(class)
+				i += end
+			}
+		default:
+			output.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	output.WriteString("$")
+	return output.String()
+}
+
+// compileFilters compiles glob patterns, or regular expressions if prefixed with re:.
+func compileFilters(patterns []string) ([]*regexp.Regexp, error) {
+	var output []*regexp.Regexp
+	for _, p := range patterns {
+		expr := globToRegexp(p)
+		if strings.HasPrefix(p, regexFilterPrefix) {
+			expr = strings.TrimPrefix(p, regexFilterPrefix)
+		}
+
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("compileFilters: invalid pattern, pattern=%s, %w", p, err)
+		}
+		output = append(output, re)
+	}
+	return output, nil
+}
+
+// pathFilter decides which extracted files are written.
+// Patterns are matched against asset paths and output paths relative to the destination, e.g. orderedmap/character/character.json.
+type pathFilter struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+func newPathFilter(include []string, exclude []string) (*pathFilter, error) {
+	inc, err := compileFilters(include)
+	if err != nil {
+		return nil, err
+	}
+	exc, err := compileFilters(exclude)
+	if err != nil {
+		return nil, err
+	}
+	return &pathFilter{include: inc, exclude: exc}, nil
+}
+
+func matchAny(patterns []*regexp.Regexp, values ...string) bool {
+	for _, re := range patterns {
+		for _, v := range values {
+			if re.MatchString(v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// match reports whether a file extracted from path into dest should be written.
+func (filter *pathFilter) match(path string, dest string) bool {
+	if filter == nil {
+		return true
+	}
+	if len(filter.include) > 0 && !matchAny(filter.include, path, dest) {
+		return false
+	}
+	return !matchAny(filter.exclude, path, dest)
+}
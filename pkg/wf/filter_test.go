@@ -0,0 +1,36 @@
+package wf
+
+import "testing"
+
+func TestPathFilter(t *testing.T) {
+	filter, err := newPathFilter(
+		[]string{"orderedmap/", "character/alk/**", "re:^story/.*/scenario$"},
+		[]string{"character/*/voice/**", "**.tsv", "character/alk/ui/square_[!0]"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		dest string
+		want bool
+	}{
+		{"item/equipment", "orderedmap/item/equipment.json", true},
+		{"item/equipment", "orderedmap/item/equipment.tsv", false},
+		{"character/alk/ui/square_0", "assets/character/alk/ui/square_0.png", true},
+		{"character/alk/ui/square_1", "assets/character/alk/ui/square_1.png", false},
+		{"character/alk/voice/001", "assets/character/alk/voice/001.mp3", false},
+		{"character/bob/ui/square_0", "assets/character/bob/ui/square_0.png", false},
+		{"story/a/b/scenario", "assets/story/a/b/scenario.md", true},
+	}
+	for _, tt := range tests {
+		if got := filter.match(tt.path, tt.dest); got != tt.want {
+			t.Errorf("match(%q, %q) = %v, want %v", tt.path, tt.dest, got, tt.want)
+		}
+	}
+
+	if (*pathFilter)(nil).match("any", "assets/any") != true {
+		t.Errorf("nil filter should match all paths")
+	}
+}
@@ -0,0 +1,244 @@
+package wf
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// layeredFS reads files from a stack of filesystems, later layers take precedence over earlier ones.
+// Directories are merged across layers.
+type layeredFS []fs.FS
+
+func (layers layeredFS) Open(name string) (fs.File, error) {
+	for i := len(layers) - 1; i >= 0; i-- {
+		f, err := layers[i].Open(name)
+		if err == nil {
+			return f, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+func (layers layeredFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries := map[string]fs.DirEntry{}
+	found := false
+	for _, layer := range layers {
+		des, err := fs.ReadDir(layer, name)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		found = true
+		for _, de := range des {
+			entries[de.Name()] = de
+		}
+	}
+	if !found {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	output := make([]fs.DirEntry, 0, len(entries))
+	for _, de := range entries {
+		output = append(output, de)
+	}
+	sort.Slice(output, func(i, j int) bool { return output[i].Name() < output[j].Name() })
+	return output, nil
+}
+
+// mountFS serves fsys under the directory dir, e.g. upload/ab/cdef is read from ab/cdef of fsys.
+type mountFS struct {
+	dir  string
+	fsys fs.FS
+}
+
+// rel returns the path of name inside the mounted filesystem.
+func (m *mountFS) rel(name string) (string, bool) {
+	if name == m.dir {
+		return ".", true
+	}
+	if strings.HasPrefix(name, m.dir+"/") {
+		return strings.TrimPrefix(name, m.dir+"/"), true
+	}
+	return "", false
+}
+
+func (m *mountFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	// parent directories of the mount point are only listed by ReadDir
+	if name == "." {
+		return m.fsys.Open(".")
+	}
+	rel, ok := m.rel(name)
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return m.fsys.Open(rel)
+}
+
+func (m *mountFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if rel, ok := m.rel(name); ok {
+		return fs.ReadDir(m.fsys, rel)
+	}
+
+	// list the next directory of the mount point
+	prefix := name + "/"
+	if name == "." {
+		prefix = ""
+	}
+	if strings.HasPrefix(m.dir, prefix) {
+		child, _, _ := strings.Cut(strings.TrimPrefix(m.dir, prefix), "/")
+		info, err := fs.Stat(m.fsys, ".")
+		if err != nil {
+			return nil, err
+		}
+		return []fs.DirEntry{fs.FileInfoToDirEntry(&renamedFileInfo{FileInfo: info, name: child})}, nil
+	}
+	return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+}
+
+type renamedFileInfo struct {
+	fs.FileInfo
+	name string
+}
+
+func (info *renamedFileInfo) Name() string {
+	return info.name
+}
+
+// openZipFS opens a downloaded zip archive with its production/* directories mounted as the dump asset directory,
+// the same layout produced by fetch.
+func openZipFS(name string) (fs.FS, error) {
+	archive, err := zip.OpenReader(name)
+	if err != nil {
+		return nil, err
+	}
+
+	prefixes := map[string]bool{}
+	for _, zf := range archive.File {
+		// production/[^/]* is replaced by modPath
+		if dir, rest, ok := strings.Cut(zf.Name, "/"); ok && dir == "production" {
+			version, _, _ := strings.Cut(rest, "/")
+			prefixes[path.Join(dir, version)] = true
+		}
+	}
+
+	// files outside of production/* keep their paths
+	layers := layeredFS{&archive.Reader}
+	for p := range prefixes {
+		sub, err := fs.Sub(&archive.Reader, p)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, &mountFS{dir: dumpAssetDir, fsys: sub})
+	}
+	return layers, nil
+}
+
+// dirFS layers the dump roots srcPaths on top of srcPath, later roots take precedence per file.
+func dirFS(srcPath string, srcPaths []string) fs.FS {
+	if len(srcPaths) == 0 {
+		return os.DirFS(srcPath)
+	}
+
+	layers := layeredFS{os.DirFS(srcPath)}
+	for _, r := range srcPaths {
+		layers = append(layers, os.DirFS(r))
+	}
+	return layers
+}
+
+// workingPath cleans p, defaulting to the working directory if p is empty or ".".
+func workingPath(p string) (string, error) {
+	if p == "" || p == "." {
+		return os.Getwd()
+	}
+	return filepath.Clean(p), nil
+}
+
+// sourceConfig cleans the source paths of a configuration, defaulting srcPath to the working directory.
+// Unless srcFS is set, it opens srcPaths and archives layered on top of srcPath, or returns nil to read srcPath directly.
+func sourceConfig(srcPath string, srcPaths []string, srcFS fs.FS, archives []string) (string, fs.FS, error) {
+	srcPath, err := workingPath(srcPath)
+	if err != nil {
+		return "", nil, err
+	}
+	for i, p := range srcPaths {
+		srcPaths[i] = filepath.Clean(p)
+	}
+	if srcFS == nil && (len(srcPaths) > 0 || len(archives) > 0) {
+		srcFS, err = openSource(srcPath, srcPaths, archives)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	return srcPath, srcFS, nil
+}
+
+// openSource layers the dump roots srcPaths and then zip archives in order of precedence on top of srcPath.
+// Archives are kept open for the lifetime of the returned filesystem.
+func openSource(srcPath string, srcPaths []string, archives []string) (fs.FS, error) {
+	layers := layeredFS{dirFS(srcPath, srcPaths)}
+	for _, a := range archives {
+		zfs, err := openZipFS(a)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, zfs)
+	}
+
+	if len(layers) == 1 {
+		return layers[0], nil
+	}
+	return layers, nil
+}
+
+// srcFS returns the filesystem sources are read from, the dump roots SrcPath and SrcPaths if SrcFS is not set.
+func (config *ExtractorConfig) srcFS() fs.FS {
+	if config.SrcFS != nil {
+		return config.SrcFS
+	}
+	return dirFS(config.SrcPath, config.SrcPaths)
+}
+
+// srcFS returns the filesystem extracted files are read from, the directory SrcPath if SrcFS is not set.
+func (config *PackerConfig) srcFS() fs.FS {
+	if config.SrcFS != nil {
+		return config.SrcFS
+	}
+	return os.DirFS(config.SrcPath)
+}
+
+// readAsset reads and parses a file of an asset, or returns nil if it does not exist and is optional.
+func readAsset(p string, parser parser, config *ExtractorConfig, optional bool) ([]byte, string, error) {
+	src, err := parser.getSrc(p, config)
+	if err != nil {
+		return nil, "", err
+	}
+
+	data, err := fs.ReadFile(config.srcFS(), src)
+	if err != nil {
+		if optional && errors.Is(err, fs.ErrNotExist) {
+			return nil, src, nil
+		}
+		return nil, src, fmt.Errorf("readAsset: src read error, path=%s, src=%s, %w", p, src, err)
+	}
+	data, err = parser.parse(p, data, &ExtractorConfig{})
+	if err != nil {
+		return nil, src, fmt.Errorf("readAsset: src parse error, path=%s, src=%s, %w", p, src, err)
+	}
+	return data, src, nil
+}
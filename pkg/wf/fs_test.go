@@ -0,0 +1,106 @@
+package wf
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/blead/wfax/pkg/encoding"
+)
+
+func TestExtractFromFS(t *testing.T) {
+	master := func(p string) string {
+		h, err := sha1Digest(toMasterTablePath(p), digestSalt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return dumpPath(h)
+	}
+	table := func(json string) []byte {
+		data, err := encoding.JSONToOrderedmap([]byte(json))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "archive.zip")
+	f, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := zip.NewWriter(f)
+	// archives store assets under production/<version> instead of upload
+	zw, err := w.Create("production/v2" + master("b/b")[len(dumpAssetDir):])
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw.Write(table(`[["overridden"]]`))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	zfs, err := openZipFS(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys := layeredFS{
+		fstest.MapFS{
+			master("a/a"): {Data: table(`[["a","b/b"]]`)},
+			master("b/b"): {Data: table(`[["b"]]`)},
+		},
+		zfs,
+	}
+
+	extractor, err := NewExtractor(&ExtractorConfig{
+		SrcFS:          fsys,
+		DestPath:       filepath.Join(dir, "output"),
+		PathList:       filepath.Join(dir, "pathlist"),
+		NoDefaultPaths: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(extractor.config.PathList, []byte("a/a\n"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = extractor.ExtractAssets()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]string{
+		"a/a.json": `[["a","b/b"]]`,
+		"b/b.json": `[["overridden"]]`,
+	}
+	for p, want := range tests {
+		got, err := os.ReadFile(filepath.Join(dir, "output", outputOrderedMapDir, p))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var compact bytes.Buffer
+		err = json.Compact(&compact, got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if compact.String() != want {
+			t.Errorf("extracted %s = %s, want %s", p, compact.String(), want)
+		}
+	}
+
+	entries, err := layeredFS{fsys}.ReadDir(dumpAssetDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("ReadDir(%s) = %d entries, want 2", dumpAssetDir, len(entries))
+	}
+}
@@ -0,0 +1,250 @@
+package wf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const graphDOTExt = ".dot"
+
+// pathRef is a path referenced by an extracted asset.
+type pathRef struct {
+	Path string `json:"path"`
+	// Field is the location of the reference in the parsed output, e.g. 1.0.3 for key 1, row 0, column 3 of a table.
+	Field string `json:"field,omitempty"`
+}
+
+// parserOutput is paths referenced by an asset extracted with a parser.
+type parserOutput struct {
+	parser string
+	refs   []*pathRef
+}
+
+// parserName returns a stable name of p used in provenance graphs.
+func parserName(p parser) string {
+	switch val := p.(type) {
+	case *orderedmapParser:
+		return "orderedmap"
+	case *amf3Parser:
+		return strings.TrimPrefix(val.ext, ".")
+	case *esdlParser:
+		return "esdl"
+	case *hxParser:
+		return "hx"
+	case *scenarioParser:
+		return "scenario" + val.ext
+	case *profileParser:
+		return val.profile
+	case *pngParser:
+		return "png"
+	case *rawParser:
+		return strings.TrimPrefix(val.ext, ".")
+	}
+	return fmt.Sprintf("%T", p)
+}
+
+func newPathRefs(paths [][]byte) []*pathRef {
+	refs := []*pathRef{}
+	for _, p := range paths {
+		refs = append(refs, &pathRef{Path: string(p)})
+	}
+	return refs
+}
+
+type jsonString struct {
+	field string
+	value string
+}
+
+// walkJSONStrings collects string values of v with their dot-separated fields, visiting object keys in sorted order.
+func walkJSONStrings(v any, field []string, output []*jsonString) []*jsonString {
+	switch val := v.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			output = walkJSONStrings(val[k], append(field[:len(field):len(field)], k), output)
+		}
+	case []any:
+		for i, e := range val {
+			output = walkJSONStrings(e, append(field[:len(field):len(field)], strconv.Itoa(i)), output)
+		}
+	case string:
+		output = append(output, &jsonString{field: strings.Join(field, "."), value: val})
+	}
+	return output
+}
+
+// findPathRefs locates fields of paths found in data, fields are empty if data is not JSON.
+func findPathRefs(data []byte, paths [][]byte) []*pathRef {
+	fields := map[string]string{}
+
+	var v any
+	if json.Unmarshal(data, &v) == nil {
+		strs := walkJSONStrings(v, nil, nil)
+		for _, s := range strs {
+			found, _ := findAllPaths([]byte(s.value))
+			for _, p := range found {
+				if _, ok := fields[string(p)]; !ok {
+					fields[string(p)] = s.field
+				}
+			}
+		}
+
+		// paths joined with a base path, e.g. esdl actions
+		for _, p := range paths {
+			if _, ok := fields[string(p)]; ok {
+				continue
+			}
+			for _, s := range strs {
+				if strings.Contains(s.value, "/") && strings.HasSuffix(string(p), s.value) {
+					fields[string(p)] = s.field
+					break
+				}
+			}
+		}
+	}
+
+	refs := newPathRefs(paths)
+	for _, ref := range refs {
+		ref.Field = fields[ref.Path]
+	}
+	return refs
+}
+
+type graphNode struct {
+	Path    string   `json:"path"`
+	Parsers []string `json:"parsers,omitempty"`
+}
+
+type graphEdge struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Parser string `json:"parser"`
+	Field  string `json:"field,omitempty"`
+}
+
+// extractGraph records which extracted assets referenced each path.
+type extractGraph struct {
+	nodes map[string]*graphNode
+	edges map[graphEdge]bool
+}
+
+func newExtractGraph() *extractGraph {
+	return &extractGraph{nodes: map[string]*graphNode{}, edges: map[graphEdge]bool{}}
+}
+
+func (graph *extractGraph) node(path string) *graphNode {
+	n, ok := graph.nodes[path]
+	if !ok {
+		n = &graphNode{Path: path}
+		graph.nodes[path] = n
+	}
+	return n
+}
+
+// add records an asset extracted from path and paths it referenced.
+func (graph *extractGraph) add(path string, outputs []*parserOutput) {
+	for _, o := range outputs {
+		n := graph.node(path)
+		n.Parsers = append(n.Parsers, o.parser)
+		for _, ref := range o.refs {
+			graph.node(ref.Path)
+			graph.edges[graphEdge{From: path, To: ref.Path, Parser: o.parser, Field: ref.Field}] = true
+		}
+	}
+}
+
+func (graph *extractGraph) sorted() ([]*graphNode, []*graphEdge) {
+	nodes := make([]*graphNode, 0, len(graph.nodes))
+	for _, n := range graph.nodes {
+		sort.Strings(n.Parsers)
+		nodes = append(nodes, n)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Path < nodes[j].Path })
+
+	edges := make([]*graphEdge, 0, len(graph.edges))
+	for e := range graph.edges {
+		e := e
+		edges = append(edges, &e)
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		a, b := edges[i], edges[j]
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		if a.To != b.To {
+			return a.To < b.To
+		}
+		if a.Parser != b.Parser {
+			return a.Parser < b.Parser
+		}
+		return a.Field < b.Field
+	})
+
+	return nodes, edges
+}
+
+func quoteDOT(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+func (graph *extractGraph) marshalDOT() []byte {
+	nodes, edges := graph.sorted()
+
+	var output bytes.Buffer
+	output.WriteString("digraph wfax {\n")
+	output.WriteString("\trankdir=LR;\n")
+	output.WriteString("\tnode [shape=box];\n")
+	for _, n := range nodes {
+		label := n.Path
+		if len(n.Parsers) > 0 {
+			label += "\n" + strings.Join(n.Parsers, ", ")
+		} else {
+			label += "\n(not extracted)"
+		}
+		fmt.Fprintf(&output, "\t%s [label=%s];\n", quoteDOT(n.Path), quoteDOT(label))
+	}
+	for _, e := range edges {
+		label := e.Parser
+		if e.Field != "" {
+			label += " " + e.Field
+		}
+		fmt.Fprintf(&output, "\t%s -> %s [label=%s];\n", quoteDOT(e.From), quoteDOT(e.To), quoteDOT(label))
+	}
+	output.WriteString("}\n")
+
+	return output.Bytes()
+}
+
+func (graph *extractGraph) marshalJSON(indent int) ([]byte, error) {
+	nodes, edges := graph.sorted()
+	return marshalIndentNoEscape(struct {
+		Nodes []*graphNode `json:"nodes"`
+		Edges []*graphEdge `json:"edges"`
+	}{nodes, edges}, indent)
+}
+
+// write writes the graph as Graphviz DOT if path ends with .dot, as JSON otherwise.
+func (graph *extractGraph) write(path string, indent int) error {
+	var data []byte
+	if strings.EqualFold(filepath.Ext(path), graphDOTExt) {
+		data = graph.marshalDOT()
+	} else {
+		var err error
+		data, err = graph.marshalJSON(indent)
+		if err != nil {
+			return err
+		}
+	}
+
+	return writeFile(path, data)
+}
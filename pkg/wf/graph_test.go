@@ -0,0 +1,94 @@
+package wf
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFindPathRefs(t *testing.T) {
+	data := []byte(`{"b":[["x","character/alk/ui/square_0"]],"a":{"bH":"battle/action/enemy/","f":"boss/attack"}}`)
+	paths := [][]byte{
+		[]byte("character/alk/ui/square_0"),
+		// joined with a base path by the parser
+		[]byte("battle/action/enemy/boss/attack"),
+		[]byte("unknown/path"),
+	}
+
+	refs := findPathRefs(data, paths)
+	want := []*pathRef{
+		{Path: "character/alk/ui/square_0", Field: "b.0.1"},
+		{Path: "battle/action/enemy/boss/attack", Field: "a.f"},
+		{Path: "unknown/path", Field: ""},
+	}
+	if len(refs) != len(want) {
+		t.Fatalf("refs = %d, want %d", len(refs), len(want))
+	}
+	for i := range want {
+		if *refs[i] != *want[i] {
+			t.Errorf("refs[%d] = %+v, want %+v", i, refs[i], want[i])
+		}
+	}
+
+	// fields are empty if data is not JSON
+	refs = findPathRefs([]byte("import a/b;"), [][]byte{[]byte("a/b")})
+	if len(refs) != 1 || refs[0].Field != "" {
+		t.Errorf("refs of non-JSON data = %+v", refs)
+	}
+}
+
+func TestExtractGraphWrite(t *testing.T) {
+	graph := newExtractGraph()
+	graph.add("a/a", []*parserOutput{{parser: "orderedmap", refs: []*pathRef{{Path: "b/b", Field: "1.0.0"}}}})
+	graph.add("a/a", []*parserOutput{{parser: "png", refs: []*pathRef{}}})
+
+	dir := t.TempDir()
+	err := graph.write(filepath.Join(dir, "graph.dot"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dot, err := os.ReadFile(filepath.Join(dir, "graph.dot"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantDOT := "digraph wfax {\n" +
+		"\trankdir=LR;\n" +
+		"\tnode [shape=box];\n" +
+		"\t\"a/a\" [label=\"a/a\\norderedmap, png\"];\n" +
+		"\t\"b/b\" [label=\"b/b\\n(not extracted)\"];\n" +
+		"\t\"a/a\" -> \"b/b\" [label=\"orderedmap 1.0.0\"];\n" +
+		"}\n"
+	if string(dot) != wantDOT {
+		t.Errorf("dot = %q, want %q", dot, wantDOT)
+	}
+
+	err = graph.write(filepath.Join(dir, "graph.json"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	js, err := os.ReadFile(filepath.Join(dir, "graph.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var compact bytes.Buffer
+	err = json.Compact(&compact, js)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantJSON := `{"nodes":[{"path":"a/a","parsers":["orderedmap","png"]},{"path":"b/b"}],"edges":[{"from":"a/a","to":"b/b","parser":"orderedmap","field":"1.0.0"}]}`
+	if compact.String() != wantJSON {
+		t.Errorf("json = %s, want %s", compact.String(), wantJSON)
+	}
+
+	// fields are written as is, without HTML escaping
+	graph.add("b/b", []*parserOutput{{parser: "orderedmap", refs: []*pathRef{{Path: "c/c", Field: "<a>&b"}}}})
+	data, err := graph.marshalJSON(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(data, []byte(`"field": "<a>&b"`)) {
+		t.Errorf("json = %s, want unescaped field", data)
+	}
+}
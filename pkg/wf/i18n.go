@@ -0,0 +1,537 @@
+package wf
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const defaultI18nReportPath = ".i18n-report.json"
+
+// I18nConfig is the configuration for merging text of several regions.
+// SrcPaths are extraction output directories or archives with master tables extracted as JSON,
+// Regions name them in the same order, by their base names without archive extensions if empty.
+// Include is a list of glob patterns, or regular expressions prefixed with re:, of table paths, all tables if empty.
+// Tables are written into DestPath as JSON, or CSV if Format is csv, and rows missing from some regions are reported at ReportPath.
+type I18nConfig struct {
+	SrcPaths   []string
+	Regions    []string
+	DestPath   string
+	Include    []string
+	Format     string
+	Indent     int
+	ReportPath string
+}
+
+// DefaultI18nConfig generates a default configuration.
+func DefaultI18nConfig() *I18nConfig {
+	return &I18nConfig{
+		SrcPaths:   nil,
+		Regions:    nil,
+		DestPath:   "",
+		Include:    nil,
+		Format:     FormatJSON,
+		Indent:     0,
+		ReportPath: "",
+	}
+}
+
+// I18nMerger merges master tables of several regions.
+type I18nMerger struct {
+	config *I18nConfig
+	filter *pathFilter
+	// srcFS are filesystems of SrcPaths
+	srcFS []fs.FS
+}
+
+// NewI18nMerger creates a new merger with the supplied configuration.
+// If the configuration is nil, use DefaultI18nConfig.
+func NewI18nMerger(config *I18nConfig) (*I18nMerger, error) {
+	def := DefaultI18nConfig()
+	if def == nil {
+		return nil, fmt.Errorf("NewI18nMerger: default configuration is nil")
+	}
+
+	if config == nil {
+		config = def
+	}
+
+	if len(config.SrcPaths) < 2 {
+		return nil, fmt.Errorf("NewI18nMerger: at least 2 regions are required, src=%v", config.SrcPaths)
+	}
+	for i, p := range config.SrcPaths {
+		config.SrcPaths[i] = filepath.Clean(p)
+	}
+	if len(config.Regions) == 0 {
+		for _, p := range config.SrcPaths {
+			name := filepath.Base(p)
+			for _, ext := range []string{".zip", ".tar.gz", ".tgz"} {
+				if strings.HasSuffix(strings.ToLower(name), ext) {
+					name = name[:len(name)-len(ext)]
+				}
+			}
+			config.Regions = append(config.Regions, name)
+		}
+	}
+	if len(config.Regions) != len(config.SrcPaths) {
+		return nil, fmt.Errorf("NewI18nMerger: region count mismatch, regions=%v, src=%v", config.Regions, config.SrcPaths)
+	}
+	seen := make(map[string]bool)
+	for _, r := range config.Regions {
+		if r == "" || seen[r] {
+			return nil, fmt.Errorf("NewI18nMerger: empty or duplicate region, regions=%v", config.Regions)
+		}
+		seen[r] = true
+	}
+
+	if config.DestPath == "" || config.DestPath == "." {
+		wd, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		config.DestPath = wd
+	}
+	config.DestPath = filepath.Clean(config.DestPath)
+	if config.ReportPath == "" || config.ReportPath == "." {
+		config.ReportPath = filepath.Join(config.DestPath, defaultI18nReportPath)
+	}
+	config.ReportPath = filepath.Clean(config.ReportPath)
+
+	if config.Format == "" {
+		config.Format = def.Format
+	}
+	if config.Format != FormatJSON && config.Format != FormatCSV {
+		return nil, fmt.Errorf("NewI18nMerger: unknown format, format=%s", config.Format)
+	}
+
+	filter, err := newPathFilter(config.Include, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	srcFS := make([]fs.FS, len(config.SrcPaths))
+	for i, p := range config.SrcPaths {
+		srcFS[i] = os.DirFS(p)
+		if archiveFormat(p) != "" {
+			srcFS[i], err = openArchiveFS(p)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &I18nMerger{config: config, filter: filter, srcFS: srcFS}, nil
+}
+
+// i18nRow is a row of a table in one region, with cells by column index or name.
+type i18nRow struct {
+	columns []string
+	cells   map[string]any
+	// flat is true if the row is the only row of a flattened table, not nested in a list of rows
+	flat bool
+}
+
+func newI18nRow(v any) *i18nRow {
+	row := &i18nRow{cells: map[string]any{}}
+	switch val := v.(type) {
+	case []any:
+		for i, cell := range val {
+			c := strconv.Itoa(i)
+			row.columns = append(row.columns, c)
+			row.cells[c] = cell
+		}
+	case map[string]any:
+		for c := range val {
+			row.columns = append(row.columns, c)
+		}
+		sort.Strings(row.columns)
+		row.cells = val
+	}
+	return row
+}
+
+// i18nTable maps key paths of rows, e.g. 1.2#0 for the first row under keys 1 and 2, to rows.
+// Rows of tables which are a list of rows instead of an object have key paths without keys, e.g. #0.
+type i18nTable map[string]*i18nRow
+
+// walkI18nTable collects rows of an extracted master table, flattened tables have a single row per key path.
+func walkI18nTable(v any, keys []string, table i18nTable) {
+	switch val := v.(type) {
+	case map[string]any:
+		for k, child := range val {
+			walkI18nTable(child, append(keys[:len(keys):len(keys)], k), table)
+		}
+	case []any:
+		rows := val
+		flat := false
+		if len(val) > 0 {
+			switch val[0].(type) {
+			case []any, map[string]any:
+			default:
+				rows = []any{val}
+				flat = true
+			}
+		}
+		for i, row := range rows {
+			r := newI18nRow(row)
+			r.flat = flat
+			table[strings.Join(keys, ".")+"#"+strconv.Itoa(i)] = r
+		}
+	}
+}
+
+func readI18nTable(fsys fs.FS, p string) (i18nTable, error) {
+	data, err := fs.ReadFile(fsys, p)
+	if err != nil {
+		return nil, fmt.Errorf("readI18nTable: read error, path=%s, %w", p, err)
+	}
+	v, err := decodeJSONNumbers(data)
+	if err != nil {
+		return nil, fmt.Errorf("readI18nTable: json parse error, path=%s, %w", p, err)
+	}
+	table := i18nTable{}
+	walkI18nTable(v, nil, table)
+	return table, nil
+}
+
+// listI18nTables lists paths of master tables extracted as JSON into fsys.
+// Tables extracted as CSV are rejected since their rows cannot be matched by key path.
+func listI18nTables(fsys fs.FS) ([]string, error) {
+	var output []string
+	err := fs.WalkDir(fsys, outputOrderedMapDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		switch path.Ext(p) {
+		case "." + FormatJSON:
+			output = append(output, strings.TrimSuffix(strings.TrimPrefix(p, outputOrderedMapDir+"/"), "."+FormatJSON))
+		case "." + FormatCSV:
+			return fmt.Errorf("listI18nTables: csv tables are not supported, extract with json format, path=%s", p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+// isI18nText reports whether a cell looks like text rather than an ID or number.
+func isI18nText(cell any) bool {
+	s, ok := cell.(string)
+	if !ok {
+		return false
+	}
+	for _, r := range s {
+		if unicode.IsLetter(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// i18nMissing is a row, or a whole table if Key is empty, present in only some regions.
+type i18nMissing struct {
+	Table   string   `json:"table"`
+	Key     string   `json:"key,omitempty"`
+	Regions []string `json:"regions"`
+}
+
+// i18nMerged is a table merged across regions, with sorted key paths of its rows.
+type i18nMerged struct {
+	columns []string
+	text    []string
+	keys    []string
+	rows    map[string]*i18nRow
+}
+
+// splitI18nKey returns the keys of a key path, none for rows of a list of rows.
+func splitI18nKey(k string) []string {
+	keyPath, _, _ := strings.Cut(k, "#")
+	if keyPath == "" {
+		return nil
+	}
+	return strings.Split(keyPath, ".")
+}
+
+// mergeI18nTable merges rows of a table by key path.
+// Text columns are columns with differing text in any row present in several regions, their cells are objects keyed by region,
+// other cells are taken from the first region with the row.
+func mergeI18nTable(name string, regions []string, tables []i18nTable) (*i18nMerged, []*i18nMissing) {
+	keySet := make(map[string]bool)
+	for _, t := range tables {
+		for k := range t {
+			keySet[k] = true
+		}
+	}
+	keys := make([]string, 0, len(keySet))
+	for k := range keySet {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return lessKeyPath(keys[i], keys[j]) })
+
+	text := make(map[string]bool)
+	var columns []string
+	seenColumns := make(map[string]bool)
+	var missing []*i18nMissing
+	for _, k := range keys {
+		var present []string
+		var rows []*i18nRow
+		for i, t := range tables {
+			if row, ok := t[k]; ok {
+				present = append(present, regions[i])
+				rows = append(rows, row)
+				for _, c := range row.columns {
+					if !seenColumns[c] {
+						seenColumns[c] = true
+						columns = append(columns, c)
+					}
+				}
+			}
+		}
+		if len(present) < len(regions) {
+			missing = append(missing, &i18nMissing{Table: name, Key: k, Regions: present})
+		}
+		for _, c := range columns {
+			for _, row := range rows[1:] {
+				a, b := rows[0].cells[c], row.cells[c]
+				if (isI18nText(a) || isI18nText(b)) && !reflect.DeepEqual(a, b) {
+					text[c] = true
+				}
+			}
+		}
+	}
+
+	merged := make(map[string]*i18nRow, len(keys))
+	for _, k := range keys {
+		row := &i18nRow{columns: columns, cells: map[string]any{}}
+		for _, t := range tables {
+			if r, ok := t[k]; ok {
+				row.flat = r.flat
+				break
+			}
+		}
+		for _, c := range columns {
+			if text[c] {
+				byRegion := map[string]any{}
+				for i, t := range tables {
+					if r, ok := t[k]; ok {
+						if cell, ok := r.cells[c]; ok {
+							byRegion[regions[i]] = cell
+						}
+					}
+				}
+				row.cells[c] = byRegion
+				continue
+			}
+			for _, t := range tables {
+				if r, ok := t[k]; ok {
+					if cell, ok := r.cells[c]; ok {
+						row.cells[c] = cell
+						break
+					}
+				}
+			}
+		}
+		merged[k] = row
+	}
+
+	var textColumns []string
+	for _, c := range columns {
+		if text[c] {
+			textColumns = append(textColumns, c)
+		}
+	}
+	return &i18nMerged{columns: columns, text: textColumns, keys: keys, rows: merged}, missing
+}
+
+// marshalJSON writes merged rows nested by their key paths like extracted tables, with rows as arrays or objects.
+// Tables which are a list of rows are written as a list.
+func (merged *i18nMerged) marshalJSON(indent int) ([]byte, error) {
+	root := map[string]any{}
+	var list []any
+	for _, k := range merged.keys {
+		row := merged.rows[k]
+		var value any = row.cells
+		if len(row.columns) == 0 {
+			value = []any{}
+		} else if _, err := strconv.Atoi(row.columns[0]); err == nil {
+			cells := make([]any, len(row.columns))
+			for i, c := range row.columns {
+				cells[i] = row.cells[c]
+			}
+			value = cells
+		}
+
+		keys := splitI18nKey(k)
+		if len(keys) == 0 {
+			if row.flat {
+				return marshalIndentNoEscape(value, indent)
+			}
+			list = append(list, value)
+			continue
+		}
+		node := root
+		for _, p := range keys[:len(keys)-1] {
+			child, ok := node[p].(map[string]any)
+			if !ok {
+				child = map[string]any{}
+				node[p] = child
+			}
+			node = child
+		}
+		last := keys[len(keys)-1]
+		if row.flat {
+			node[last] = value
+			continue
+		}
+		rows, _ := node[last].([]any)
+		node[last] = append(rows, value)
+	}
+	if list != nil {
+		return marshalIndentNoEscape(list, indent)
+	}
+	return marshalIndentNoEscape(root, indent)
+}
+
+// marshalCSV writes merged rows with leading _key1, _key2, ... columns and a column per region for text columns.
+func (merged *i18nMerged) marshalCSV(regions []string) ([]byte, error) {
+	isText := make(map[string]bool)
+	for _, c := range merged.text {
+		isText[c] = true
+	}
+	depth := 0
+	for _, k := range merged.keys {
+		if n := len(splitI18nKey(k)); n > depth {
+			depth = n
+		}
+	}
+
+	var output bytes.Buffer
+	w := csv.NewWriter(&output)
+	var header []string
+	for i := 1; i <= depth; i++ {
+		header = append(header, "_key"+strconv.Itoa(i))
+	}
+	for _, c := range merged.columns {
+		if !isText[c] {
+			header = append(header, c)
+			continue
+		}
+		for _, r := range regions {
+			header = append(header, c+"_"+r)
+		}
+	}
+	w.Write(header)
+
+	cellString := func(cell any) string {
+		switch val := cell.(type) {
+		case nil:
+			return ""
+		case string:
+			return val
+		}
+		data, _ := json.Marshal(cell)
+		return string(data)
+	}
+	for _, k := range merged.keys {
+		record := splitI18nKey(k)
+		record = append(record, make([]string, depth-len(record))...)
+		row := merged.rows[k]
+		for _, c := range merged.columns {
+			if !isText[c] {
+				record = append(record, cellString(row.cells[c]))
+				continue
+			}
+			byRegion, _ := row.cells[c].(map[string]any)
+			for _, r := range regions {
+				record = append(record, cellString(byRegion[r]))
+			}
+		}
+		w.Write(record)
+	}
+	w.Flush()
+	return output.Bytes(), w.Error()
+}
+
+// MergeI18n merges text of master tables extracted from several regions, matching rows by key path.
+func (merger *I18nMerger) MergeI18n() error {
+	log.Println("[INFO] Merging regions")
+
+	regions := merger.config.Regions
+	present := make(map[string][]string)
+	for i, src := range merger.config.SrcPaths {
+		tables, err := listI18nTables(merger.srcFS[i])
+		if err != nil {
+			return fmt.Errorf("MergeI18n: table list error, src=%s, %w", src, err)
+		}
+		for _, t := range tables {
+			if merger.filter.match(t, path.Join(outputOrderedMapDir, t+"."+FormatJSON)) {
+				present[t] = append(present[t], regions[i])
+			}
+		}
+	}
+	names := make([]string, 0, len(present))
+	for t := range present {
+		names = append(names, t)
+	}
+	sort.Strings(names)
+
+	missing := []*i18nMissing{}
+	for _, name := range names {
+		if len(present[name]) < len(regions) {
+			missing = append(missing, &i18nMissing{Table: name, Regions: present[name]})
+			continue
+		}
+
+		tables := make([]i18nTable, len(regions))
+		for i, src := range merger.config.SrcPaths {
+			t, err := readI18nTable(merger.srcFS[i], path.Join(outputOrderedMapDir, name+"."+FormatJSON))
+			if err != nil {
+				return fmt.Errorf("MergeI18n: table read error, src=%s, %w", src, err)
+			}
+			tables[i] = t
+		}
+
+		merged, m := mergeI18nTable(name, regions, tables)
+		missing = append(missing, m...)
+		if len(merged.keys) == 0 {
+			continue
+		}
+
+		var data []byte
+		var err error
+		switch merger.config.Format {
+		case FormatCSV:
+			data, err = merged.marshalCSV(regions)
+		default:
+			data, err = merged.marshalJSON(merger.config.Indent)
+		}
+		if err != nil {
+			return fmt.Errorf("MergeI18n: marshal error, table=%s, %w", name, err)
+		}
+		err = writeFile(filepath.Join(merger.config.DestPath, filepath.FromSlash(name)+"."+merger.config.Format), data)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(missing) > 0 {
+		log.Printf("[WARN] %d tables or rows are missing from some regions, report=%s\n", len(missing), merger.config.ReportPath)
+	}
+	return writeJSON(merger.config.ReportPath, missing, merger.config.Indent)
+}
@@ -0,0 +1,129 @@
+package wf
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMergeI18n(t *testing.T) {
+	dir := t.TempDir()
+	write := func(region string, table string, js string) {
+		p := filepath.Join(dir, region, outputOrderedMapDir, filepath.FromSlash(table)+".json")
+		err := os.MkdirAll(filepath.Dir(p), 0777)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(p, []byte(js), 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("jp", "character/character", `{"1":[["alk","アルク","100"]],"2":[["bob","ボブ","200"]],"10":[["new","新","1"]]}`)
+	write("gl", "character/character", `{"1":[["alk","Alk","120"]],"2":[["bob","Bob","200"]]}`)
+	write("jp", "jp_only", `{"1":[["a"]]}`)
+
+	merger, err := NewI18nMerger(&I18nConfig{SrcPaths: []string{filepath.Join(dir, "jp"), filepath.Join(dir, "gl")}, DestPath: filepath.Join(dir, "out"), Format: FormatCSV})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = merger.MergeI18n()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(filepath.Join(dir, "out", "character", "character.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// numbers differing between regions are not text, rows are taken from the first region
+	want := "_key1,0,1_jp,1_gl,2\n1,alk,アルク,Alk,100\n2,bob,ボブ,Bob,200\n10,new,新,,1\n"
+	if string(got) != want {
+		t.Errorf("merged csv = %q, want %q", got, want)
+	}
+
+	report, err := os.ReadFile(filepath.Join(dir, "out", defaultI18nReportPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var missing []*i18nMissing
+	err = json.Unmarshal(report, &missing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(missing) != 2 || missing[0].Key != "10#0" || missing[1].Table != "jp_only" || missing[1].Key != "" {
+		t.Errorf("report = %s", bytes.TrimSpace(report))
+	}
+}
+
+func TestMergeI18nShape(t *testing.T) {
+	dir := t.TempDir()
+	sink, err := newArchiveSink(filepath.Join(dir, "gl.zip"), archiveZip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for p, js := range map[string]string{
+		"orderedmap/list.json": `[["a","Sword"],["b","Shield"]]`,
+		"orderedmap/flat.json": `{"1":["x","Fire"],"2":["y","<b>Water</b> & Ice"]}`,
+	} {
+		if err := sink.write(p, []byte(js)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sink.close(); err != nil {
+		t.Fatal(err)
+	}
+	for p, js := range map[string]string{
+		"list.json": `[["a","剣"],["b","盾"]]`,
+		"flat.json": `{"1":["x","火"],"2":["y","水"]}`,
+	} {
+		p = filepath.Join(dir, "jp", outputOrderedMapDir, p)
+		if err := os.MkdirAll(filepath.Dir(p), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(js), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	merger, err := NewI18nMerger(&I18nConfig{SrcPaths: []string{filepath.Join(dir, "jp"), filepath.Join(dir, "gl.zip")}, DestPath: filepath.Join(dir, "out")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merger.config.Regions[1] != "gl" {
+		t.Errorf("regions = %v", merger.config.Regions)
+	}
+	err = merger.MergeI18n()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// tables keep their shape, lists of rows and flattened rows, and text is not HTML escaped
+	for name, want := range map[string]string{
+		"list.json": `[["a",{"gl":"Sword","jp":"剣"}],["b",{"gl":"Shield","jp":"盾"}]]`,
+		"flat.json": `{"1":["x",{"gl":"Fire","jp":"火"}],"2":["y",{"gl":"<b>Water</b> & Ice","jp":"水"}]}`,
+	} {
+		got, err := os.ReadFile(filepath.Join(dir, "out", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, got); err != nil {
+			t.Fatal(err)
+		}
+		if compact.String() != want {
+			t.Errorf("%s = %s, want %s", name, compact.String(), want)
+		}
+	}
+
+	// tables extracted as csv cannot be matched by key path
+	err = os.WriteFile(filepath.Join(dir, "jp", outputOrderedMapDir, "table.csv"), []byte("a,b\n"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := merger.MergeI18n(); err == nil {
+		t.Error("MergeI18n() with csv tables error = nil")
+	}
+}
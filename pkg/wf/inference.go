@@ -0,0 +1,479 @@
+package wf
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/blead/wfax/pkg/concurrency"
+	"github.com/blead/wfax/pkg/encoding"
+)
+
+// columns with at most this many distinct repeated values record them as their domain
+const inferredDomainLimit = 16
+
+// ErrSchemaChanged is wrapped by errors of inference runs which found changes from the previous schemas other than domain changes.
+var ErrSchemaChanged = errors.New("master table schemas changed")
+
+// Kinds of schema changes.
+const (
+	schemaTableAdded     = "tableAdded"
+	schemaTableRemoved   = "tableRemoved"
+	schemaShapeChanged   = "shapeChanged"
+	schemaColumnsAdded   = "columnsAdded"
+	schemaColumnsInsert  = "columnsInserted"
+	schemaColumnsRemoved = "columnsRemoved"
+	schemaTypeChanged    = "typeChanged"
+	schemaDomainChanged  = "domainChanged"
+)
+
+// columnShape is an inferred column of a master table.
+type columnShape struct {
+	Index int `json:"index"`
+	// Type is empty if no row has a value in the column.
+	Type string `json:"type,omitempty"`
+	// Optional is set if some rows have an empty or missing cell.
+	Optional bool `json:"optional,omitempty"`
+	// Domain is the sorted list of distinct values if they are few and repeated.
+	Domain []string `json:"domain,omitempty"`
+}
+
+// tableShape is an inferred schema of a master table.
+type tableShape struct {
+	// Depth is the number of nested map keys.
+	Depth int `json:"depth"`
+	// MultiRow is set if some keys have more than one row.
+	MultiRow bool           `json:"multiRow"`
+	Entries  int            `json:"entries"`
+	Columns  []*columnShape `json:"columns"`
+}
+
+// inferredSchemas are inferred schemas of master tables of a version.
+type inferredSchemas struct {
+	Version string                 `json:"version,omitempty"`
+	Tables  map[string]*tableShape `json:"tables"`
+}
+
+// schemaChange is a difference between inferred schemas of a table.
+// Column is the index of the column in the new schema, or of the first removed column.
+type schemaChange struct {
+	Table  string `json:"table"`
+	Kind   string `json:"kind"`
+	Column *int   `json:"column,omitempty"`
+	Old    string `json:"old,omitempty"`
+	New    string `json:"new,omitempty"`
+}
+
+func (change *schemaChange) String() string {
+	s := fmt.Sprintf("table=%s, kind=%s", change.Table, change.Kind)
+	if change.Column != nil {
+		s += fmt.Sprintf(", column=%d", *change.Column)
+	}
+	if change.Old != "" || change.New != "" {
+		s += fmt.Sprintf(", old=%s, new=%s", change.Old, change.New)
+	}
+	return s
+}
+
+// inferTableShape infers the schema of a master table from its rows.
+func inferTableShape(table *encoding.OrderedmapTable) *tableShape {
+	types := table.ColumnTypes(nil)
+	shape := &tableShape{Depth: table.Depth, Columns: make([]*columnShape, table.Width)}
+
+	values := make([]map[string]int, table.Width)
+	counts := make([]int, table.Width)
+	keys := map[string]bool{}
+	for _, row := range table.Rows {
+		k := strings.Join(row.Keys, "\x00")
+		if row.Index > 0 {
+			shape.MultiRow = true
+		}
+		keys[k] = true
+
+		for i := 0; i < table.Width; i++ {
+			if i >= len(row.Cells) || row.Cells[i] == "" {
+				continue
+			}
+			if values[i] == nil {
+				values[i] = map[string]int{}
+			}
+			values[i][row.Cells[i]]++
+			counts[i]++
+		}
+	}
+	shape.Entries = len(keys)
+
+	for i := range shape.Columns {
+		c := &columnShape{Index: i, Optional: counts[i] < len(table.Rows)}
+		if counts[i] > 0 {
+			c.Type = types[i]
+		}
+		if len(values[i]) <= inferredDomainLimit && counts[i] > len(values[i]) {
+			for v := range values[i] {
+				c.Domain = append(c.Domain, v)
+			}
+			sort.Strings(c.Domain)
+		}
+		shape.Columns[i] = c
+	}
+	return shape
+}
+
+// matchColumns scores how likely two columns are the same column of different versions.
+func matchColumns(a *columnShape, b *columnShape) int {
+	if a.Type != "" && b.Type != "" && a.Type != b.Type {
+		return 0
+	}
+	if a.Domain != nil && b.Domain != nil {
+		for _, v := range b.Domain {
+			if _, ok := slices.BinarySearch(a.Domain, v); ok {
+				return 2
+			}
+		}
+		return 0
+	}
+	return 1
+}
+
+// alignColumns finds the position where columns were inserted or removed between versions, preferring the end on ties.
+// It returns the position and the index of each column of before in after, -1 if removed.
+func alignColumns(before []*columnShape, after []*columnShape) (int, []int) {
+	d := len(after) - len(before)
+	mapping := func(pos int) []int {
+		m := make([]int, len(before))
+		for j := range before {
+			switch {
+			case j < pos:
+				m[j] = j
+			case d < 0 && j < pos-d:
+				m[j] = -1
+			default:
+				m[j] = j + d
+			}
+		}
+		return m
+	}
+
+	end := min(len(before), len(after))
+	best, bestScore := end, -1
+	for pos := end; pos >= 0; pos-- {
+		score := 0
+		for j, k := range mapping(pos) {
+			if k >= 0 {
+				score += matchColumns(before[j], after[k])
+			}
+		}
+		if score > bestScore {
+			best, bestScore = pos, score
+		}
+	}
+	return best, mapping(best)
+}
+
+// compareTableShapes returns changes of a master table schema.
+func compareTableShapes(table string, before *tableShape, after *tableShape) []*schemaChange {
+	column := func(i int) *int { return &i }
+	var changes []*schemaChange
+	if before.Depth != after.Depth || before.MultiRow != after.MultiRow {
+		changes = append(changes, &schemaChange{
+			Table: table,
+			Kind:  schemaShapeChanged,
+			Old:   fmt.Sprintf("depth=%d, multiRow=%t", before.Depth, before.MultiRow),
+			New:   fmt.Sprintf("depth=%d, multiRow=%t", after.Depth, after.MultiRow),
+		})
+	}
+
+	pos, mapping := alignColumns(before.Columns, after.Columns)
+	if d := len(after.Columns) - len(before.Columns); d != 0 {
+		kind := schemaColumnsInsert
+		switch {
+		case d < 0:
+			kind = schemaColumnsRemoved
+		case pos == len(before.Columns):
+			kind = schemaColumnsAdded
+		}
+		changes = append(changes, &schemaChange{
+			Table:  table,
+			Kind:   kind,
+			Column: column(pos),
+			Old:    strconv.Itoa(len(before.Columns)),
+			New:    strconv.Itoa(len(after.Columns)),
+		})
+	}
+
+	for j, k := range mapping {
+		if k < 0 {
+			continue
+		}
+		o, n := before.Columns[j], after.Columns[k]
+		if o.Type != "" && n.Type != "" && o.Type != n.Type {
+			changes = append(changes, &schemaChange{Table: table, Kind: schemaTypeChanged, Column: column(k), Old: o.Type, New: n.Type})
+		}
+		if o.Domain == nil {
+			continue
+		}
+		var added []string
+		for _, v := range n.Domain {
+			if _, ok := slices.BinarySearch(o.Domain, v); !ok {
+				added = append(added, v)
+			}
+		}
+		// values no longer repeating within the limit are not a domain anymore
+		if len(added) > 0 || (n.Domain == nil && n.Type != "") {
+			changes = append(changes, &schemaChange{
+				Table:  table,
+				Kind:   schemaDomainChanged,
+				Column: column(k),
+				Old:    strings.Join(o.Domain, "|"),
+				New:    strings.Join(n.Domain, "|"),
+			})
+		}
+	}
+	return changes
+}
+
+// compareSchemas returns changes between inferred schemas sorted by table.
+func compareSchemas(before *inferredSchemas, after *inferredSchemas) []*schemaChange {
+	tables := map[string]bool{}
+	for t := range before.Tables {
+		tables[t] = true
+	}
+	for t := range after.Tables {
+		tables[t] = true
+	}
+	sorted := make([]string, 0, len(tables))
+	for t := range tables {
+		sorted = append(sorted, t)
+	}
+	sort.Strings(sorted)
+
+	changes := []*schemaChange{}
+	for _, t := range sorted {
+		o, n := before.Tables[t], after.Tables[t]
+		switch {
+		case o == nil:
+			changes = append(changes, &schemaChange{Table: t, Kind: schemaTableAdded})
+		case n == nil:
+			changes = append(changes, &schemaChange{Table: t, Kind: schemaTableRemoved})
+		default:
+			changes = append(changes, compareTableShapes(t, o, n)...)
+		}
+	}
+	return changes
+}
+
+// SchemaInferConfig is the configuration for the schema inferrer.
+// Sources are read like ExtractorConfig sources.
+// If PreviousPath is set, inferred schemas are compared with schemas previously written there, which may be DestPath itself.
+type SchemaInferConfig struct {
+	SrcPath        string
+	SrcPaths       []string
+	SrcFS          fs.FS
+	Archives       []string
+	DestPath       string
+	PathList       string
+	NoDefaultPaths bool
+	PreviousPath   string
+	ReportPath     string
+	Version        string
+	Indent         int
+	Concurrency    int
+}
+
+// DefaultSchemaInferConfig generates a default configuration.
+func DefaultSchemaInferConfig() *SchemaInferConfig {
+	return &SchemaInferConfig{
+		SrcPath:        "",
+		SrcPaths:       nil,
+		SrcFS:          nil,
+		Archives:       nil,
+		DestPath:       "wf.schema.json",
+		PathList:       "",
+		NoDefaultPaths: false,
+		PreviousPath:   "",
+		ReportPath:     "",
+		Version:        "",
+		Indent:         0,
+		Concurrency:    5,
+	}
+}
+
+// SchemaInferrer infers schemas of master tables and detects changes between versions.
+type SchemaInferrer struct {
+	config *SchemaInferConfig
+}
+
+// NewSchemaInferrer creates a new schema inferrer with the supplied configuration.
+// If the configuration is nil, use DefaultSchemaInferConfig.
+func NewSchemaInferrer(config *SchemaInferConfig) (*SchemaInferrer, error) {
+	def := DefaultSchemaInferConfig()
+	if def == nil {
+		return nil, fmt.Errorf("NewSchemaInferrer: default configuration is nil")
+	}
+
+	if config == nil {
+		config = def
+	}
+
+	var err error
+	config.SrcPath, config.SrcFS, err = sourceConfig(config.SrcPath, config.SrcPaths, config.SrcFS, config.Archives)
+	if err != nil {
+		return nil, err
+	}
+	if config.DestPath == "" {
+		config.DestPath = def.DestPath
+	}
+	config.DestPath = filepath.Clean(config.DestPath)
+	if config.PathList != "" {
+		config.PathList = filepath.Clean(config.PathList)
+	}
+	if config.PreviousPath != "" {
+		config.PreviousPath = filepath.Clean(config.PreviousPath)
+	}
+	if config.ReportPath != "" {
+		config.ReportPath = filepath.Clean(config.ReportPath)
+	}
+
+	if config.Concurrency == 0 {
+		config.Concurrency = def.Concurrency
+	}
+
+	return &SchemaInferrer{config: config}, nil
+}
+
+func (inferrer *SchemaInferrer) extractorConfig() *ExtractorConfig {
+	return &ExtractorConfig{
+		SrcPath:        inferrer.config.SrcPath,
+		SrcFS:          inferrer.config.SrcFS,
+		PathList:       inferrer.config.PathList,
+		NoDefaultPaths: inferrer.config.NoDefaultPaths,
+	}
+}
+
+// inferTable infers the schema of the master table at p, returning nil if it does not exist in the dump.
+func (inferrer *SchemaInferrer) inferTable(p string) (*tableShape, error) {
+	config := inferrer.extractorConfig()
+	src, err := (&orderedmapParser{}).getSrc(p, config)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := fs.ReadFile(config.srcFS(), src)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("inferTable: src read error, src=%s, %w", src, err)
+	}
+
+	table, err := encoding.OrderedmapToTable(data)
+	if err != nil {
+		return nil, fmt.Errorf("inferTable: src parse error, src=%s, path=%s, %w", src, p, err)
+	}
+	return inferTableShape(table), nil
+}
+
+func (inferrer *SchemaInferrer) infer() (*inferredSchemas, error) {
+	paths, err := masterTablePaths(inferrer.extractorConfig())
+	if err != nil {
+		return nil, err
+	}
+
+	var items []*concurrency.Item[string, *tableShape]
+	for _, p := range paths {
+		items = append(items, &concurrency.Item[string, *tableShape]{Data: p})
+	}
+	err = concurrency.Execute(
+		func(i *concurrency.Item[string, *tableShape]) (*tableShape, error) {
+			return inferrer.inferTable(i.Data)
+		},
+		items,
+		inferrer.config.Concurrency,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &inferredSchemas{Version: inferrer.config.Version, Tables: map[string]*tableShape{}}
+	for _, i := range items {
+		if i.Output != nil {
+			output.Tables[i.Data] = i.Output
+		}
+	}
+	return output, nil
+}
+
+func readInferredSchemas(path string) (*inferredSchemas, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("readInferredSchemas: read error, path=%s, %w", path, err)
+	}
+	var s inferredSchemas
+	err = json.Unmarshal(data, &s)
+	if err != nil {
+		return nil, fmt.Errorf("readInferredSchemas: parse error, path=%s, %w", path, err)
+	}
+	if s.Tables == nil {
+		s.Tables = map[string]*tableShape{}
+	}
+	return &s, nil
+}
+
+// InferSchemas writes inferred schemas of master tables, and reports changes from the previous schemas if configured.
+// The returned error wraps ErrSchemaChanged if any change other than a domain change is found.
+func (inferrer *SchemaInferrer) InferSchemas() error {
+	log.Println("[INFO] Inferring master table schemas")
+
+	// previous schemas are read first since they may be overwritten
+	var previous *inferredSchemas
+	if inferrer.config.PreviousPath != "" {
+		var err error
+		previous, err = readInferredSchemas(inferrer.config.PreviousPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	schemas, err := inferrer.infer()
+	if err != nil {
+		return err
+	}
+	err = writeJSON(inferrer.config.DestPath, schemas, inferrer.config.Indent)
+	if err != nil {
+		return fmt.Errorf("InferSchemas: write error, dest=%s, %w", inferrer.config.DestPath, err)
+	}
+	log.Printf("[INFO] Schemas inferred, path=%s, tables=%d\n", inferrer.config.DestPath, len(schemas.Tables))
+
+	if previous == nil {
+		return nil
+	}
+	changes := compareSchemas(previous, schemas)
+	breaking := 0
+	for _, c := range changes {
+		// new domain values are routine updates which do not break consumers
+		if c.Kind == schemaDomainChanged {
+			log.Printf("[INFO] Schema domain changed, %s\n", c)
+			continue
+		}
+		breaking++
+		log.Printf("[WARN] Schema changed, %s\n", c)
+	}
+	if inferrer.config.ReportPath != "" {
+		err = writeJSON(inferrer.config.ReportPath, changes, inferrer.config.Indent)
+		if err != nil {
+			return fmt.Errorf("InferSchemas: report write error, path=%s, %w", inferrer.config.ReportPath, err)
+		}
+	}
+	if breaking > 0 {
+		return fmt.Errorf("InferSchemas: %d changes since version %q, %w", breaking, previous.Version, ErrSchemaChanged)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package wf
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/blead/wfax/pkg/encoding"
+)
+
+func TestInferSchemas(t *testing.T) {
+	dump := func(tables map[string]string) fstest.MapFS {
+		fsys := fstest.MapFS{}
+		for p, js := range tables {
+			h, err := sha1Digest(toMasterTablePath(p), digestSalt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := encoding.JSONToOrderedmap([]byte(js))
+			if err != nil {
+				t.Fatal(err)
+			}
+			fsys[dumpPath(h)] = &fstest.MapFile{Data: data}
+		}
+		return fsys
+	}
+	dir := t.TempDir()
+	pathList := filepath.Join(dir, "pathlist")
+	err := os.WriteFile(pathList, []byte("item/equipment\nold\nnew\n"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	infer := func(fsys fstest.MapFS, previous string) error {
+		inferrer, err := NewSchemaInferrer(&SchemaInferConfig{
+			SrcFS:          fsys,
+			DestPath:       filepath.Join(dir, "schema.json"),
+			PathList:       pathList,
+			NoDefaultPaths: true,
+			PreviousPath:   previous,
+			ReportPath:     filepath.Join(dir, "report.json"),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return inferrer.InferSchemas()
+	}
+
+	err = infer(dump(map[string]string{
+		"item/equipment": `{"1":[["sword","3","true"]],"2":[["bow","5","false"]],"3":[["axe","3","true"]]}`,
+		"old":            `{"1":[["a"]]}`,
+	}), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// rarity moved from column 1 to 2 by an inserted text column
+	err = infer(dump(map[string]string{
+		"item/equipment": `{"1":[["sword","x","3","true"]],"2":[["bow","y","5","false"]],"3":[["axe","z","3","1"]]}`,
+		"new":            `{"1":{"1":[["a"]]}}`,
+	}), filepath.Join(dir, "schema.json"))
+	if !errors.Is(err, ErrSchemaChanged) {
+		t.Fatalf("err = %v, want ErrSchemaChanged", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "report.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var changes []*schemaChange
+	err = json.Unmarshal(data, &changes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, c := range changes {
+		got = append(got, c.String())
+	}
+	want := []string{
+		"table=item/equipment, kind=columnsInserted, column=1, old=3, new=4",
+		"table=item/equipment, kind=typeChanged, column=3, old=bool, new=string",
+		"table=item/equipment, kind=domainChanged, column=3, old=false|true, new=",
+		"table=new, kind=tableAdded",
+		"table=old, kind=tableRemoved",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("changes = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("changes[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+
+	// a new rarity value only changes the domain
+	err = infer(dump(map[string]string{
+		"item/equipment": `{"1":[["sword","x","3","true"]],"2":[["bow","y","5","false"]],"3":[["axe","z","3","1"]],"4":[["spear","w","7","1"]]}`,
+		"new":            `{"1":{"1":[["a"]]}}`,
+	}), filepath.Join(dir, "schema.json"))
+	if err != nil {
+		t.Fatalf("err = %v, want nil for domain changes", err)
+	}
+	data, err = os.ReadFile(filepath.Join(dir, "report.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes = nil
+	err = json.Unmarshal(data, &changes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].Kind != schemaDomainChanged {
+		t.Errorf("changes = %s", data)
+	}
+}
@@ -0,0 +1,55 @@
+package wf
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/blead/wfax/assets"
+	"github.com/blead/wfax/pkg/encoding"
+)
+
+// keyDictionaries maps file extensions of AMF3 assets, e.g. .esdl, to dictionaries of their obfuscated keys.
+type keyDictionaries map[string]*encoding.KeyDictionary
+
+func parseKeyDictionaries(data []byte) (keyDictionaries, error) {
+	var d keyDictionaries
+	err := json.Unmarshal(data, &d)
+	if err != nil {
+		return nil, err
+	}
+
+	for ext, dict := range d {
+		err := dict.Validate()
+		if err != nil {
+			return nil, fmt.Errorf("parseKeyDictionaries: invalid dictionary, ext=%s, %w", ext, err)
+		}
+	}
+	return d, nil
+}
+
+// loadKeyDictionaries reads the default key dictionaries and overrides them per extension with dictionaries from path if supplied.
+func loadKeyDictionaries(path string) (keyDictionaries, error) {
+	d, err := parseKeyDictionaries(assets.Keys)
+	if err != nil {
+		return nil, fmt.Errorf("loadKeyDictionaries: default dictionaries error, %w", err)
+	}
+
+	if path == "" {
+		return d, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("loadKeyDictionaries: read error, path=%s, %w", path, err)
+	}
+	custom, err := parseKeyDictionaries(data)
+	if err != nil {
+		return nil, fmt.Errorf("loadKeyDictionaries: parse error, path=%s, %w", path, err)
+	}
+
+	for ext, dict := range custom {
+		d[ext] = dict
+	}
+	return d, nil
+}
@@ -0,0 +1,94 @@
+package wf
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"testing/fstest"
+
+	"github.com/blead/wfax/pkg/encoding"
+)
+
+func TestESDLReadableKeys(t *testing.T) {
+	keys, err := loadKeyDictionaries("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parser := &esdlParser{&amf3Parser{ext: ".esdl", keys: keys[".esdl"]}}
+
+	esdl := []byte(`{"bH":"enemy/boss/","au":[{"g":{"idle":{"i":[{"b":"idle"}]}},"m":[{"b":"dead"}]}],"bx":["T1",{"g":"pre"}]}`)
+	readable, err := encoding.RenameJSONKeys(esdl, parser.keys, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := (&esdlParser{&amf3Parser{ext: ".esdl"}}).output(esdl, &ExtractorConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := parser.output(readable, &ExtractorConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	toStrings := func(paths [][]byte) []string {
+		var output []string
+		for _, p := range paths {
+			output = append(output, string(p))
+		}
+		sort.Strings(output)
+		return output
+	}
+	if len(want) == 0 || !reflect.DeepEqual(toStrings(got), toStrings(want)) {
+		t.Errorf("output() = %v, want %v", toStrings(got), toStrings(want))
+	}
+}
+
+func TestPackReadableKeys(t *testing.T) {
+	// readable names are only restored when packing files extracted with readable keys
+	extracted := []byte(`{"type":["T1"],"bH":"enemy/boss/"}`)
+	tests := map[bool]string{
+		false: `{"bH":"enemy/boss/","type":["T1"]}`,
+		true:  `{"bH":"enemy/boss/","bx":["T1"]}`,
+	}
+	for readable, want := range tests {
+		dir := t.TempDir()
+		packer, err := NewPacker(&PackerConfig{
+			SrcFS:        fstest.MapFS{"assets/enemy/boss.esdl.json": {Data: extracted}},
+			DestPath:     dir,
+			ReadableKeys: readable,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = packer.PackAssets()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		src, err := (&amf3Parser{ext: ".esdl"}).getSrc("enemy/boss", &ExtractorConfig{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(src)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		js, err := encoding.Amf3ToJSON(data, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got bytes.Buffer
+		err = json.Compact(&got, js)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.String() != want {
+			t.Errorf("ReadableKeys=%t packed %s, want %s", readable, got.String(), want)
+		}
+	}
+}
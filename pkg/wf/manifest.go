@@ -0,0 +1,129 @@
+package wf
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const manifestVersion = 1
+
+// manifestEntry describes a written output file.
+type manifestEntry struct {
+	// Path is the output path relative to the destination.
+	Path string `json:"path"`
+	// Asset is the logical asset path the output was produced from.
+	Asset  string `json:"asset"`
+	Parser string `json:"parser"`
+	// Source is the path of the file read to produce the output, relative to the source.
+	Source string `json:"source"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+// outputManifest lists outputs of a run, and outputs of the previous run at the same manifest path which were not produced again.
+type outputManifest struct {
+	Version int              `json:"version"`
+	Entries []*manifestEntry `json:"entries"`
+	Stale   []*manifestEntry `json:"stale"`
+
+	mu      sync.Mutex
+	entries map[string]*manifestEntry
+}
+
+func newOutputManifest() *outputManifest {
+	return &outputManifest{Version: manifestVersion, entries: map[string]*manifestEntry{}}
+}
+
+// newManifestEntry hashes data written to p.
+// asset is cleaned since differently written paths, e.g. with a leading /, resolve to the same asset.
+func newManifestEntry(p string, asset string, parser string, source string, data []byte) (*manifestEntry, error) {
+	checksum, err := sha256Checksum(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return &manifestEntry{
+		Path:   p,
+		Asset:  strings.TrimPrefix(path.Clean(asset), "/"),
+		Parser: parser,
+		Source: source,
+		SHA256: hex.EncodeToString(checksum),
+		Size:   int64(len(data)),
+	}, nil
+}
+
+// add records entry, manifest is nil if disabled.
+func (manifest *outputManifest) add(entry *manifestEntry) {
+	if manifest == nil {
+		return
+	}
+	manifest.mu.Lock()
+	defer manifest.mu.Unlock()
+	manifest.entries[entry.Path] = entry
+}
+
+// readManifestEntries reads entries and stale entries of a previous manifest at path, or nil if it does not exist.
+func readManifestEntries(path string) ([]*manifestEntry, []*manifestEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil, nil
+		}
+		return nil, nil, fmt.Errorf("readManifestEntries: read error, path=%s, %w", path, err)
+	}
+
+	prev := &outputManifest{}
+	err = json.Unmarshal(data, prev)
+	if err != nil {
+		return nil, nil, fmt.Errorf("readManifestEntries: unmarshal error, path=%s, %w", path, err)
+	}
+	return prev.Entries, prev.Stale, nil
+}
+
+// write writes entries sorted by path, outputs of the previous manifest at path missing from this run are listed as stale.
+// If outputs are written into the directory destDir, stale outputs are kept listed until they are removed from it,
+// otherwise the destination is rewritten by each run and only outputs of the previous run are compared.
+func (manifest *outputManifest) write(path string, destDir string, indent int) error {
+	manifest.mu.Lock()
+	defer manifest.mu.Unlock()
+
+	prev, prevStale, err := readManifestEntries(path)
+	if err != nil {
+		return err
+	}
+	if destDir != "" {
+		for _, e := range prevStale {
+			if _, err := os.Stat(filepath.Join(destDir, filepath.FromSlash(e.Path))); err == nil {
+				prev = append(prev, e)
+			}
+		}
+	}
+
+	manifest.Entries = make([]*manifestEntry, 0, len(manifest.entries))
+	for _, e := range manifest.entries {
+		manifest.Entries = append(manifest.Entries, e)
+	}
+	sort.Slice(manifest.Entries, func(i, j int) bool { return manifest.Entries[i].Path < manifest.Entries[j].Path })
+
+	manifest.Stale = []*manifestEntry{}
+	for _, e := range prev {
+		if _, ok := manifest.entries[e.Path]; !ok {
+			manifest.Stale = append(manifest.Stale, e)
+		}
+	}
+	sort.Slice(manifest.Stale, func(i, j int) bool { return manifest.Stale[i].Path < manifest.Stale[j].Path })
+	if len(manifest.Stale) > 0 {
+		log.Printf("[WARN] %d outputs of the previous run were not produced again, see stale entries of %s\n", len(manifest.Stale), path)
+	}
+
+	return writeJSON(path, manifest, indent)
+}
@@ -0,0 +1,48 @@
+package wf
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestManifestStale(t *testing.T) {
+	dir := t.TempDir()
+	manifestPath := filepath.Join(dir, "manifest.json")
+
+	run := func(outputs ...string) *outputManifest {
+		manifest := newOutputManifest()
+		for _, o := range outputs {
+			entry, err := newManifestEntry(o, "/"+o, "png", "upload/00/00", []byte(o))
+			if err != nil {
+				t.Fatal(err)
+			}
+			manifest.add(entry)
+		}
+		err := manifest.write(manifestPath, dir, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return manifest
+	}
+
+	err := os.WriteFile(filepath.Join(dir, "b"), nil, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	run("a", "b", "c")
+	manifest := run("a")
+	if len(manifest.Entries) != 1 || manifest.Entries[0].Asset != "a" {
+		t.Errorf("entries = %+v", manifest.Entries)
+	}
+	if len(manifest.Stale) != 2 || manifest.Stale[0].Path != "b" || manifest.Stale[1].Path != "c" {
+		t.Errorf("stale = %+v, want b and c", manifest.Stale)
+	}
+
+	// stale outputs stay listed while they exist in the destination
+	manifest = run("a")
+	if len(manifest.Stale) != 1 || manifest.Stale[0].Path != "b" {
+		t.Errorf("stale = %+v, want b", manifest.Stale)
+	}
+}
@@ -4,26 +4,43 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
 	"os"
+	"path"
 	"path/filepath"
 
 	"github.com/blead/wfax/pkg/concurrency"
 )
 
 // PackerConfig is the configuration for the packer.
+// Extracted files are read from SrcFS if set, otherwise from SrcPath,
+// which may be a .zip, .tar.gz or .tgz archive written by extract.
+// ReadableKeys restores obfuscated keys of ESDL and action DSL files extracted with readable keys,
+// by the default key dictionaries overridden per extension by KeysPath.
+// If ManifestPath is set, a manifest of packed files with their hashes is written to it.
 type PackerConfig struct {
-	SrcPath     string
-	DestPath    string
-	Concurrency int
+	SrcPath      string
+	SrcFS        fs.FS
+	DestPath     string
+	SchemaPath   string
+	ReadableKeys bool
+	KeysPath     string
+	ManifestPath string
+	Concurrency  int
 }
 
 // DefaultPackerConfig generates a default configuration.
 func DefaultPackerConfig() *PackerConfig {
 	return &PackerConfig{
-		SrcPath:     "",
-		DestPath:    "",
-		Concurrency: 5,
+		SrcPath:      "",
+		SrcFS:        nil,
+		DestPath:     "",
+		SchemaPath:   "",
+		ReadableKeys: false,
+		KeysPath:     "",
+		ManifestPath: "",
+		Concurrency:  5,
 	}
 }
 
@@ -53,6 +70,13 @@ func NewPacker(config *PackerConfig) (*Packer, error) {
 		config.SrcPath = wd
 	}
 	config.SrcPath = filepath.Clean(config.SrcPath)
+	if config.SrcFS == nil && archiveFormat(config.SrcPath) != "" {
+		fsys, err := openArchiveFS(config.SrcPath)
+		if err != nil {
+			return nil, err
+		}
+		config.SrcFS = fsys
+	}
 
 	if config.DestPath == "" || config.DestPath == "." {
 		wd, err := os.Getwd()
@@ -62,48 +86,63 @@ func NewPacker(config *PackerConfig) (*Packer, error) {
 		config.DestPath = wd
 	}
 	config.DestPath = filepath.Clean(config.DestPath)
+	if config.ManifestPath != "" {
+		config.ManifestPath = filepath.Clean(config.ManifestPath)
+	}
 
 	if config.Concurrency == 0 {
 		config.Concurrency = 5
 	}
 
+	// schemas are required to pack rows extracted with named columns
+	s, err := loadSchemas(config.SchemaPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys keyDictionaries
+	if config.ReadableKeys {
+		keys, err = loadKeyDictionaries(config.KeysPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	parsers := []parser{
-		&amf3Parser{ext: ".action.dsl"},
+		&amf3Parser{ext: ".action.dsl", keys: keys[".action.dsl"]},
 		&amf3Parser{ext: ".atlas"},
 		&amf3Parser{ext: ".frame"},
 		&amf3Parser{ext: ".parts"},
 		&amf3Parser{ext: ".timeline"},
-		&esdlParser{&amf3Parser{ext: ".esdl"}},
+		&esdlParser{&amf3Parser{ext: ".esdl", keys: keys[".esdl"]}},
 		&pngParser{},
-		&orderedmapParser{}, // needs to be last because of ambiguous file extension
+		// orderedmap parsers need to be last because of ambiguous file extensions
+		&orderedmapParser{schemas: s},
+		&orderedmapParser{schemas: s, format: FormatCSV},
+		&orderedmapParser{schemas: s, format: FormatTSV},
 	}
 
 	return &Packer{config: config, parsers: parsers}, nil
 }
 
-func packFile(src string, p parser, config *PackerConfig) (bool, error) {
+func packFile(src string, p parser, config *PackerConfig, manifest *outputManifest) (bool, error) {
 	path, found := p.matchDest(src, config)
 	if !found {
 		return false, nil
 	}
 
-	dest, err := p.getSrc(path, &ExtractorConfig{SrcPath: config.DestPath})
+	rel, err := p.getSrc(path, &ExtractorConfig{})
 	if err != nil {
 		return false, err
 	}
+	dest := filepath.Join(config.DestPath, filepath.FromSlash(rel))
 
-	srcFile, err := os.Open(src)
-	if err != nil {
-		return false, fmt.Errorf("packFile: src open error, src=%s, dest=%s, %w", src, dest, err)
-	}
-	defer srcFile.Close()
-
-	data, err := io.ReadAll(srcFile)
+	data, err := fs.ReadFile(config.srcFS(), src)
 	if err != nil {
 		return false, fmt.Errorf("packFile: src read error, src=%s, dest=%s, %w", src, dest, err)
 	}
 
-	data, err = p.unparse(data, config)
+	data, err = p.unparse(path, data, config)
 	if err != nil {
 		return false, fmt.Errorf("packFile: src unparse error, src=%s, dest=%s, %w", src, dest, err)
 	}
@@ -120,6 +159,14 @@ func packFile(src string, p parser, config *PackerConfig) (bool, error) {
 		return false, fmt.Errorf("packFile: dest write error, src=%s, dest=%s, %w", src, dest, err)
 	}
 
+	if manifest != nil {
+		entry, err := newManifestEntry(rel, path, parserName(p), src, data)
+		if err != nil {
+			return false, err
+		}
+		manifest.add(entry)
+	}
+
 	return true, nil
 }
 
@@ -127,38 +174,39 @@ type packParams struct {
 	path    string
 	parsers []parser
 	config  *PackerConfig
+	// manifest is nil if no manifest is written
+	manifest *outputManifest
 }
 
-func packPath(i *concurrency.Item[*packParams, []string]) ([]string, error) {
-	f, err := os.Open(i.Data.path)
+// readDirPaths returns slash-separated paths inside dir of fsys.
+func readDirPaths(fsys fs.FS, dir string) ([]string, error) {
+	entries, err := fs.ReadDir(fsys, dir)
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
 
-	fileInfo, err := f.Stat()
+	var paths []string
+	for _, e := range entries {
+		paths = append(paths, path.Join(dir, e.Name()))
+	}
+	return paths, nil
+}
+
+func packPath(i *concurrency.Item[*packParams, []string]) ([]string, error) {
+	fsys := i.Data.config.srcFS()
+	fileInfo, err := fs.Stat(fsys, i.Data.path)
 	if err != nil {
 		return nil, err
 	}
 
 	// f is dir: return paths inside
 	if fileInfo.IsDir() {
-		dirnames, err := f.Readdirnames(0)
-		if err != nil {
-			return nil, err
-		}
-
-		var paths []string
-		for _, dn := range dirnames {
-			paths = append(paths, filepath.Join(i.Data.path, dn))
-		}
-
-		return paths, nil
+		return readDirPaths(fsys, i.Data.path)
 	}
 
 	// f is file: pack the file
 	for _, p := range i.Data.parsers {
-		found, err := packFile(i.Data.path, p, i.Data.config)
+		found, err := packFile(i.Data.path, p, i.Data.config, i.Data.manifest)
 		if err != nil {
 			return nil, err
 		}
@@ -175,34 +223,29 @@ func (packer *Packer) pack() error {
 		return err
 	}
 
-	f, err := os.Open(packer.config.SrcPath)
+	paths, err := readDirPaths(packer.config.srcFS(), ".")
 	if err != nil {
 		return err
 	}
-	defer f.Close()
 
-	dirnames, err := f.Readdirnames(0)
-	if err != nil {
-		return err
-	}
-
-	var paths []string
-	for _, dn := range dirnames {
-		paths = append(paths, filepath.Join(packer.config.SrcPath, dn))
+	var manifest *outputManifest
+	if packer.config.ManifestPath != "" {
+		manifest = newOutputManifest()
 	}
 
 	items := []*concurrency.Item[*packParams, []string]{{Output: paths}}
 
-	return concurrency.Dispatcher(
+	err = concurrency.Dispatcher(
 		func(i *concurrency.Item[*packParams, []string]) ([]*concurrency.Item[*packParams, []string], error) {
 			var output []*concurrency.Item[*packParams, []string]
 			if i.Output != nil {
 				for _, p := range i.Output {
 					output = append(output, &concurrency.Item[*packParams, []string]{
 						Data: &packParams{
-							path:    p,
-							parsers: packer.parsers,
-							config:  packer.config,
+							path:     p,
+							parsers:  packer.parsers,
+							config:   packer.config,
+							manifest: manifest,
 						},
 						Output: nil,
 						Err:    nil,
@@ -215,6 +258,14 @@ func (packer *Packer) pack() error {
 		items,
 		packer.config.Concurrency,
 	)
+	if err != nil {
+		return err
+	}
+
+	if manifest != nil {
+		return manifest.write(packer.config.ManifestPath, packer.config.DestPath, 0)
+	}
+	return nil
 }
 
 // PackAssets packs extracted files back into game asset format.
@@ -1,56 +1,134 @@
 package wf
 
 import (
+	"bytes"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"log"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	"github.com/Jeffail/gabs/v2"
 	"github.com/blead/wfax/pkg/encoding"
 )
 
+const hxExt = ".hx"
+
+// hxImportPattern matches module imports, optionally aliased with as or in, wildcard imports of packages are not matched.
+var hxImportPattern = regexp.MustCompile(`(?m)^\s*import\s+([a-zA-Z_][a-zA-Z_0-9]*(?:\.[a-zA-Z_][a-zA-Z_0-9]*)+)\s*(?:(?:as|in)\s+[a-zA-Z_][a-zA-Z_0-9]*\s*)?;`)
+
 type parser interface {
 	getSrc(string, *ExtractorConfig) (string, error)
 	getDest(string, *ExtractorConfig) (string, error)
-	parse([]byte, *ExtractorConfig) ([]byte, error)
+	parse(string, []byte, *ExtractorConfig) ([]byte, error)
 	output([]byte, *ExtractorConfig) ([][]byte, error)
 	matchDest(string, *PackerConfig) (string, bool)
-	unparse([]byte, *PackerConfig) ([]byte, error)
+	unparse(string, []byte, *PackerConfig) ([]byte, error)
+}
+
+// dependentParser is implemented by parsers whose outputs also depend on other sources than the parsed one.
+type dependentParser interface {
+	// dependencies returns dump sources read while parsing path besides its own source.
+	dependencies(string, *ExtractorConfig) ([]string, error)
+}
+
+// fallbackParser is implemented by parsers which may write some sources in another format than the one of getDest.
+type fallbackParser interface {
+	// parseFallback parses like parse, also returning the extension replacing the one of getDest, empty if unchanged.
+	parseFallback(string, []byte, *ExtractorConfig) ([]byte, string, error)
+}
+
+type orderedmapParser struct {
+	// schemas describe names and types of CSV columns of tables
+	schemas schemas
+	// format is the output format of tables, JSON if empty
+	format string
+}
+
+func (parser *orderedmapParser) ext() string {
+	if parser.format == "" {
+		return "." + FormatJSON
+	}
+	return "." + parser.format
 }
 
-type orderedmapParser struct{}
+// comma returns the field delimiter of CSV formats.
+func (parser *orderedmapParser) comma() rune {
+	if parser.format == FormatTSV {
+		return '\t'
+	}
+	return ','
+}
 
 func (*orderedmapParser) getSrc(path string, config *ExtractorConfig) (string, error) {
 	src, err := sha1Digest(filepath.ToSlash(toMasterTablePath(string(path))), digestSalt)
 	if err != nil {
 		return "", err
 	}
-	return filepath.Join(config.SrcPath, dumpAssetDir, src[0:2], src[2:]), nil
+	return dumpPath(src), nil
+}
+
+func (parser *orderedmapParser) getDest(path string, config *ExtractorConfig) (string, error) {
+	return addExt(filepath.Join(config.DestPath, outputOrderedMapDir, filepath.FromSlash(path)), parser.ext()), nil
 }
 
-func (*orderedmapParser) getDest(path string, config *ExtractorConfig) (string, error) {
-	return addExt(filepath.Join(config.DestPath, outputOrderedMapDir, filepath.FromSlash(path)), ".json"), nil
+func (parser *orderedmapParser) parse(path string, raw []byte, config *ExtractorConfig) ([]byte, error) {
+	data, _, err := parser.parseFallback(path, raw, config)
+	return data, err
+}
+
+// parseFallback writes tables which cannot be a single CSV as JSON instead.
+func (parser *orderedmapParser) parseFallback(path string, raw []byte, config *ExtractorConfig) ([]byte, string, error) {
+	switch parser.format {
+	case FormatCSV, FormatTSV:
+		data, err := encoding.OrderedmapToCSV(raw, parser.schemas[path], parser.comma())
+		if !errors.Is(err, encoding.ErrUnsupportedCSV) {
+			return data, "", err
+		}
+		log.Printf("[WARN] Writing table as JSON, path=%s, err=%v\n", path, err)
+		data, err = parser.parseJSON(path, raw, config)
+		return data, "." + FormatJSON, err
+	}
+
+	data, err := parser.parseJSON(path, raw, config)
+	return data, "", err
 }
 
-func (*orderedmapParser) parse(raw []byte, config *ExtractorConfig) ([]byte, error) {
-	return encoding.OrderedmapToJSON(raw, config.Indent, config.FlattenCSV)
+func (parser *orderedmapParser) parseJSON(path string, raw []byte, config *ExtractorConfig) ([]byte, error) {
+	return encoding.OrderedmapToJSONWithOptions(raw, &encoding.OrderedmapOptions{
+		Indent:       config.Indent,
+		FlattenCSV:   config.FlattenCSV,
+		Schema:       parser.schemas[path],
+		NamedColumns: config.NamedColumns,
+		TypedValues:  config.TypedValues,
+	})
 }
 
 func (*orderedmapParser) output(raw []byte, config *ExtractorConfig) ([][]byte, error) {
 	return findAllPaths(raw)
 }
 
-func (*orderedmapParser) matchDest(dest string, config *PackerConfig) (string, bool) {
-	return matchPath(dest, filepath.Join(config.SrcPath, outputOrderedMapDir), ".json")
+func (parser *orderedmapParser) matchDest(dest string, config *PackerConfig) (string, bool) {
+	return matchPath(dest, outputOrderedMapDir, parser.ext())
 }
 
-func (*orderedmapParser) unparse(raw []byte, config *PackerConfig) ([]byte, error) {
-	return encoding.JSONToOrderedmap(raw)
+func (parser *orderedmapParser) unparse(path string, raw []byte, config *PackerConfig) ([]byte, error) {
+	switch parser.format {
+	case FormatCSV, FormatTSV:
+		return encoding.CSVToOrderedmap(raw, parser.comma())
+	}
+
+	return encoding.JSONToOrderedmapWithOptions(raw, &encoding.OrderedmapOptions{
+		Schema: parser.schemas[filepath.ToSlash(path)],
+	})
 }
 
 type amf3Parser struct {
 	ext string
+	// keys renames obfuscated keys if set
+	keys *encoding.KeyDictionary
 }
 
 func (parser *amf3Parser) getSrc(path string, config *ExtractorConfig) (string, error) {
@@ -58,15 +136,19 @@ func (parser *amf3Parser) getSrc(path string, config *ExtractorConfig) (string,
 	if err != nil {
 		return "", err
 	}
-	return filepath.Join(config.SrcPath, dumpAssetDir, src[0:2], src[2:]), nil
+	return dumpPath(src), nil
 }
 
 func (parser *amf3Parser) getDest(path string, config *ExtractorConfig) (string, error) {
 	return addExt(filepath.Join(config.DestPath, outputAssetsDir, filepath.FromSlash(path)), parser.ext+".json"), nil
 }
 
-func (*amf3Parser) parse(raw []byte, config *ExtractorConfig) ([]byte, error) {
-	return encoding.Amf3ToJSON(raw, config.Indent)
+func (parser *amf3Parser) parse(path string, raw []byte, config *ExtractorConfig) ([]byte, error) {
+	js, err := encoding.Amf3ToJSON(raw, config.Indent)
+	if err != nil || parser.keys == nil {
+		return js, err
+	}
+	return encoding.RenameJSONKeys(js, parser.keys, false, config.Indent)
 }
 
 func (*amf3Parser) output(raw []byte, config *ExtractorConfig) ([][]byte, error) {
@@ -74,10 +156,18 @@ func (*amf3Parser) output(raw []byte, config *ExtractorConfig) ([][]byte, error)
 }
 
 func (parser *amf3Parser) matchDest(dest string, config *PackerConfig) (string, bool) {
-	return matchPath(dest, filepath.Join(config.SrcPath, outputAssetsDir), parser.ext+".json")
+	return matchPath(dest, outputAssetsDir, parser.ext+".json")
 }
 
-func (*amf3Parser) unparse(raw []byte, config *PackerConfig) ([]byte, error) {
+func (parser *amf3Parser) unparse(path string, raw []byte, config *PackerConfig) ([]byte, error) {
+	if parser.keys != nil {
+		// files extracted without readable keys are left unchanged
+		js, err := encoding.RenameJSONKeys(raw, parser.keys, true, 0)
+		if err != nil {
+			return nil, err
+		}
+		raw = js
+	}
 	return encoding.JSONToAmf3(raw)
 }
 
@@ -101,6 +191,14 @@ func (*esdlParser) searchESDLPaths(jsonParsed *gabs.Container, s []string) []str
 }
 
 func (parser *esdlParser) output(raw []byte, config *ExtractorConfig) ([][]byte, error) {
+	// paths are searched by obfuscated keys
+	if parser.keys != nil {
+		js, err := encoding.RenameJSONKeys(raw, parser.keys, true, 0)
+		if err == nil {
+			raw = js
+		}
+	}
+
 	jsonParsed, err := gabs.ParseJSON(raw)
 	if err != nil {
 		return findAllPaths(raw)
@@ -156,6 +254,89 @@ func (parser *esdlParser) output(raw []byte, config *ExtractorConfig) ([][]byte,
 	return paths, nil
 }
 
+// stripHxComments blanks line and block comments of Haxe source outside of string literals, keeping line breaks.
+func stripHxComments(src []byte) []byte {
+	output := bytes.Clone(src)
+	var quote byte
+	for i := 0; i < len(output); i++ {
+		c := output[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '/' && i+1 < len(output) && output[i+1] == '/':
+			for ; i < len(output) && output[i] != '\n'; i++ {
+				output[i] = ' '
+			}
+		case c == '/' && i+1 < len(output) && output[i+1] == '*':
+			end := bytes.Index(output[i+2:], []byte("*/"))
+			if end < 0 {
+				end = len(output)
+			} else {
+				end += i + 4
+			}
+			for ; i < end; i++ {
+				if output[i] != '\n' {
+					output[i] = ' '
+				}
+			}
+			i--
+		}
+	}
+	return output
+}
+
+// hxParser extracts Haxe sources (flatomo layout ids, pinball scenes) which are hashed with their literal .hx extension.
+type hxParser struct{}
+
+func (*hxParser) getSrc(path string, config *ExtractorConfig) (string, error) {
+	// only paths ending with .hx are Haxe sources
+	if !strings.HasSuffix(path, hxExt) {
+		return "", nil
+	}
+
+	src, err := sha1Digest(filepath.ToSlash(path), digestSalt)
+	if err != nil {
+		return "", err
+	}
+	return dumpPath(src), nil
+}
+
+func (*hxParser) getDest(path string, config *ExtractorConfig) (string, error) {
+	return filepath.Join(config.DestPath, outputAssetsDir, filepath.FromSlash(path)), nil
+}
+
+func (*hxParser) parse(path string, raw []byte, config *ExtractorConfig) ([]byte, error) {
+	return encoding.DecodeText(raw)
+}
+
+func (*hxParser) output(raw []byte, config *ExtractorConfig) ([][]byte, error) {
+	paths, err := findAllPaths(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	// referenced Haxe modules, e.g. import pinball.scene.storyQuest.scenario.ScenarioLayer;
+	for _, match := range hxImportPattern.FindAllSubmatch(stripHxComments(raw), -1) {
+		paths = append(paths, []byte(strings.ReplaceAll(string(match[1]), ".", "/")+hxExt))
+	}
+
+	return paths, nil
+}
+
+func (*hxParser) matchDest(dest string, config *PackerConfig) (string, bool) {
+	return matchPath(dest, outputAssetsDir, hxExt)
+}
+
+func (*hxParser) unparse(path string, raw []byte, config *PackerConfig) ([]byte, error) {
+	return nil, fmt.Errorf("unparse hxParser: not implemented")
+}
+
 type pngParser struct {
 }
 
@@ -164,14 +345,17 @@ func (*pngParser) getSrc(path string, config *ExtractorConfig) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	return filepath.Join(config.SrcPath, dumpAssetDir, src[0:2], src[2:]), nil
+	return dumpPath(src), nil
 }
 
 func (*pngParser) getDest(path string, config *ExtractorConfig) (string, error) {
 	return addExt(filepath.Join(config.DestPath, outputAssetsDir, filepath.FromSlash(path)), ".png"), nil
 }
 
-func (*pngParser) parse(raw []byte, config *ExtractorConfig) ([]byte, error) {
+func (*pngParser) parse(path string, raw []byte, config *ExtractorConfig) ([]byte, error) {
+	if len(raw) < 4 {
+		return nil, fmt.Errorf("pngParser: png header too short, length=%d", len(raw))
+	}
 	// p n g
 	if raw[1] != 0x70 || raw[2] != 0x6e || raw[3] != 0x67 {
 		return nil, fmt.Errorf("pngParser: png header mismatch, expected: 706e67, found: %x", hex.EncodeToString(raw[1:4]))
@@ -189,10 +373,13 @@ func (*pngParser) output(raw []byte, config *ExtractorConfig) ([][]byte, error)
 }
 
 func (*pngParser) matchDest(dest string, config *PackerConfig) (string, bool) {
-	return matchPath(dest, filepath.Join(config.SrcPath, outputAssetsDir), ".png")
+	return matchPath(dest, outputAssetsDir, ".png")
 }
 
-func (*pngParser) unparse(raw []byte, config *PackerConfig) ([]byte, error) {
+func (*pngParser) unparse(path string, raw []byte, config *PackerConfig) ([]byte, error) {
+	if len(raw) < 4 {
+		return nil, fmt.Errorf("pngUnparser: png header too short, length=%d", len(raw))
+	}
 	// P N G
 	if raw[1] != 0x50 || raw[2] != 0x4e || raw[3] != 0x47 {
 		return nil, fmt.Errorf("pngUnparser: png header mismatch, expected: 504e47, found: %x", hex.EncodeToString(raw[1:4]))
@@ -205,44 +392,35 @@ func (*pngParser) unparse(raw []byte, config *PackerConfig) ([]byte, error) {
 	return raw, nil
 }
 
-type charPngParser struct {
-	*pngParser
-	srcTemplate  string
-	destTemplate string
-	width        int
-	height       int
+// rawParser copies files stored without encoding, e.g. voices.
+type rawParser struct {
+	ext string
 }
 
-func (parser *charPngParser) getSrc(path string, config *ExtractorConfig) (string, error) {
-	return parser.pngParser.getSrc(fmt.Sprintf(parser.srcTemplate, path), config)
+func (parser *rawParser) getSrc(path string, config *ExtractorConfig) (string, error) {
+	src, err := sha1Digest(filepath.ToSlash(addExt(string(path), parser.ext)), digestSalt)
+	if err != nil {
+		return "", err
+	}
+	return dumpPath(src), nil
 }
 
-func (parser *charPngParser) getDest(path string, config *ExtractorConfig) (string, error) {
-	return parser.pngParser.getDest(fmt.Sprintf(parser.destTemplate, path), config)
+func (parser *rawParser) getDest(path string, config *ExtractorConfig) (string, error) {
+	return addExt(filepath.Join(config.DestPath, outputAssetsDir, filepath.FromSlash(path)), parser.ext), nil
 }
 
-func (parser *charPngParser) parse(raw []byte, config *ExtractorConfig) ([]byte, error) {
-	src, err := parser.pngParser.parse(raw, config)
-	if err != nil {
-		return nil, err
-	}
-
-	return encoding.FitPNG(src, parser.width, parser.height)
+func (*rawParser) parse(path string, raw []byte, config *ExtractorConfig) ([]byte, error) {
+	return raw, nil
 }
 
-func (parser *charPngParser) matchDest(dest string, config *PackerConfig) (string, bool) {
-	p, found := parser.pngParser.matchDest(dest, config)
-	if !found {
-		return "", false
-	}
+func (*rawParser) output(raw []byte, config *ExtractorConfig) ([][]byte, error) {
+	return [][]byte{}, nil
+}
 
-	base, ext, found := strings.Cut(parser.destTemplate, "%s")
-	if !found {
-		return "", false
-	}
-	return matchPath(p, base, ext)
+func (parser *rawParser) matchDest(dest string, config *PackerConfig) (string, bool) {
+	return matchPath(dest, outputAssetsDir, parser.ext)
 }
 
-func (*charPngParser) unparse(raw []byte, config *PackerConfig) ([]byte, error) {
-	return nil, fmt.Errorf("unparse charPngParser: not implemented")
+func (*rawParser) unparse(path string, raw []byte, config *PackerConfig) ([]byte, error) {
+	return raw, nil
 }
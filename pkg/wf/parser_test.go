@@ -0,0 +1,51 @@
+package wf
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestHxParserOutput(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{"import", "package a;\nimport pinball.scene.storyQuest.ScenarioLayer;\n", []string{"pinball/scene/storyQuest/ScenarioLayer.hx"}},
+		{"alias", "import flatomo.generated.Layout as L;\nimport flatomo.generated.Util in U;\n", []string{"flatomo/generated/Layout.hx", "flatomo/generated/Util.hx"}},
+		{"wildcard", "import flatomo.generated.*;\n", nil},
+		{"line comment", "// import a.b.Hidden;\nimport a.b.Shown; // import a.b.Trailing;\n", []string{"a/b/Shown.hx"}},
+		{"block comment", "/*\nimport a.b.Hidden;\n*/\nimport a.b.Shown;\n", []string{"a/b/Shown.hx"}},
+		{"string", "var s = \"/*\";\nimport a.b.Shown;\nvar t = '*/';\n", []string{"a/b/Shown.hx"}},
+		{"not at line start", "var s = 1; import a.b.Inline;\n", nil},
+	}
+	for _, tt := range tests {
+		paths, err := (&hxParser{}).output([]byte(tt.src), &ExtractorConfig{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, p := range paths {
+			got = append(got, string(p))
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("output(%s) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHxParserParse(t *testing.T) {
+	got, err := (&hxParser{}).parse("flatomo/generated/a.hx", []byte("\xff\xfei\x00d\x00"), &ExtractorConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "id" {
+		t.Errorf("parse() = %q", got)
+	}
+	if _, err := (&hxParser{}).getSrc("flatomo/generated/a", &ExtractorConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	if src, _ := (&hxParser{}).getSrc("flatomo/generated/a", &ExtractorConfig{}); src != "" {
+		t.Errorf("getSrc() without .hx = %q, want empty", src)
+	}
+}
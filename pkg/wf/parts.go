@@ -0,0 +1,383 @@
+package wf
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io/fs"
+	"log"
+	"path"
+	"path/filepath"
+
+	"github.com/blead/wfax/pkg/concurrency"
+	"github.com/disintegration/imaging"
+)
+
+// composed images are written outside of assets so that they are not packed back
+const outputPartsDir = "parts"
+
+// PartsConfig is the configuration for the parts renderer.
+// Sources are read like ExtractorConfig sources, without SrcPaths.
+// Paths are asset paths of .parts files, every path of the default path list with a .parts file in the dump if empty.
+// If DestPath ends with .zip, .tar.gz or .tgz, images are written into a single archive.
+type PartsConfig struct {
+	SrcPath      string
+	SrcFS        fs.FS
+	Archives     []string
+	DestPath     string
+	Paths        []string
+	ManifestPath string
+	Scale        float32
+	Concurrency  int
+}
+
+// DefaultPartsConfig generates a default configuration.
+func DefaultPartsConfig() *PartsConfig {
+	return &PartsConfig{
+		SrcPath:      "",
+		SrcFS:        nil,
+		Archives:     nil,
+		DestPath:     "",
+		Paths:        nil,
+		ManifestPath: "",
+		Scale:        1,
+		Concurrency:  5,
+	}
+}
+
+// PartsRenderer composes images described by .parts assets.
+type PartsRenderer struct {
+	config *PartsConfig
+	sink   sink
+	// manifest is nil if no manifest is written
+	manifest *outputManifest
+}
+
+// NewPartsRenderer creates a new parts renderer with the supplied configuration.
+// If the configuration is nil, use DefaultPartsConfig.
+func NewPartsRenderer(config *PartsConfig) (*PartsRenderer, error) {
+	def := DefaultPartsConfig()
+	if def == nil {
+		return nil, fmt.Errorf("NewPartsRenderer: default configuration is nil")
+	}
+
+	if config == nil {
+		config = def
+	}
+
+	var err error
+	config.SrcPath, config.SrcFS, err = sourceConfig(config.SrcPath, nil, config.SrcFS, config.Archives)
+	if err != nil {
+		return nil, err
+	}
+	config.DestPath, err = workingPath(config.DestPath)
+	if err != nil {
+		return nil, err
+	}
+	if config.ManifestPath != "" {
+		config.ManifestPath = filepath.Clean(config.ManifestPath)
+	}
+
+	if config.Scale == 0 {
+		config.Scale = def.Scale
+	}
+	if config.Scale < 0 {
+		return nil, fmt.Errorf("NewPartsRenderer: negative scale, scale=%f", config.Scale)
+	}
+
+	if config.Concurrency == 0 {
+		config.Concurrency = def.Concurrency
+	}
+
+	return &PartsRenderer{config: config}, nil
+}
+
+func (renderer *PartsRenderer) extractorConfig() *ExtractorConfig {
+	return &ExtractorConfig{SrcPath: renderer.config.SrcPath, SrcFS: renderer.config.SrcFS}
+}
+
+type partsLayer struct {
+	image image.Image
+	x     int
+	y     int
+}
+
+type partsSet struct {
+	name   string
+	layers []*partsLayer
+}
+
+// partsData is the content of a .parts asset.
+// Images are asset paths, absolute or relative to the .parts asset, whose sheets or atlas sprites layers refer to.
+type partsData struct {
+	Images []string        `json:"images"`
+	Sets   []*partsSetData `json:"sets"`
+}
+
+type partsSetData struct {
+	Name   string            `json:"name"`
+	Layers []*partsLayerData `json:"layers"`
+}
+
+type partsLayerData struct {
+	Image string `json:"image"`
+	X     int    `json:"x"`
+	Y     int    `json:"y"`
+}
+
+func parsePartsData(data []byte) (*partsData, error) {
+	var parts partsData
+	err := decodeStrict(data, &parts)
+	if err != nil {
+		return nil, fmt.Errorf("parsePartsData: unable to parse parts, %w", err)
+	}
+	return &parts, nil
+}
+
+// loadPartsSheet adds the sheet of p to images, as sprites named by their atlas names or as a whole named p without an atlas.
+// Existing images take precedence. It returns false if p has no image.
+func loadPartsSheet(p string, images map[string]image.Image, config *ExtractorConfig) (bool, error) {
+	sheetPNG, _, err := readAsset(p, &pngParser{}, config, true)
+	if err != nil {
+		return false, err
+	}
+	if sheetPNG == nil {
+		return false, nil
+	}
+	sheet, err := imaging.Decode(bytes.NewReader(sheetPNG))
+	if err != nil {
+		return false, fmt.Errorf("loadPartsSheet: image decode error, path=%s, %w", p, err)
+	}
+
+	atlasJSON, _, err := readAsset(p, &amf3Parser{ext: ".atlas"}, config, true)
+	if err != nil {
+		return false, err
+	}
+	if atlasJSON == nil {
+		if images[p] == nil {
+			images[p] = sheet
+		}
+		return true, nil
+	}
+	sprites, err := parseAtlasNames(atlasJSON)
+	if err != nil {
+		return false, fmt.Errorf("loadPartsSheet: atlas error, path=%s, %w", p, err)
+	}
+	for name, params := range sprites {
+		if images[name] == nil {
+			images[name] = cropSprite(sheet, params)
+		}
+	}
+	return true, nil
+}
+
+// loadPartsImages loads images of the .parts asset at p, if it has any, and of its referenced images.
+// Sprites of the .parts asset itself and earlier references take precedence.
+func loadPartsImages(p string, parts *partsData, config *ExtractorConfig) (map[string]image.Image, error) {
+	images := make(map[string]image.Image)
+	_, err := loadPartsSheet(p, images, config)
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range parts.Images {
+		ok, err := loadPartsSheet(ref, images, config)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			continue
+		}
+		ok, err = loadPartsSheet(path.Join(path.Dir(p), ref), images, config)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("loadPartsImages: image not found, path=%s, image=%s", p, ref)
+		}
+	}
+	return images, nil
+}
+
+// partsSets resolves layers of the part sets to images, drawn in list order at their x and y offsets.
+func partsSets(parts *partsData, images map[string]image.Image) ([]*partsSet, error) {
+	sets := make([]*partsSet, 0, len(parts.Sets))
+	names := make(map[string]bool)
+	for idx, s := range parts.Sets {
+		if s == nil || s.Name == "" {
+			return nil, fmt.Errorf("partsSets: empty set name, idx=%d", idx)
+		}
+		if names[s.Name] {
+			return nil, fmt.Errorf("partsSets: duplicate set name, name=%s", s.Name)
+		}
+		names[s.Name] = true
+
+		set := &partsSet{name: s.Name}
+		for i, l := range s.Layers {
+			if l == nil {
+				return nil, fmt.Errorf("partsSets: empty layer, name=%s, idx=%d", s.Name, i)
+			}
+			img, ok := images[l.Image]
+			if !ok {
+				return nil, fmt.Errorf("partsSets: unknown image, name=%s, idx=%d, image=%s", s.Name, i, l.Image)
+			}
+			set.layers = append(set.layers, &partsLayer{image: img, x: l.X, y: l.Y})
+		}
+		if len(set.layers) == 0 {
+			return nil, fmt.Errorf("partsSets: empty set, name=%s", s.Name)
+		}
+		sets = append(sets, set)
+	}
+	return sets, nil
+}
+
+// compose draws layers of set on a canvas covering all of them.
+func (renderer *PartsRenderer) compose(set *partsSet) image.Image {
+	var bounds image.Rectangle
+	for i, layer := range set.layers {
+		r := layer.image.Bounds().Sub(layer.image.Bounds().Min).Add(image.Pt(layer.x, layer.y))
+		if i == 0 {
+			bounds = r
+		} else {
+			bounds = bounds.Union(r)
+		}
+	}
+
+	canvas := imaging.New(bounds.Dx(), bounds.Dy(), color.Transparent)
+	for _, layer := range set.layers {
+		canvas = imaging.Overlay(canvas, layer.image, image.Pt(layer.x, layer.y).Sub(bounds.Min), 1)
+	}
+
+	if renderer.config.Scale != 1 {
+		width := int(float32(bounds.Dx()) * renderer.config.Scale)
+		height := int(float32(bounds.Dy()) * renderer.config.Scale)
+		return imaging.Resize(canvas, width, height, imaging.Lanczos)
+	}
+	return canvas
+}
+
+// render writes composed images of the .parts asset at p.
+func (renderer *PartsRenderer) render(p string) error {
+	config := renderer.extractorConfig()
+	data, src, err := readAsset(p, &amf3Parser{ext: ".parts"}, config, false)
+	if err != nil {
+		return err
+	}
+
+	parts, err := parsePartsData(data)
+	if err != nil {
+		return fmt.Errorf("render: parts error, path=%s, %w", p, err)
+	}
+	images, err := loadPartsImages(p, parts, config)
+	if err != nil {
+		return err
+	}
+	sets, err := partsSets(parts, images)
+	if err != nil {
+		return fmt.Errorf("render: parts error, path=%s, %w", p, err)
+	}
+	if len(sets) == 0 {
+		log.Printf("[WARN] No part sets found, path=%s\n", p)
+		return nil
+	}
+
+	for _, set := range sets {
+		dest := addExt(path.Join(outputPartsDir, p, set.name), ".png")
+
+		var output bytes.Buffer
+		err = imaging.Encode(&output, renderer.compose(set), imaging.PNG, imaging.PNGCompressionLevel(png.BestCompression))
+		if err != nil {
+			return fmt.Errorf("render: encode error, path=%s, dest=%s, %w", p, dest, err)
+		}
+		err = renderer.sink.write(dest, output.Bytes())
+		if err != nil {
+			return fmt.Errorf("render: dest write error, dest=%s, %w", dest, err)
+		}
+		if renderer.manifest != nil {
+			entry, err := newManifestEntry(dest, p, "parts", src, output.Bytes())
+			if err != nil {
+				return err
+			}
+			renderer.manifest.add(entry)
+		}
+	}
+	return nil
+}
+
+// partsPaths returns the configured paths, or paths of the default path list with a .parts file in the dump.
+func (renderer *PartsRenderer) partsPaths() ([]string, error) {
+	if len(renderer.config.Paths) > 0 {
+		return renderer.config.Paths, nil
+	}
+
+	config := renderer.extractorConfig()
+	fsys := config.srcFS()
+	parser := &amf3Parser{ext: ".parts"}
+	var output []string
+	for _, p := range defaultPaths() {
+		src, err := parser.getSrc(p, config)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := fs.Stat(fsys, src); err == nil {
+			output = append(output, p)
+		}
+	}
+	return output, nil
+}
+
+// RenderParts composes images described by .parts assets into PNGs per part set.
+func (renderer *PartsRenderer) RenderParts() error {
+	log.Println("[INFO] Rendering parts")
+
+	paths, err := renderer.partsPaths()
+	if err != nil {
+		return err
+	}
+
+	var items []*concurrency.Item[string, bool]
+	for _, p := range paths {
+		items = append(items, &concurrency.Item[string, bool]{Data: p})
+	}
+
+	renderer.sink, err = newSink(renderer.config.DestPath)
+	if err != nil {
+		return err
+	}
+	if renderer.config.ManifestPath != "" {
+		renderer.manifest = newOutputManifest()
+	}
+
+	err = concurrency.Dispatcher(
+		func(i *concurrency.Item[string, bool]) ([]*concurrency.Item[string, bool], error) {
+			var output []*concurrency.Item[string, bool]
+			if !i.Output {
+				output = append(output, i)
+			}
+			return output, nil
+		},
+		func(i *concurrency.Item[string, bool]) (bool, error) {
+			return true, renderer.render(i.Data)
+		},
+		items,
+		renderer.config.Concurrency,
+	)
+	if err != nil {
+		renderer.sink.discard()
+		return err
+	}
+	err = renderer.sink.close()
+	if err != nil {
+		return err
+	}
+
+	if renderer.manifest != nil {
+		destDir := renderer.config.DestPath
+		if archiveFormat(destDir) != "" {
+			destDir = ""
+		}
+		return renderer.manifest.write(renderer.config.ManifestPath, destDir, 0)
+	}
+	return nil
+}
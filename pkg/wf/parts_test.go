@@ -0,0 +1,75 @@
+package wf
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestPartsSets(t *testing.T) {
+	body := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	for i := range body.Pix {
+		body.Pix[i] = 0xff
+	}
+	face := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+	face.SetNRGBA(0, 0, color.NRGBA{0xff, 0, 0, 0xff})
+	images := map[string]image.Image{"body": body, "face_smile": face}
+
+	parts, err := parsePartsData([]byte(`{"images":["face"],"sets":[{"name":"base","layers":[{"image":"body"}]},{"name":"smile","layers":[{"image":"body","x":0,"y":0},{"image":"face_smile","x":3,"y":1}]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parts.Images) != 1 || parts.Images[0] != "face" {
+		t.Fatalf("parsePartsData() images=%v", parts.Images)
+	}
+	sets, err := partsSets(parts, images)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sets) != 2 || sets[0].name != "base" || sets[1].name != "smile" || len(sets[1].layers) != 2 {
+		t.Fatalf("partsSets() = %+v", sets)
+	}
+
+	renderer, err := NewPartsRenderer(&PartsConfig{SrcPath: t.TempDir(), DestPath: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := renderer.compose(sets[1])
+	// later layers are drawn over earlier ones and extend the canvas
+	if size := img.Bounds().Size(); size != image.Pt(5, 4) {
+		t.Errorf("compose() size=%v", size)
+	}
+	if c := color.NRGBAModel.Convert(img.At(3, 1)).(color.NRGBA); c != (color.NRGBA{0xff, 0, 0, 0xff}) {
+		t.Errorf("compose() pixel=%v", c)
+	}
+
+	for name, data := range map[string]string{
+		"unknownField": `{"sets":[],"layout":{}}`,
+		"notObject":    `[["body"]]`,
+	} {
+		if _, err := parsePartsData([]byte(data)); err == nil {
+			t.Errorf("parsePartsData(%s) error = nil", name)
+		}
+	}
+	for name, data := range map[string]string{
+		"image":     `{"sets":[{"name":"a","layers":[{"image":"missing"}]}]}`,
+		"name":      `{"sets":[{"layers":[{"image":"body"}]}]}`,
+		"empty":     `{"sets":[{"name":"a","layers":[]}]}`,
+		"duplicate": `{"sets":[{"name":"a","layers":[{"image":"body"}]},{"name":"a","layers":[{"image":"body"}]}]}`,
+	} {
+		parts, err := parsePartsData([]byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := partsSets(parts, images); err == nil {
+			t.Errorf("partsSets(%s) error = nil", name)
+		}
+	}
+}
+
+func TestPartsImagesMissing(t *testing.T) {
+	_, err := loadPartsImages("ui/parts", &partsData{Images: []string{"missing"}}, &ExtractorConfig{SrcPath: t.TempDir()})
+	if err == nil {
+		t.Error("loadPartsImages() error = nil")
+	}
+}
@@ -0,0 +1,333 @@
+package wf
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Jeffail/gabs/v2"
+	"github.com/blead/wfax/assets"
+	"github.com/blead/wfax/pkg/encoding"
+	"github.com/disintegration/imaging"
+)
+
+const (
+	profileKeyPlaceholder = "{key}"
+	builtinProfileDir     = "profiles"
+	builtinBackgroundDir  = "backgrounds"
+	// EliyabotProfile is the name of the built-in profile exporting character images for eliyabot.
+	EliyabotProfile = "eliyabot"
+)
+
+// profileKeySource reads keys from a column of every row of a master table, e.g. devnames of character/character.
+type profileKeySource struct {
+	Table  string `json:"table"`
+	Column int    `json:"column"`
+}
+
+// profileExport converts the PNG asset at Src into Dest, both templates with {key} replaced by each key.
+// Dest is relative to the assets directory of the extraction.
+type profileExport struct {
+	Src    string `json:"src"`
+	Dest   string `json:"dest"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	// Fit is one of contain, cover, stretch or none, contain by default.
+	Fit string `json:"fit"`
+	// Background is a #rrggbb or #rrggbbaa color filling the canvas, transparent by default.
+	Background string `json:"background"`
+
+	background color.Color
+}
+
+// profileSprites composes sprites cropped by the spriter onto backgrounds by the rarity of their equipment.
+// Rarities are read from RarityColumn of the first row of every entry of Table, keyed by the devname in DevnameColumn.
+// Entries whose key also exists in EnhancementTable get another sprite on the Enhanced background.
+// Sprites without rarity are skipped, ability souls and rarities without background are centered on a transparent canvas.
+// Backgrounds are PNG files, or built-in backgrounds such as item_gold.png, resized to Size before scaling.
+// Dest is the directory of sprites relative to the assets directory.
+type profileSprites struct {
+	Dest             string            `json:"dest"`
+	Size             int               `json:"size"`
+	Table            string            `json:"table"`
+	DevnameColumn    int               `json:"devnameColumn"`
+	RarityColumn     int               `json:"rarityColumn"`
+	EnhancementTable string            `json:"enhancementTable"`
+	Backgrounds      map[string]string `json:"backgrounds"`
+	Enhanced         string            `json:"enhanced"`
+}
+
+// exportProfile describes images exported for a specific consumer.
+// Keys are added to the initial paths of an extraction and exports are applied to every extracted path.
+// Sprites are only used by the spriter.
+type exportProfile struct {
+	Name    string              `json:"name"`
+	Keys    []*profileKeySource `json:"keys"`
+	Exports []*profileExport    `json:"exports"`
+	Sprites *profileSprites     `json:"sprites"`
+}
+
+// parseColor parses #rrggbb or #rrggbbaa colors.
+func parseColor(s string) (color.Color, error) {
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "#"))
+	if err != nil || !strings.HasPrefix(s, "#") || (len(b) != 3 && len(b) != 4) {
+		return nil, fmt.Errorf("parseColor: invalid color, color=%s", s)
+	}
+	if len(b) == 3 {
+		b = append(b, 0xff)
+	}
+	return color.NRGBA{R: b[0], G: b[1], B: b[2], A: b[3]}, nil
+}
+
+func (export *profileExport) validate() error {
+	if !strings.Contains(export.Src, profileKeyPlaceholder) || !strings.Contains(export.Dest, profileKeyPlaceholder) {
+		return fmt.Errorf("src and dest templates require %s, src=%s, dest=%s", profileKeyPlaceholder, export.Src, export.Dest)
+	}
+	if strings.Count(export.Dest, profileKeyPlaceholder) != 1 {
+		return fmt.Errorf("dest template requires exactly one %s, dest=%s", profileKeyPlaceholder, export.Dest)
+	}
+
+	if export.Fit == "" {
+		export.Fit = encoding.FitContain
+	}
+	switch export.Fit {
+	case encoding.FitContain, encoding.FitCover, encoding.FitStretch:
+		if export.Width <= 0 || export.Height <= 0 {
+			return fmt.Errorf("width and height are required, fit=%s, dest=%s", export.Fit, export.Dest)
+		}
+	case encoding.FitNone:
+		if export.Width < 0 || export.Height < 0 {
+			return fmt.Errorf("negative size, dest=%s", export.Dest)
+		}
+	default:
+		return fmt.Errorf("unknown fit mode, fit=%s, dest=%s", export.Fit, export.Dest)
+	}
+
+	if export.Background != "" {
+		c, err := parseColor(export.Background)
+		if err != nil {
+			return err
+		}
+		export.background = c
+	}
+	return nil
+}
+
+func (sprites *profileSprites) validate() error {
+	if sprites.Dest == "" || sprites.Table == "" {
+		return fmt.Errorf("dest and table are required, dest=%s, table=%s", sprites.Dest, sprites.Table)
+	}
+	if sprites.Size <= 0 {
+		return fmt.Errorf("size is required, dest=%s", sprites.Dest)
+	}
+	if sprites.DevnameColumn < 0 || sprites.RarityColumn < 0 {
+		return fmt.Errorf("negative column, devnameColumn=%d, rarityColumn=%d", sprites.DevnameColumn, sprites.RarityColumn)
+	}
+	for r := range sprites.Backgrounds {
+		_, err := strconv.Atoi(r)
+		if err != nil {
+			return fmt.Errorf("invalid background rarity, rarity=%s", r)
+		}
+	}
+	if sprites.EnhancementTable != "" && sprites.Enhanced == "" {
+		return fmt.Errorf("enhanced background is required, enhancementTable=%s", sprites.EnhancementTable)
+	}
+	return nil
+}
+
+// loadBackground reads the PNG file at name, or the built-in background called name if no such file exists.
+func loadBackground(name string) (image.Image, error) {
+	data, err := os.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		data, err = fs.ReadFile(assets.Backgrounds, path.Join(builtinBackgroundDir, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("loadBackground: background not found, name=%s", name)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("loadBackground: read error, name=%s, %w", name, err)
+	}
+
+	img, err := imaging.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("loadBackground: decode error, name=%s, %w", name, err)
+	}
+	return img, nil
+}
+
+func parseProfile(data []byte) (*exportProfile, error) {
+	profile := &exportProfile{}
+	err := json.Unmarshal(data, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	if profile.Name == "" {
+		return nil, fmt.Errorf("parseProfile: name is required")
+	}
+	if len(profile.Exports) == 0 && profile.Sprites == nil {
+		return nil, fmt.Errorf("parseProfile: no exports or sprites, name=%s", profile.Name)
+	}
+	for _, k := range profile.Keys {
+		if k.Table == "" || k.Column < 0 {
+			return nil, fmt.Errorf("parseProfile: invalid key source, name=%s, table=%s, column=%d", profile.Name, k.Table, k.Column)
+		}
+	}
+	for _, e := range profile.Exports {
+		err := e.validate()
+		if err != nil {
+			return nil, fmt.Errorf("parseProfile: invalid export, name=%s, %w", profile.Name, err)
+		}
+	}
+	if profile.Sprites != nil {
+		err := profile.Sprites.validate()
+		if err != nil {
+			return nil, fmt.Errorf("parseProfile: invalid sprites, name=%s, %w", profile.Name, err)
+		}
+	}
+	return profile, nil
+}
+
+// loadProfile reads the profile file at name, or the built-in profile called name if no such file exists.
+func loadProfile(name string) (*exportProfile, error) {
+	data, err := os.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		data, err = fs.ReadFile(assets.Profiles, path.Join(builtinProfileDir, name+".json"))
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("loadProfile: profile not found, name=%s", name)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("loadProfile: read error, name=%s, %w", name, err)
+	}
+
+	profile, err := parseProfile(data)
+	if err != nil {
+		return nil, fmt.Errorf("loadProfile: parse error, name=%s, %w", name, err)
+	}
+	return profile, nil
+}
+
+// parsers returns a parser per export of the profile.
+func (profile *exportProfile) parsers() []parser {
+	var output []parser
+	for _, e := range profile.Exports {
+		output = append(output, &profileParser{pngParser: &pngParser{}, profile: profile.Name, export: e})
+	}
+	return output
+}
+
+// collectColumn appends non-empty values of column of every row in the table c at key.
+func collectColumn(c *gabs.Container, key string, column int, output []string) ([]string, error) {
+	switch val := c.Data().(type) {
+	case map[string]any:
+		var err error
+		for k, child := range c.ChildrenMap() {
+			output, err = collectColumn(child, path.Join(key, k), column, output)
+			if err != nil {
+				return nil, err
+			}
+		}
+	case []any:
+		for i, row := range val {
+			cells, ok := row.([]any)
+			if !ok || column >= len(cells) {
+				return nil, fmt.Errorf("collectColumn: unable to parse key, key=%s, row=%d, column=%d", key, i, column)
+			}
+			s, ok := cells[column].(string)
+			if !ok {
+				return nil, fmt.Errorf("collectColumn: unable to parse key, key=%s, row=%d, column=%d", key, i, column)
+			}
+			if s != "" {
+				output = append(output, s)
+			}
+		}
+	}
+	return output, nil
+}
+
+// keys reads keys of all key sources of the profile.
+func (profile *exportProfile) keys(config *ExtractorConfig) ([]string, error) {
+	var output []string
+	for _, k := range profile.Keys {
+		jsonParsed, err := readMasterTable(k.Table, config)
+		if err != nil {
+			return nil, fmt.Errorf("keys exportProfile: key source error, name=%s, table=%s, %w", profile.Name, k.Table, err)
+		}
+		output, err = collectColumn(jsonParsed, "", k.Column, output)
+		if err != nil {
+			return nil, fmt.Errorf("keys exportProfile: key source error, name=%s, table=%s, %w", profile.Name, k.Table, err)
+		}
+	}
+	return output, nil
+}
+
+// profileParser exports PNG assets resized according to an export of a profile.
+type profileParser struct {
+	*pngParser
+	profile string
+	export  *profileExport
+}
+
+func (parser *profileParser) getSrc(path string, config *ExtractorConfig) (string, error) {
+	return parser.pngParser.getSrc(strings.ReplaceAll(parser.export.Src, profileKeyPlaceholder, path), config)
+}
+
+func (parser *profileParser) getDest(path string, config *ExtractorConfig) (string, error) {
+	return parser.pngParser.getDest(strings.ReplaceAll(parser.export.Dest, profileKeyPlaceholder, path), config)
+}
+
+func (parser *profileParser) parse(path string, raw []byte, config *ExtractorConfig) ([]byte, error) {
+	src, err := parser.pngParser.parse(path, raw, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return encoding.ResizePNG(src, &encoding.ResizeOptions{
+		Width:      parser.export.Width,
+		Height:     parser.export.Height,
+		Fit:        parser.export.Fit,
+		Background: parser.export.background,
+	})
+}
+
+func (parser *profileParser) matchDest(dest string, config *PackerConfig) (string, bool) {
+	p, found := parser.pngParser.matchDest(dest, config)
+	if !found {
+		return "", false
+	}
+
+	base, ext, found := strings.Cut(parser.export.Dest, profileKeyPlaceholder)
+	if !found {
+		return "", false
+	}
+	return matchPath(p, base, ext)
+}
+
+func (*profileParser) unparse(path string, raw []byte, config *PackerConfig) ([]byte, error) {
+	return nil, fmt.Errorf("unparse profileParser: not implemented")
+}
+
+// profilePath returns profile, the built-in eliyabot profile if eliyabot is set.
+func profilePath(profile string, eliyabot bool) (string, error) {
+	if eliyabot {
+		if profile != "" && profile != EliyabotProfile {
+			return "", fmt.Errorf("profilePath: eliyabot mode conflicts with profile, profile=%s", profile)
+		}
+		return EliyabotProfile, nil
+	}
+	if profile == "" {
+		return "", nil
+	}
+	return filepath.Clean(profile), nil
+}
@@ -0,0 +1,119 @@
+package wf
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/Jeffail/gabs/v2"
+	"github.com/blead/wfax/pkg/encoding"
+)
+
+func TestEliyabotProfile(t *testing.T) {
+	src := func(p string, ext string) string {
+		h, err := sha1Digest(addExt(p, ext), digestSalt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return dumpPath(h)
+	}
+	table, err := encoding.JSONToOrderedmap([]byte(`{"1":[["alk","Alk"]]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var img bytes.Buffer
+	err = png.Encode(&img, image.NewNRGBA(image.Rect(0, 0, 40, 20)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fitted, err := encoding.FitPNG(img.Bytes(), 82, 82)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// dumped PNGs have a lowercase signature
+	dumped := bytes.Replace(img.Bytes(), []byte("PNG"), []byte("png"), 1)
+
+	dir := t.TempDir()
+	extractor, err := NewExtractor(&ExtractorConfig{
+		SrcFS: fstest.MapFS{
+			src(toMasterTablePath(characterTable), ""): {Data: table},
+			src("character/alk/ui/square_0", ".png"):   {Data: dumped},
+		},
+		DestPath:       dir,
+		NoDefaultPaths: true,
+		Eliyabot:       true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = extractor.ExtractAssets()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(filepath.Join(dir, outputAssetsDir, "eliyabot", "chars", "alk", "square_0.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, fitted) {
+		t.Errorf("eliyabot square_0 differs from FitPNG output")
+	}
+
+	_, err = NewExtractor(&ExtractorConfig{DestPath: dir, Profile: "unknown"})
+	if err == nil {
+		t.Errorf("NewExtractor() with unknown profile, want error")
+	}
+}
+
+func TestParseProfile(t *testing.T) {
+	profile, err := parseProfile([]byte(`{"name":"bot","exports":[{"src":"character/{key}/ui/square_0","dest":"bot/{key}","width":10,"height":10,"fit":"cover","background":"#ff000080"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := profile.Exports[0].background; c != (color.NRGBA{R: 0xff, A: 0x80}) {
+		t.Errorf("background = %v", c)
+	}
+
+	invalid := []string{
+		`{"exports":[{"src":"{key}","dest":"{key}","width":1,"height":1}]}`,
+		`{"name":"bot","exports":[{"src":"a","dest":"{key}","width":1,"height":1}]}`,
+		`{"name":"bot","exports":[{"src":"{key}","dest":"{key}"}]}`,
+		`{"name":"bot","exports":[{"src":"{key}","dest":"{key}","width":1,"height":1,"fit":"tile"}]}`,
+		`{"name":"bot","exports":[{"src":"{key}","dest":"{key}","width":1,"height":1,"background":"red"}]}`,
+		`{"name":"bot","sprites":{"dest":"bot","table":"item/equipment"}}`,
+		`{"name":"bot","sprites":{"dest":"bot","size":24,"table":"item/equipment","backgrounds":{"gold":"item_gold.png"}}}`,
+		`{"name":"bot","sprites":{"dest":"bot","size":24,"table":"item/equipment","enhancementTable":"equipment_enhancement/equipment_enhancement"}}`,
+	}
+	for _, data := range invalid {
+		_, err := parseProfile([]byte(data))
+		if err == nil {
+			t.Errorf("parseProfile(%s), want error", data)
+		}
+	}
+}
+
+func TestCollectColumn(t *testing.T) {
+	for data, valid := range map[string]bool{
+		`{"1":[["alk"]],"2":{"3":[["",""]]}}`: true,
+		`{"1":[["alk"]],"2":[[2]]}`:           false,
+		`{"1":[[]]}`:                          false,
+	} {
+		c, err := gabs.ParseJSON([]byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys, err := collectColumn(c, "", 0, nil)
+		if valid && (err != nil || len(keys) != 1 || keys[0] != "alk") {
+			t.Errorf("collectColumn(%s) = %v, %v, want [alk]", data, keys, err)
+		}
+		if !valid && err == nil {
+			t.Errorf("collectColumn(%s) = %v, want error", data, keys)
+		}
+	}
+}
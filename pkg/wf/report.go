@@ -0,0 +1,61 @@
+package wf
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+const defaultReportPath = ".failures.json"
+
+// ErrPartialFailure is wrapped by errors of runs which kept going after some files failed.
+var ErrPartialFailure = errors.New("some files failed")
+
+// extractFailure records a path which failed to be extracted by a parser.
+type extractFailure struct {
+	Path   string `json:"path"`
+	Parser string `json:"parser"`
+	// Source is the hashed source file of the path, empty if it could not be resolved.
+	Source string `json:"source"`
+	Error  string `json:"error"`
+}
+
+// failureReport collects failures of an extraction run with KeepGoing.
+type failureReport struct {
+	Failures []*extractFailure `json:"failures"`
+
+	mu sync.Mutex
+}
+
+func newFailureReport() *failureReport {
+	return &failureReport{Failures: []*extractFailure{}}
+}
+
+func (report *failureReport) add(failure *extractFailure) {
+	report.mu.Lock()
+	defer report.mu.Unlock()
+	report.Failures = append(report.Failures, failure)
+}
+
+// len returns the number of failures.
+func (report *failureReport) len() int {
+	report.mu.Lock()
+	defer report.mu.Unlock()
+	return len(report.Failures)
+}
+
+// write writes failures sorted by path and parser, the report is written even if empty to replace previous failures.
+func (report *failureReport) write(path string, indent int) error {
+	report.mu.Lock()
+	defer report.mu.Unlock()
+
+	sort.Slice(report.Failures, func(i, j int) bool {
+		a, b := report.Failures[i], report.Failures[j]
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return a.Parser < b.Parser
+	})
+
+	return writeJSON(path, report, indent)
+}
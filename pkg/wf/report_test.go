@@ -0,0 +1,118 @@
+package wf
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/blead/wfax/pkg/concurrency"
+	"github.com/blead/wfax/pkg/encoding"
+)
+
+func TestExtractKeepGoing(t *testing.T) {
+	master := func(p string) string {
+		h, err := sha1Digest(toMasterTablePath(p), digestSalt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return dumpPath(h)
+	}
+	table, err := encoding.JSONToOrderedmap([]byte(`[["a"]]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys := fstest.MapFS{
+		master("a/a"): {Data: table},
+		master("b/b"): {Data: []byte("corrupt")},
+	}
+
+	dir := t.TempDir()
+	config := func(keepGoing bool) *ExtractorConfig {
+		pathList := filepath.Join(dir, "pathlist")
+		err := os.WriteFile(pathList, []byte("a/a\nb/b\n"), 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &ExtractorConfig{SrcFS: fsys, DestPath: filepath.Join(dir, "output"), PathList: pathList, NoDefaultPaths: true, KeepGoing: keepGoing}
+	}
+
+	extractor, err := NewExtractor(config(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = extractor.ExtractAssets()
+	if err == nil || errors.Is(err, ErrPartialFailure) {
+		t.Errorf("ExtractAssets() = %v, want abort", err)
+	}
+
+	extractor, err = NewExtractor(config(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = extractor.ExtractAssets()
+	if !errors.Is(err, ErrPartialFailure) {
+		t.Errorf("ExtractAssets() = %v, want ErrPartialFailure", err)
+	}
+
+	_, err = os.Stat(filepath.Join(dir, "output", outputOrderedMapDir, "a", "a.json"))
+	if err != nil {
+		t.Errorf("a/a not extracted, %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "output", defaultReportPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := &failureReport{}
+	err = json.Unmarshal(data, report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Failures) != 1 || report.Failures[0].Path != "b/b" || report.Failures[0].Source != master("b/b") {
+		t.Errorf("failures = %+v, want b/b", report.Failures)
+	}
+}
+
+// panicParser panics while parsing pngs, like parsers reading malformed sources.
+type panicParser struct {
+	pngParser
+}
+
+func (*panicParser) parse(path string, raw []byte, config *ExtractorConfig) ([]byte, error) {
+	panic("malformed")
+}
+
+func TestExtractPathRecover(t *testing.T) {
+	h, err := sha1Digest("a/a.png", digestSalt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ExtractorConfig{SrcFS: fstest.MapFS{dumpPath(h): {Data: []byte("\x89png")}}, DestPath: t.TempDir()}
+	report := newFailureReport()
+
+	// the png parser after the panicking parser still extracts the path
+	output, err := extractPath(&concurrency.Item[*extractParams, []*parserOutput]{Data: &extractParams{
+		path:    "a/a",
+		parsers: []parser{&panicParser{}, &pngParser{}},
+		config:  config,
+		sink:    memorySink{},
+		report:  report,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(output) != 1 {
+		t.Errorf("outputs = %d, want 1", len(output))
+	}
+	if report.len() != 1 {
+		t.Errorf("failures = %d, want 1", report.len())
+	}
+
+	_, err = (&pngParser{}).parse("a/a", []byte("\x89p"), config)
+	if err == nil {
+		t.Errorf("parse of truncated png = nil error")
+	}
+}
@@ -0,0 +1,386 @@
+package wf
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+
+	"github.com/blead/wfax/assets"
+)
+
+// relation joins rows of Table into documents of its parent table.
+// Column is the column of the first parent row holding keys of Table, the parent key if empty.
+// If TargetColumn is set, every entry of Table whose first row has the value in TargetColumn is joined as a list instead.
+// Columns are indexes or names of the table schemas.
+type relation struct {
+	Name         string      `json:"name"`
+	Table        string      `json:"table"`
+	Column       string      `json:"column,omitempty"`
+	TargetColumn string      `json:"targetColumn,omitempty"`
+	Relations    []*relation `json:"relations,omitempty"`
+}
+
+// relationDocument describes documents made of entries of Table and their relations.
+type relationDocument struct {
+	Table     string      `json:"table"`
+	Relations []*relation `json:"relations,omitempty"`
+}
+
+// relations maps document names to their definitions.
+type relations map[string]*relationDocument
+
+func validateRelations(table string, rels []*relation) error {
+	names := map[string]bool{resolveKeyField: true, resolveRowsField: true}
+	for _, r := range rels {
+		if r.Name == "" || r.Table == "" {
+			return fmt.Errorf("validateRelations: empty relation name or table, table=%s, name=%s", table, r.Name)
+		}
+		if names[r.Name] {
+			return fmt.Errorf("validateRelations: duplicate relation name, table=%s, name=%s", table, r.Name)
+		}
+		names[r.Name] = true
+		err := validateRelations(r.Table, r.Relations)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseRelations(data []byte) (relations, error) {
+	var r relations
+	err := json.Unmarshal(data, &r)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, doc := range r {
+		if doc == nil || doc.Table == "" {
+			return nil, fmt.Errorf("parseRelations: empty table, name=%s", name)
+		}
+		err := validateRelations(doc.Table, doc.Relations)
+		if err != nil {
+			return nil, fmt.Errorf("parseRelations: invalid relations, name=%s, %w", name, err)
+		}
+	}
+	return r, nil
+}
+
+// loadRelations reads the default relations and overrides them per document with relations from path if supplied.
+func loadRelations(path string) (relations, error) {
+	r, err := parseRelations(assets.Relations)
+	if err != nil {
+		return nil, fmt.Errorf("loadRelations: default relations error, %w", err)
+	}
+
+	if path == "" {
+		return r, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("loadRelations: read error, path=%s, %w", path, err)
+	}
+	custom, err := parseRelations(data)
+	if err != nil {
+		return nil, fmt.Errorf("loadRelations: parse error, path=%s, %w", path, err)
+	}
+
+	for name, doc := range custom {
+		r[name] = doc
+	}
+	return r, nil
+}
+
+// checkRelationColumns warns about columns which are neither indexes nor named by the schemas, joining nothing.
+func checkRelationColumns(name string, table string, rels []*relation, s schemas) {
+	for _, r := range rels {
+		if _, ok := s[table].ColumnIndex(r.Column); r.Column != "" && !ok {
+			log.Printf("[WARN] Relation column not named by schema, name=%s, table=%s, column=%s\n", name, table, r.Column)
+		}
+		if _, ok := s[r.Table].ColumnIndex(r.TargetColumn); r.TargetColumn != "" && !ok {
+			log.Printf("[WARN] Relation column not named by schema, name=%s, table=%s, column=%s\n", name, r.Table, r.TargetColumn)
+		}
+		checkRelationColumns(name, r.Table, r.Relations, s)
+	}
+}
+
+const (
+	resolveKeyField  = "key"
+	resolveRowsField = "rows"
+)
+
+// ResolveConfig is the configuration for the relation resolver.
+// Sources are read like ExtractorConfig sources, without SrcPaths.
+// Documents of each relation definition, or only of Names if supplied, are written into [DestPath]/[name].json.
+type ResolveConfig struct {
+	SrcPath       string
+	SrcFS         fs.FS
+	Archives      []string
+	DestPath      string
+	RelationsPath string
+	SchemaPath    string
+	Names         []string
+	Indent        int
+}
+
+// DefaultResolveConfig generates a default configuration.
+func DefaultResolveConfig() *ResolveConfig {
+	return &ResolveConfig{
+		SrcPath:       "",
+		SrcFS:         nil,
+		Archives:      nil,
+		DestPath:      "",
+		RelationsPath: "",
+		SchemaPath:    "",
+		Names:         nil,
+		Indent:        0,
+	}
+}
+
+// Resolver joins master tables into denormalized documents.
+type Resolver struct {
+	config    *ResolveConfig
+	relations relations
+	schemas   schemas
+	// tables caches read master tables, nil if missing
+	tables map[string]map[string]any
+	// indexes caches keys of table entries by table, column and value
+	indexes map[string]map[string]map[string][]string
+}
+
+// NewResolver creates a new resolver with the supplied configuration.
+// If the configuration is nil, use DefaultResolveConfig.
+func NewResolver(config *ResolveConfig) (*Resolver, error) {
+	def := DefaultResolveConfig()
+	if def == nil {
+		return nil, fmt.Errorf("NewResolver: default configuration is nil")
+	}
+
+	if config == nil {
+		config = def
+	}
+
+	var err error
+	config.SrcPath, config.SrcFS, err = sourceConfig(config.SrcPath, nil, config.SrcFS, config.Archives)
+	if err != nil {
+		return nil, err
+	}
+	config.DestPath, err = workingPath(config.DestPath)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := loadRelations(config.RelationsPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range config.Names {
+		if r[name] == nil {
+			return nil, fmt.Errorf("NewResolver: unknown relation, name=%s", name)
+		}
+	}
+	s, err := loadSchemas(config.SchemaPath)
+	if err != nil {
+		return nil, err
+	}
+	for name, doc := range r {
+		if len(config.Names) == 0 || slices.Contains(config.Names, name) {
+			checkRelationColumns(name, doc.Table, doc.Relations, s)
+		}
+	}
+
+	return &Resolver{
+		config:    config,
+		relations: r,
+		schemas:   s,
+		tables:    map[string]map[string]any{},
+		indexes:   map[string]map[string]map[string][]string{},
+	}, nil
+}
+
+// table reads a master table by path once, returning nil if it does not exist in the dump.
+func (resolver *Resolver) table(p string) (map[string]any, error) {
+	if t, ok := resolver.tables[p]; ok {
+		return t, nil
+	}
+
+	c, err := readMasterTable(p, &ExtractorConfig{SrcPath: resolver.config.SrcPath, SrcFS: resolver.config.SrcFS})
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		log.Printf("[WARN] Master table not found, path=%s\n", p)
+		resolver.tables[p] = nil
+		return nil, nil
+	}
+	t, _ := c.Data().(map[string]any)
+	resolver.tables[p] = t
+	return t, nil
+}
+
+// firstRow returns the first row of a table entry, descending into nested keys in sorted order.
+func firstRow(entry any) []any {
+	switch val := entry.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if row := firstRow(val[k]); row != nil {
+				return row
+			}
+		}
+	case []any:
+		if len(val) > 0 {
+			row, _ := val[0].([]any)
+			return row
+		}
+	}
+	return nil
+}
+
+// cell returns the value of column in the first row of entry.
+func (resolver *Resolver) cell(table string, entry any, column string) (string, bool) {
+	i, ok := resolver.schemas[table].ColumnIndex(column)
+	if !ok {
+		return "", false
+	}
+	row := firstRow(entry)
+	if i >= len(row) {
+		return "", false
+	}
+	s, ok := row[i].(string)
+	return s, ok && s != ""
+}
+
+// index returns keys of table entries by their values of column.
+func (resolver *Resolver) index(table string, t map[string]any, column string) map[string][]string {
+	if resolver.indexes[table] == nil {
+		resolver.indexes[table] = map[string]map[string][]string{}
+	}
+	if idx, ok := resolver.indexes[table][column]; ok {
+		return idx
+	}
+
+	idx := map[string][]string{}
+	for k, entry := range t {
+		if v, ok := resolver.cell(table, entry, column); ok {
+			idx[v] = append(idx[v], k)
+		}
+	}
+	for _, keys := range idx {
+		sort.Slice(keys, func(i, j int) bool { return lessKeyPath(keys[i], keys[j]) })
+	}
+	resolver.indexes[table][column] = idx
+	return idx
+}
+
+// document returns the entry of table at key with rows of its relations embedded.
+// Unmatched relations are null, or empty lists for relations by TargetColumn.
+func (resolver *Resolver) document(table string, key string, rels []*relation) (map[string]any, error) {
+	t, err := resolver.table(table)
+	if err != nil {
+		return nil, err
+	}
+	entry, ok := t[key]
+	if !ok {
+		return nil, nil
+	}
+
+	doc := map[string]any{resolveKeyField: key, resolveRowsField: entry}
+	for _, r := range rels {
+		value := key
+		if r.Column != "" {
+			value, ok = resolver.cell(table, entry, r.Column)
+			if !ok {
+				doc[r.Name] = nil
+				continue
+			}
+		}
+
+		if r.TargetColumn == "" {
+			child, err := resolver.document(r.Table, value, r.Relations)
+			if err != nil {
+				return nil, err
+			}
+			if child == nil {
+				doc[r.Name] = nil
+			} else {
+				doc[r.Name] = child
+			}
+			continue
+		}
+
+		target, err := resolver.table(r.Table)
+		if err != nil {
+			return nil, err
+		}
+		children := []map[string]any{}
+		for _, k := range resolver.index(r.Table, target, r.TargetColumn)[value] {
+			child, err := resolver.document(r.Table, k, r.Relations)
+			if err != nil {
+				return nil, err
+			}
+			children = append(children, child)
+		}
+		doc[r.Name] = children
+	}
+	return doc, nil
+}
+
+// resolve returns documents of every entry of the relation definition name by key.
+func (resolver *Resolver) resolve(name string) (map[string]any, error) {
+	def := resolver.relations[name]
+	t, err := resolver.table(def.Table)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return nil, fmt.Errorf("resolve: master table not found, name=%s, table=%s", name, def.Table)
+	}
+
+	output := make(map[string]any, len(t))
+	for key := range t {
+		doc, err := resolver.document(def.Table, key, def.Relations)
+		if err != nil {
+			return nil, fmt.Errorf("resolve: document error, name=%s, key=%s, %w", name, key, err)
+		}
+		output[key] = doc
+	}
+	return output, nil
+}
+
+// Resolve writes denormalized documents of each relation definition, joining master tables by keys or columns.
+func (resolver *Resolver) Resolve() error {
+	log.Println("[INFO] Resolving master table relations")
+
+	names := resolver.config.Names
+	if len(names) == 0 {
+		for name := range resolver.relations {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	for _, name := range names {
+		docs, err := resolver.resolve(name)
+		if err != nil {
+			return err
+		}
+		err = writeJSON(filepath.Join(resolver.config.DestPath, name+".json"), docs, resolver.config.Indent)
+		if err != nil {
+			return err
+		}
+		log.Printf("[INFO] Resolved relations, name=%s, documents=%d\n", name, len(docs))
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package wf
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/blead/wfax/pkg/encoding"
+)
+
+func TestResolve(t *testing.T) {
+	src := func(p string) string {
+		h, err := sha1Digest(toMasterTablePath(p), digestSalt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return dumpPath(h)
+	}
+	table := func(js string) []byte {
+		data, err := encoding.JSONToOrderedmap([]byte(js))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	dir := t.TempDir()
+	relationsPath := filepath.Join(dir, "relations.json")
+	err := os.WriteFile(relationsPath, []byte(`{"weapon":{"table":"weapon","relations":[
+		{"name":"ability","table":"ability","column":"1","relations":[{"name":"effects","table":"effect","targetColumn":"0"}]},
+		{"name":"enhancement","table":"enhancement"}
+	]}}`), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resolver, err := NewResolver(&ResolveConfig{
+		SrcFS: fstest.MapFS{
+			src("weapon"):      {Data: table(`{"1":[["sword","10"]],"2":[["bow","99"]]}`)},
+			src("ability"):     {Data: table(`{"10":[["slash"]]}`)},
+			src("effect"):      {Data: table(`{"a":[["10","burn"]],"b":[["11","freeze"]],"c":[["10","stun"]]}`)},
+			src("enhancement"): {Data: table(`{"1":[["sword_plus"]]}`)},
+		},
+		DestPath:      filepath.Join(dir, "out"),
+		RelationsPath: relationsPath,
+		Names:         []string{"weapon"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = resolver.Resolve()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "out", "weapon.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var compact bytes.Buffer
+	err = json.Compact(&compact, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"1":{"ability":{"effects":[{"key":"a","rows":[["10","burn"]]},{"key":"c","rows":[["10","stun"]]}],"key":"10","rows":[["slash"]]},"enhancement":{"key":"1","rows":[["sword_plus"]]},"key":"1","rows":[["sword","10"]]},` +
+		`"2":{"ability":null,"enhancement":null,"key":"2","rows":[["bow","99"]]}}`
+	if compact.String() != want {
+		t.Errorf("documents = %s, want %s", compact.String(), want)
+	}
+}
+
+func TestDefaultRelations(t *testing.T) {
+	src := func(p string) string {
+		h, err := sha1Digest(toMasterTablePath(p), digestSalt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return dumpPath(h)
+	}
+	table := func(js string) []byte {
+		data, err := encoding.JSONToOrderedmap([]byte(js))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	dir := t.TempDir()
+	resolver, err := NewResolver(&ResolveConfig{
+		SrcFS: fstest.MapFS{
+			src("item/equipment"):                              {Data: table(`{"1":[["sword"]]}`)},
+			src("equipment_enhancement/equipment_enhancement"): {Data: table(`{"1":[["sword_plus"]]}`)},
+		},
+		DestPath: filepath.Join(dir, "out"),
+		Names:    []string{"equipment"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = resolver.Resolve()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "out", "equipment.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var compact bytes.Buffer
+	err = json.Compact(&compact, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"1":{"enhancement":{"key":"1","rows":[["sword_plus"]]},"key":"1","rows":[["sword"]]}}`
+	if compact.String() != want {
+		t.Errorf("documents = %s, want %s", compact.String(), want)
+	}
+}
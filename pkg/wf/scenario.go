@@ -0,0 +1,427 @@
+package wf
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/blead/wfax/pkg/encoding"
+	omap "github.com/iancoleman/orderedmap"
+)
+
+const (
+	scenarioDir  = "story/"
+	scenarioName = "scenario"
+)
+
+var scenarioTokenPattern = regexp.MustCompile(`^[-+.$:a-zA-Z_0-9]+$`)
+
+// characterNames lazily resolves character devnames into display names from the character master table.
+type characterNames struct {
+	once  sync.Once
+	names map[string]string
+}
+
+func (c *characterNames) get(config *ExtractorConfig) map[string]string {
+	c.once.Do(func() {
+		c.names = map[string]string{}
+
+		s, err := loadSchemas(config.SchemaPath)
+		if err != nil {
+			log.Printf("[WARN] characterNames: unable to load schemas, speakers will not be resolved, err=%v\n", err)
+			return
+		}
+		column, err := characterNameColumn(s)
+		if err != nil {
+			log.Printf("[WARN] characterNames: speakers will not be resolved, err=%v\n", err)
+			return
+		}
+		jsonParsed, err := readMasterTable(characterTable, config)
+		if err != nil {
+			log.Printf("[WARN] characterNames: unable to read character table, speakers will not be resolved, err=%v\n", err)
+			return
+		}
+
+		for _, char := range jsonParsed.ChildrenMap() {
+			devname, ok := char.Path("0.0").Data().(string)
+			if !ok {
+				continue
+			}
+			name, _ := char.Path(fmt.Sprintf("0.%d", column)).Data().(string)
+			c.names[devname] = name
+		}
+	})
+	return c.names
+}
+
+// scenarioDecoder decodes scenarios for all scenario parsers, sharing resolved character names.
+type scenarioDecoder struct {
+	names *characterNames
+}
+
+func newScenarioDecoder() *scenarioDecoder {
+	return &scenarioDecoder{names: &characterNames{}}
+}
+
+func (decoder *scenarioDecoder) script(raw []byte, config *ExtractorConfig) (*scenarioScript, error) {
+	entries, err := readScenarioEntries(raw)
+	if err != nil {
+		return nil, err
+	}
+	return buildScenarioScript(entries, decoder.names.get(config)), nil
+}
+
+type scenarioField struct {
+	key   string
+	value string
+}
+
+// position returns the key of the field, or its index in the entry if the entry is an array.
+func (f *scenarioField) position(i int) string {
+	if f.key != "" {
+		return f.key
+	}
+	return fmt.Sprintf("#%d", i)
+}
+
+// scenarioLine is a single rendered line of a scenario script.
+type scenarioLine struct {
+	Speaker     string   `json:"speaker,omitempty"`
+	SpeakerName string   `json:"speakerName,omitempty"`
+	Text        string   `json:"text,omitempty"`
+	Directions  []string `json:"directions,omitempty"`
+	Expressions []string `json:"expressions,omitempty"`
+	Voices      []string `json:"voices,omitempty"`
+}
+
+type scenarioScript struct {
+	Lines []*scenarioLine `json:"lines"`
+}
+
+func isScenarioContainer(v any) bool {
+	switch val := v.(type) {
+	case []any:
+		for _, e := range val {
+			if isScenarioNested(e) {
+				return true
+			}
+		}
+	case omap.OrderedMap:
+		for _, k := range val.Keys() {
+			e, _ := val.Get(k)
+			if isScenarioNested(e) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isScenarioNested(v any) bool {
+	switch v.(type) {
+	case []any, omap.OrderedMap:
+		return true
+	}
+	return false
+}
+
+// flattenScenarioFields merges scalar values and nested scalar-only containers into fields.
+func flattenScenarioFields(key string, v any, fields []*scenarioField) []*scenarioField {
+	switch val := v.(type) {
+	case []any:
+		for _, e := range val {
+			fields = flattenScenarioFields(key, e, fields)
+		}
+	case omap.OrderedMap:
+		for _, k := range val.Keys() {
+			e, _ := val.Get(k)
+			fields = flattenScenarioFields(k, e, fields)
+		}
+	case nil:
+	default:
+		fields = append(fields, &scenarioField{key: key, value: fmt.Sprint(val)})
+	}
+	return fields
+}
+
+// walkScenarioEntries collects entries (objects or arrays of scalars) in document order.
+func walkScenarioEntries(v any, entries [][]*scenarioField) [][]*scenarioField {
+	if !isScenarioContainer(v) {
+		if fields := flattenScenarioFields("", v, nil); len(fields) > 0 {
+			entries = append(entries, fields)
+		}
+		return entries
+	}
+
+	var scalars []*scenarioField
+	var children []any
+	switch val := v.(type) {
+	case []any:
+		children = val
+	case omap.OrderedMap:
+		for _, k := range val.Keys() {
+			e, _ := val.Get(k)
+			if isScenarioContainer(e) || (isScenarioNested(e) && isScenarioContainerList(val)) {
+				children = append(children, e)
+			} else {
+				scalars = flattenScenarioFields(k, e, scalars)
+			}
+		}
+	}
+
+	if len(scalars) > 0 {
+		entries = append(entries, scalars)
+	}
+	for _, c := range children {
+		entries = walkScenarioEntries(c, entries)
+	}
+	return entries
+}
+
+// isScenarioContainerList reports whether all values of an object are nested, e.g. orderedmap rows keyed by id.
+func isScenarioContainerList(o omap.OrderedMap) bool {
+	for _, k := range o.Keys() {
+		e, _ := o.Get(k)
+		if !isScenarioNested(e) {
+			return false
+		}
+	}
+	return true
+}
+
+func readScenarioEntries(raw []byte) ([][]*scenarioField, error) {
+	t := encoding.Sniff(raw)
+	data, err := encoding.DecodeContent(raw, t, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	switch t {
+	case encoding.ContentAmf3, encoding.ContentOrderedmap:
+		var v any
+		// wrap data to decode top level arrays into ordered maps
+		o := omap.New()
+		err := json.Unmarshal([]byte(`{"":`+string(bytes.TrimSpace(data))+`}`), o)
+		if err != nil {
+			return nil, err
+		}
+		v, _ = o.Get("")
+		return walkScenarioEntries(v, nil), nil
+	case encoding.ContentCSV, encoding.ContentText:
+		r := csv.NewReader(bytes.NewReader(data))
+		r.FieldsPerRecord = -1
+		r.LazyQuotes = true
+		rec, err := r.ReadAll()
+		if err != nil {
+			// not csv, read each line as a single field
+			rec = nil
+			for _, line := range strings.Split(string(data), "\n") {
+				rec = append(rec, []string{strings.TrimRight(line, "\r")})
+			}
+		}
+
+		var entries [][]*scenarioField
+		for _, row := range rec {
+			var fields []*scenarioField
+			for _, cell := range row {
+				fields = append(fields, &scenarioField{value: cell})
+			}
+			entries = append(entries, fields)
+		}
+		return entries, nil
+	}
+
+	return nil, fmt.Errorf("readScenarioEntries: unsupported content type, type=%s", t)
+}
+
+func isVoicePath(p string) bool {
+	return strings.HasPrefix(p, "voice/") || strings.Contains(p, "/voice/")
+}
+
+// isScenarioPath reports whether the whole value is an asset path, since text may contain slashes.
+func isScenarioPath(v string) bool {
+	paths, _ := findAllPaths([]byte(v))
+	return len(paths) == 1 && string(paths[0]) == v
+}
+
+// scenarioTextPositions returns field positions holding text in any entry of the script.
+// Scenario keys are obfuscated but consistent within a script, so a position holding prose holds text in every entry,
+// including lines which look like tokens, e.g. "Yes." or "OK".
+func scenarioTextPositions(entries [][]*scenarioField, names map[string]string) map[string]bool {
+	positions := map[string]bool{}
+	for _, fields := range entries {
+		for i, f := range fields {
+			v := strings.TrimSpace(f.value)
+			if _, ok := names[v]; ok || v == "" || isScenarioPath(v) || scenarioTokenPattern.MatchString(v) {
+				continue
+			}
+			positions[f.position(i)] = true
+		}
+	}
+	return positions
+}
+
+func buildScenarioScript(entries [][]*scenarioField, names map[string]string) *scenarioScript {
+	texts := scenarioTextPositions(entries, names)
+	script := &scenarioScript{Lines: []*scenarioLine{}}
+	for _, fields := range entries {
+		if line := buildScenarioLine(fields, names, texts); line != nil {
+			script.Lines = append(script.Lines, line)
+		}
+	}
+	return script
+}
+
+// buildScenarioLine classifies fields of a scenario entry by their values and positions.
+// Character devnames are speakers, asset paths are voices or expressions, values at text positions are text
+// and the rest are stage directions.
+func buildScenarioLine(fields []*scenarioField, names map[string]string, textPositions map[string]bool) *scenarioLine {
+	line := &scenarioLine{}
+	var texts []string
+
+	for i, f := range fields {
+		v := strings.TrimSpace(f.value)
+		if v == "" {
+			continue
+		}
+
+		if _, ok := names[v]; ok && line.Speaker == "" {
+			line.Speaker = v
+			continue
+		}
+
+		if isScenarioPath(v) {
+			if isVoicePath(v) {
+				line.Voices = append(line.Voices, v)
+			} else {
+				line.Expressions = append(line.Expressions, v)
+			}
+			continue
+		}
+
+		if textPositions[f.position(i)] {
+			texts = append(texts, v)
+			continue
+		}
+
+		if f.key != "" {
+			v = f.key + "=" + v
+		}
+		line.Directions = append(line.Directions, v)
+	}
+
+	line.Text = strings.Join(texts, "\n")
+	if line.Speaker != "" {
+		line.SpeakerName = names[line.Speaker]
+	}
+
+	if line.Speaker == "" && line.Text == "" && len(line.Directions) == 0 && len(line.Expressions) == 0 && len(line.Voices) == 0 {
+		return nil
+	}
+	return line
+}
+
+func renderScenarioMarkdown(script *scenarioScript) []byte {
+	var output bytes.Buffer
+	for i, line := range script.Lines {
+		if i > 0 {
+			output.WriteString("\n")
+		}
+
+		if len(line.Directions) > 0 {
+			fmt.Fprintf(&output, "*%s*\n", strings.Join(line.Directions, " "))
+		}
+
+		if line.Text != "" {
+			text := strings.ReplaceAll(line.Text, "\n", "  \n")
+			switch {
+			case line.SpeakerName != "":
+				fmt.Fprintf(&output, "**%s** (`%s`): %s\n", line.SpeakerName, line.Speaker, text)
+			case line.Speaker != "":
+				fmt.Fprintf(&output, "**%s**: %s\n", line.Speaker, text)
+			default:
+				fmt.Fprintf(&output, "%s\n", text)
+			}
+		} else if line.Speaker != "" {
+			fmt.Fprintf(&output, "**%s**\n", line.Speaker)
+		}
+
+		for _, e := range line.Expressions {
+			fmt.Fprintf(&output, "- expression: `%s`\n", e)
+		}
+		for _, v := range line.Voices {
+			fmt.Fprintf(&output, "- voice: `%s`\n", v)
+		}
+	}
+
+	return output.Bytes()
+}
+
+// scenarioParser renders story scenarios into readable scripts, either as Markdown (.md) or structured JSON (.json).
+type scenarioParser struct {
+	ext     string
+	decoder *scenarioDecoder
+}
+
+func (*scenarioParser) getSrc(p string, config *ExtractorConfig) (string, error) {
+	// only story/**/scenario paths are scenarios
+	if !strings.HasPrefix(p, scenarioDir) || path.Base(p) != scenarioName {
+		return "", nil
+	}
+
+	src, err := sha1Digest(filepath.ToSlash(p), digestSalt)
+	if err != nil {
+		return "", err
+	}
+	return dumpPath(src), nil
+}
+
+// dependencies returns the character table source, which resolves speaker names.
+func (*scenarioParser) dependencies(p string, config *ExtractorConfig) ([]string, error) {
+	src, err := (&orderedmapParser{}).getSrc(characterTable, config)
+	if err != nil {
+		return nil, err
+	}
+	return []string{src}, nil
+}
+
+func (parser *scenarioParser) getDest(path string, config *ExtractorConfig) (string, error) {
+	return addExt(filepath.Join(config.DestPath, outputAssetsDir, filepath.FromSlash(path)), parser.ext), nil
+}
+
+func (parser *scenarioParser) parse(path string, raw []byte, config *ExtractorConfig) ([]byte, error) {
+	script, err := parser.decoder.script(raw, config)
+	if err != nil {
+		return nil, err
+	}
+
+	if parser.ext == ".md" {
+		return renderScenarioMarkdown(script), nil
+	}
+
+	var output bytes.Buffer
+	enc := json.NewEncoder(&output)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", strings.Repeat(" ", config.Indent))
+	err = enc.Encode(script)
+	return output.Bytes(), err
+}
+
+func (*scenarioParser) output(raw []byte, config *ExtractorConfig) ([][]byte, error) {
+	return findAllPaths(raw)
+}
+
+func (parser *scenarioParser) matchDest(dest string, config *PackerConfig) (string, bool) {
+	return matchPath(dest, outputAssetsDir, parser.ext)
+}
+
+func (*scenarioParser) unparse(path string, raw []byte, config *PackerConfig) ([]byte, error) {
+	return nil, fmt.Errorf("unparse scenarioParser: not implemented")
+}
@@ -0,0 +1,50 @@
+package wf
+
+import (
+	"encoding/json"
+	"testing"
+	"testing/fstest"
+
+	"github.com/blead/wfax/pkg/encoding"
+)
+
+func TestScenarioParser(t *testing.T) {
+	h, err := sha1Digest(toMasterTablePath(characterTable), digestSalt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	table, err := encoding.JSONToOrderedmap([]byte(`{"1":[["alk","Alk"]]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ExtractorConfig{SrcFS: fstest.MapFS{dumpPath(h): {Data: table}}}
+
+	raw, err := encoding.JSONToAmf3([]byte(`[{"a":"alk","b":"Hello there.","c":"character/alk/voice/001","d":"fade_in"},{"a":"Yes/no?"},{"a":"alk","b":"OK.","d":"fade_out"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoder := newScenarioDecoder()
+	md, err := (&scenarioParser{ext: ".md", decoder: decoder}).parse("story/main/1/scenario", raw, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// one-word lines are text by their position
+	want := "*d=fade_in*\n**Alk** (`alk`): Hello there.\n- voice: `character/alk/voice/001`\n\nYes/no?\n\n*d=fade_out*\n**Alk** (`alk`): OK.\n"
+	if string(md) != want {
+		t.Errorf("markdown = %q, want %q", md, want)
+	}
+
+	data, err := (&scenarioParser{ext: ".json", decoder: decoder}).parse("story/main/1/scenario", raw, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var script scenarioScript
+	err = json.Unmarshal(data, &script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(script.Lines) != 3 || script.Lines[0].SpeakerName != "Alk" || script.Lines[1].Text != "Yes/no?" || script.Lines[2].Text != "OK." {
+		t.Errorf("script = %s", data)
+	}
+}
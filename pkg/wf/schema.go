@@ -0,0 +1,72 @@
+package wf
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/blead/wfax/assets"
+	"github.com/blead/wfax/pkg/encoding"
+)
+
+// schemas maps master table paths to their column schemas.
+type schemas map[string]*encoding.TableSchema
+
+func parseSchemas(data []byte) (schemas, error) {
+	var s schemas
+	err := json.Unmarshal(data, &s)
+	if err != nil {
+		return nil, err
+	}
+
+	for path, schema := range s {
+		err := schema.Validate()
+		if err != nil {
+			return nil, fmt.Errorf("parseSchemas: invalid schema, path=%s, %w", path, err)
+		}
+	}
+	return s, nil
+}
+
+// loadSchemas reads the default schemas and overrides them per table with schemas from path if supplied.
+func loadSchemas(path string) (schemas, error) {
+	s, err := parseSchemas(assets.Schemas)
+	if err != nil {
+		return nil, fmt.Errorf("loadSchemas: default schemas error, %w", err)
+	}
+
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("loadSchemas: read error, path=%s, %w", path, err)
+	}
+	custom, err := parseSchemas(data)
+	if err != nil {
+		return nil, fmt.Errorf("loadSchemas: parse error, path=%s, %w", path, err)
+	}
+
+	for table, schema := range custom {
+		s[table] = schema
+	}
+	return s, nil
+}
+
+// characterNameColumnName names the column of display names in the character table schema.
+const characterNameColumnName = "name"
+
+// characterNameColumn returns the index of display names in character table rows.
+func characterNameColumn(s schemas) (int, error) {
+	schema, ok := s[characterTable]
+	if !ok {
+		return 0, fmt.Errorf("characterNameColumn: no schema, table=%s", characterTable)
+	}
+	for _, c := range schema.Columns {
+		if c.Name == characterNameColumnName {
+			return c.Index, nil
+		}
+	}
+	return 0, fmt.Errorf("characterNameColumn: no column, table=%s, name=%s", characterTable, characterNameColumnName)
+}
@@ -0,0 +1,427 @@
+package wf
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Archive formats of output sinks and packer sources, detected from file extensions.
+const (
+	archiveZip   = "zip"
+	archiveTarGz = "tar.gz"
+)
+
+// archiveModTime is the timestamp of all archive entries so that archives are reproducible.
+var archiveModTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// archiveFormat returns the archive format of p, or an empty string if p is not an archive.
+func archiveFormat(p string) string {
+	lower := strings.ToLower(p)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return archiveZip
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return archiveTarGz
+	}
+	return ""
+}
+
+// sink receives output files by slash-separated paths relative to the destination.
+type sink interface {
+	write(name string, data []byte) error
+	close() error
+	// discard releases the sink after a failed extraction without completing its output.
+	discard()
+}
+
+// newSink returns an archive sink if dest is an archive, or a directory sink otherwise.
+func newSink(dest string) (sink, error) {
+	if format := archiveFormat(dest); format != "" {
+		err := os.MkdirAll(filepath.Dir(dest), 0777)
+		if err != nil {
+			return nil, err
+		}
+		return newArchiveSink(dest, format)
+	}
+
+	err := os.MkdirAll(dest, 0777)
+	if err != nil {
+		return nil, err
+	}
+	return &dirSink{root: dest}, nil
+}
+
+// dirSink writes files into a directory.
+type dirSink struct {
+	root string
+}
+
+func (s *dirSink) write(name string, data []byte) (err error) {
+	dest := filepath.Join(s.root, filepath.FromSlash(name))
+	os.MkdirAll(filepath.Dir(dest), 0777)
+	destFile, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return fmt.Errorf("write dirSink: dest open error, dest=%s, %w", dest, err)
+	}
+	defer func() {
+		closeErr := destFile.Close()
+		if closeErr != nil && err == nil {
+			err = fmt.Errorf("write dirSink: dest close error, dest=%s, %w", dest, closeErr)
+		}
+	}()
+
+	_, err = io.Copy(destFile, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("write dirSink: dest write error, dest=%s, %w", dest, err)
+	}
+	return nil
+}
+
+func (*dirSink) close() error {
+	return nil
+}
+
+// discard keeps files already written, which are complete on their own.
+func (*dirSink) discard() {}
+
+// archiveEntry locates a written file in the spool of an archive sink.
+type archiveEntry struct {
+	name   string
+	offset int64
+	// size is the length in the spool, which is compressed for zip archives
+	size int64
+	// rawSize and crc describe uncompressed data
+	rawSize int64
+	crc     uint32
+}
+
+// archiveSink writes files into a zip or tar.gz archive sorted by name, with fixed timestamps.
+// Written files are spooled into a temporary file next to the archive instead of being held in memory,
+// and copied into the archive in order when the sink is closed.
+type archiveSink struct {
+	path  string
+	spool *os.File
+	mu    sync.Mutex
+	// format is archiveZip or archiveTarGz
+	format  string
+	entries map[string]*archiveEntry
+	offset  int64
+}
+
+func newArchiveSink(dest string, format string) (*archiveSink, error) {
+	if format != archiveZip && format != archiveTarGz {
+		return nil, fmt.Errorf("newArchiveSink: unknown archive format, format=%s", format)
+	}
+
+	spool, err := os.CreateTemp(filepath.Dir(dest), "."+filepath.Base(dest)+".*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("newArchiveSink: spool open error, path=%s, %w", dest, err)
+	}
+	return &archiveSink{path: dest, spool: spool, format: format, entries: map[string]*archiveEntry{}}, nil
+}
+
+// compress deflates data outside of the lock so that concurrent writers only wait for the spool.
+func compress(data []byte) ([]byte, error) {
+	var compressed bytes.Buffer
+	fw, err := flate.NewWriter(&compressed, flate.DefaultCompression)
+	if err != nil {
+		return nil, err
+	}
+	_, err = fw.Write(data)
+	if err != nil {
+		return nil, err
+	}
+	err = fw.Close()
+	if err != nil {
+		return nil, err
+	}
+	return compressed.Bytes(), nil
+}
+
+func (s *archiveSink) write(name string, data []byte) error {
+	entry := &archiveEntry{name: name, rawSize: int64(len(data)), crc: crc32.ChecksumIEEE(data)}
+	spooled := data
+	if s.format == archiveZip {
+		var err error
+		spooled, err = compress(data)
+		if err != nil {
+			return fmt.Errorf("write archiveSink: compress error, name=%s, %w", name, err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.entries[name] != nil {
+		return fmt.Errorf("write archiveSink: duplicate entry, path=%s, name=%s", s.path, name)
+	}
+
+	_, err := s.spool.Write(spooled)
+	if err != nil {
+		return fmt.Errorf("write archiveSink: spool write error, path=%s, name=%s, %w", s.path, name, err)
+	}
+	entry.offset, entry.size = s.offset, int64(len(spooled))
+	s.offset += entry.size
+	s.entries[name] = entry
+	return nil
+}
+
+func (s *archiveSink) writeZip(zw *zip.Writer, entry *archiveEntry) error {
+	header := &zip.FileHeader{
+		Name:               entry.name,
+		Method:             zip.Deflate,
+		Modified:           archiveModTime,
+		CRC32:              entry.crc,
+		CompressedSize64:   uint64(entry.size),
+		UncompressedSize64: uint64(entry.rawSize),
+		// CreateRaw does not convert Modified into MS-DOS date and time, 1980-01-01 00:00:00
+		ModifiedDate: 1<<5 | 1,
+		ModifiedTime: 0,
+	}
+	header.SetMode(0644)
+
+	fw, err := zw.CreateRaw(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(fw, io.NewSectionReader(s.spool, entry.offset, entry.size))
+	return err
+}
+
+func (s *archiveSink) writeTar(tw *tar.Writer, entry *archiveEntry) error {
+	err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     entry.name,
+		Mode:     0644,
+		Size:     entry.rawSize,
+		ModTime:  archiveModTime,
+		Format:   tar.FormatPAX,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, io.NewSectionReader(s.spool, entry.offset, entry.size))
+	return err
+}
+
+// writeArchive copies spooled entries sorted by name into w.
+func (s *archiveSink) writeArchive(w io.Writer) error {
+	var entries []*archiveEntry
+	for _, entry := range s.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+
+	if s.format == archiveZip {
+		zw := zip.NewWriter(w)
+		for _, entry := range entries {
+			err := s.writeZip(zw, entry)
+			if err != nil {
+				return fmt.Errorf("name=%s, %w", entry.name, err)
+			}
+		}
+		return zw.Close()
+	}
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	for _, entry := range entries {
+		err := s.writeTar(tw, entry)
+		if err != nil {
+			return fmt.Errorf("name=%s, %w", entry.name, err)
+		}
+	}
+	err := tw.Close()
+	if err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+func (s *archiveSink) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.removeSpool()
+
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return fmt.Errorf("close archiveSink: open error, path=%s, %w", s.path, err)
+	}
+	err = s.writeArchive(f)
+	if err != nil {
+		f.Close()
+		os.Remove(s.path)
+		return fmt.Errorf("close archiveSink: write error, path=%s, %w", s.path, err)
+	}
+	return f.Close()
+}
+
+func (s *archiveSink) removeSpool() {
+	if s.spool == nil {
+		return
+	}
+	s.spool.Close()
+	os.Remove(s.spool.Name())
+	s.spool = nil
+}
+
+// discard removes the spool without writing the archive, it does nothing once the sink is closed.
+func (s *archiveSink) discard() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removeSpool()
+}
+
+// memFS is a read-only in-memory filesystem of archive entries.
+type memFS struct {
+	files map[string][]byte
+	// dirs maps directories to names of their children
+	dirs map[string]map[string]bool
+}
+
+func (m *memFS) add(name string, data []byte) {
+	m.files[name] = data
+	for name != "." {
+		dir := path.Dir(name)
+		if m.dirs[dir] == nil {
+			m.dirs[dir] = map[string]bool{}
+		}
+		m.dirs[dir][path.Base(name)] = true
+		name = dir
+	}
+}
+
+type memFileInfo struct {
+	name string
+	size int64
+	dir  bool
+}
+
+func (info *memFileInfo) Name() string       { return info.name }
+func (info *memFileInfo) Size() int64        { return info.size }
+func (info *memFileInfo) ModTime() time.Time { return archiveModTime }
+func (info *memFileInfo) IsDir() bool        { return info.dir }
+func (info *memFileInfo) Sys() any           { return nil }
+func (info *memFileInfo) Mode() fs.FileMode {
+	if info.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+type memFile struct {
+	*bytes.Reader
+	info *memFileInfo
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *memFile) Close() error               { return nil }
+
+func (m *memFS) Stat(name string) (fs.FileInfo, error) {
+	if data, ok := m.files[name]; ok {
+		return &memFileInfo{name: path.Base(name), size: int64(len(data))}, nil
+	}
+	if _, ok := m.dirs[name]; ok || name == "." {
+		return &memFileInfo{name: path.Base(name), dir: true}, nil
+	}
+	return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+}
+
+func (m *memFS) Open(name string) (fs.File, error) {
+	info, err := m.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	return &memFile{Reader: bytes.NewReader(m.files[name]), info: info.(*memFileInfo)}, nil
+}
+
+func (m *memFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	children, ok := m.dirs[name]
+	if !ok {
+		if name == "." {
+			return nil, nil
+		}
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	var entries []fs.DirEntry
+	for c := range children {
+		info, err := m.Stat(path.Join(name, c))
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// readTarGzFS reads all files of a tar.gz archive into memory.
+func readTarGzFS(name string) (fs.FS, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("readTarGzFS: gzip error, path=%s, %w", name, err)
+	}
+	defer gr.Close()
+
+	m := &memFS{files: map[string][]byte{}, dirs: map[string]map[string]bool{}}
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("readTarGzFS: tar error, path=%s, %w", name, err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		p := path.Clean(strings.TrimPrefix(header.Name, "./"))
+		if !fs.ValidPath(p) {
+			return nil, fmt.Errorf("readTarGzFS: illegal file path, path=%s, name=%s", name, header.Name)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("readTarGzFS: read error, path=%s, name=%s, %w", name, header.Name, err)
+		}
+		m.add(p, data)
+	}
+	return m, nil
+}
+
+// openArchiveFS opens a zip or tar.gz archive written by an archive sink, tar.gz archives are read into memory.
+func openArchiveFS(name string) (fs.FS, error) {
+	switch archiveFormat(name) {
+	case archiveZip:
+		archive, err := zip.OpenReader(name)
+		if err != nil {
+			return nil, err
+		}
+		return &archive.Reader, nil
+	case archiveTarGz:
+		return readTarGzFS(name)
+	}
+	return nil, fmt.Errorf("openArchiveFS: unknown archive format, path=%s", name)
+}
@@ -0,0 +1,106 @@
+package wf
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestArchiveSink(t *testing.T) {
+	files := map[string]string{
+		"orderedmap/character/character.json": `{"1":[["alk"]]}`,
+		"assets/item/sprite_sheet/a.png":      "png",
+		".pathlist":                           "character\n",
+	}
+	order := []string{".pathlist", "assets/item/sprite_sheet/a.png", "orderedmap/character/character.json"}
+
+	for _, ext := range []string{".zip", ".tar.gz"} {
+		var archives [][]byte
+		// archives of the same files are identical regardless of the order they are written
+		for run, names := range [][]string{order, {order[2], order[0], order[1]}} {
+			dir := t.TempDir()
+			dest := filepath.Join(dir, "out"+ext)
+			s, err := newSink(dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range names {
+				err = s.write(name, []byte(files[name]))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			err = s.write(names[0], []byte(files[names[0]]))
+			if err == nil {
+				t.Errorf("%s run %d: duplicate write error = nil", ext, run)
+			}
+			err = s.close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := os.ReadFile(dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			archives = append(archives, data)
+			// the spool is removed on close
+			if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+				t.Errorf("%s run %d: files next to archive = %v", ext, run, entries)
+			}
+
+			fsys, err := openArchiveFS(dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, content := range files {
+				got, err := fs.ReadFile(fsys, name)
+				if err != nil {
+					t.Fatalf("%s run %d: %v", ext, run, err)
+				}
+				if string(got) != content {
+					t.Errorf("%s run %d: %s = %q, want %q", ext, run, name, got, content)
+				}
+			}
+			var paths []string
+			err = fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+				if err != nil || d.IsDir() {
+					return err
+				}
+				paths = append(paths, p)
+				info, err := d.Info()
+				if err == nil && !info.ModTime().Equal(archiveModTime) {
+					t.Errorf("%s run %d: %s modified = %v, want %v", ext, run, p, info.ModTime(), archiveModTime)
+				}
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(paths) != len(files) {
+				t.Errorf("%s run %d: paths = %v", ext, run, paths)
+			}
+		}
+
+		if !bytes.Equal(archives[0], archives[1]) {
+			t.Errorf("%s: archives of the same files written in different orders differ", ext)
+		}
+
+		// discarded sinks leave nothing behind
+		dir := t.TempDir()
+		s, err := newSink(filepath.Join(dir, "out"+ext))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = s.write(order[0], []byte(files[order[0]]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.discard()
+		if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+			t.Errorf("%s: files after discard = %v", ext, entries)
+		}
+	}
+}
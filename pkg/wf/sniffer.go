@@ -0,0 +1,244 @@
+package wf
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/blead/wfax/pkg/concurrency"
+	"github.com/blead/wfax/pkg/encoding"
+)
+
+const outputUnknownDir = "unknown"
+
+// SnifferConfig is the configuration for the sniffer.
+type SnifferConfig struct {
+	SrcPath        string
+	DestPath       string
+	PathList       string
+	NoDefaultPaths bool
+	Unresolved     bool
+	Concurrency    int
+	Indent         int
+}
+
+// DefaultSnifferConfig generates a default configuration.
+func DefaultSnifferConfig() *SnifferConfig {
+	return &SnifferConfig{
+		SrcPath:        "",
+		DestPath:       "",
+		PathList:       "",
+		NoDefaultPaths: false,
+		Unresolved:     false,
+		Concurrency:    5,
+		Indent:         0,
+	}
+}
+
+// SniffResult is the identified content type of a dump file.
+type SniffResult struct {
+	Path string
+	Hash string
+	Type encoding.ContentType
+	Size int64
+}
+
+// Sniffer identifies content types of dump files.
+type Sniffer struct {
+	config *SnifferConfig
+	// resolved holds hashes reachable with known paths, nil if not needed
+	resolved map[string]bool
+}
+
+// NewSniffer creates a new sniffer with the supplied configuration.
+// If the configuration is nil, use DefaultSnifferConfig.
+func NewSniffer(config *SnifferConfig) (*Sniffer, error) {
+	def := DefaultSnifferConfig()
+	if def == nil {
+		return nil, fmt.Errorf("NewSniffer: default configuration is nil")
+	}
+
+	if config == nil {
+		config = def
+	}
+
+	if config.SrcPath == "" || config.SrcPath == "." {
+		wd, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		config.SrcPath = wd
+	}
+	config.SrcPath = filepath.Clean(config.SrcPath)
+	if config.DestPath != "" {
+		config.DestPath = filepath.Clean(config.DestPath)
+	}
+	if config.PathList != "" {
+		config.PathList = filepath.Clean(config.PathList)
+	}
+
+	if config.Concurrency == 0 {
+		config.Concurrency = 5
+	}
+
+	return &Sniffer{config: config}, nil
+}
+
+// resolvedHashes returns hashes of all dump files reachable with known paths and parsers.
+func (sniffer *Sniffer) resolvedHashes() (map[string]bool, error) {
+	extractor, err := NewExtractor(&ExtractorConfig{
+		SrcPath:        sniffer.config.SrcPath,
+		DestPath:       sniffer.config.SrcPath,
+		PathList:       sniffer.config.PathList,
+		NoDefaultPaths: sniffer.config.NoDefaultPaths,
+	})
+	if err != nil {
+		return nil, err
+	}
+	// do not fall back to [src]/.pathlist
+	if sniffer.config.PathList == "" {
+		extractor.config.PathList = ""
+	}
+
+	paths, err := extractor.getInitialPaths()
+	if err != nil {
+		return nil, err
+	}
+
+	parsers := append([]parser{&pngParser{}}, extractor.parsers...)
+	for _, ext := range []string{".atlas", ".frame", ".parts", ".timeline"} {
+		parsers = append(parsers, &amf3Parser{ext: ext})
+	}
+
+	resolved := map[string]bool{}
+	for _, p := range paths {
+		for _, parser := range parsers {
+			src, err := parser.getSrc(string(p), extractor.config)
+			if err != nil {
+				return nil, err
+			}
+			if src != "" {
+				resolved[dumpHash(src)] = true
+			}
+		}
+	}
+	return resolved, nil
+}
+
+// dumpHash returns the hashed asset path of a file in the dump directory, i.e. upload/ab/cdef -> abcdef.
+func dumpHash(src string) string {
+	return filepath.Base(filepath.Dir(src)) + filepath.Base(src)
+}
+
+func (sniffer *Sniffer) listFiles() ([]string, error) {
+	info, err := os.Stat(sniffer.config.SrcPath)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{sniffer.config.SrcPath}, nil
+	}
+
+	var files []string
+	err = filepath.WalkDir(sniffer.config.SrcPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
+
+func (sniffer *Sniffer) sniffFile(i *concurrency.Item[string, *SniffResult]) (*SniffResult, error) {
+	f, err := os.Open(i.Data)
+	if err != nil {
+		return nil, fmt.Errorf("sniffFile: open error, path=%s, %w", i.Data, err)
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("sniffFile: read error, path=%s, %w", i.Data, err)
+	}
+
+	t := encoding.Sniff(data)
+	result := &SniffResult{
+		Path: i.Data,
+		Hash: dumpHash(i.Data),
+		Type: t,
+		Size: int64(len(data)),
+	}
+
+	// only files which cannot be identified by a known path are exported
+	if sniffer.config.DestPath == "" || sniffer.resolved[result.Hash] {
+		return result, nil
+	}
+
+	data, err = encoding.DecodeContent(data, t, sniffer.config.Indent)
+	if err != nil {
+		log.Printf("[WARN] sniffFile: decode error, exporting raw data instead, path=%s, type=%s, err=%v\n", i.Data, t, err)
+		data, err = os.ReadFile(i.Data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	dest := filepath.Join(sniffer.config.DestPath, outputUnknownDir, result.Hash+t.Ext())
+	os.MkdirAll(filepath.Dir(dest), 0777)
+	err = os.WriteFile(dest, data, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("sniffFile: dest write error, path=%s, dest=%s, %w", i.Data, dest, err)
+	}
+
+	return result, nil
+}
+
+// SniffFiles identifies content types of dump files and exports decoded content of files unreachable by extraction
+// with the known path list if DestPath is set. If Unresolved is set, reachable files are also skipped from the results.
+func (sniffer *Sniffer) SniffFiles() ([]*SniffResult, error) {
+	files, err := sniffer.listFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	if sniffer.config.Unresolved || sniffer.config.DestPath != "" {
+		if sniffer.config.NoDefaultPaths && sniffer.config.PathList == "" {
+			return nil, fmt.Errorf("SniffFiles: no path list to resolve hashes")
+		}
+		sniffer.resolved, err = sniffer.resolvedHashes()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var items []*concurrency.Item[string, *SniffResult]
+	for _, f := range files {
+		// skip files reachable by extraction
+		if !sniffer.config.Unresolved || !sniffer.resolved[dumpHash(f)] {
+			items = append(items, &concurrency.Item[string, *SniffResult]{Data: f})
+		}
+	}
+
+	err = concurrency.Execute(sniffer.sniffFile, items, sniffer.config.Concurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []*SniffResult
+	for _, i := range items {
+		results = append(results, i.Output)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return strings.Compare(results[i].Path, results[j].Path) < 0
+	})
+
+	return results, nil
+}
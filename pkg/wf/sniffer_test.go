@@ -0,0 +1,58 @@
+package wf
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSniffExportUnresolved(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "dump")
+	dump := testDump(t, map[string]string{"a/a": `{"1":[["x"]]}`})
+	dump[dumpPath("ffffffffff")] = nil
+	for p := range dump {
+		data := []byte("unknown")
+		if dump[p] != nil {
+			data = dump[p].Data
+		}
+		dest := filepath.Join(src, filepath.FromSlash(p))
+		os.MkdirAll(filepath.Dir(dest), 0777)
+		if err := os.WriteFile(dest, data, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pathList := filepath.Join(dir, "pathlist")
+	if err := os.WriteFile(pathList, []byte("a/a\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	sniffer, err := NewSniffer(&SnifferConfig{
+		SrcPath:        src,
+		DestPath:       filepath.Join(dir, "output"),
+		PathList:       pathList,
+		NoDefaultPaths: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := sniffer.SniffFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2", len(results))
+	}
+
+	exported, err := os.ReadDir(filepath.Join(dir, "output", outputUnknownDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exported) != 1 || exported[0].Name() != "ffffffffff.txt" {
+		var names []string
+		for _, e := range exported {
+			names = append(names, e.Name())
+		}
+		t.Errorf("exported %v, want only ffffffffff.txt", names)
+	}
+}
@@ -7,16 +7,14 @@ import (
 	"image"
 	"image/color"
 	"image/png"
-	"io"
+	"io/fs"
 	"log"
-	"os"
 	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
 
 	"github.com/Jeffail/gabs/v2"
-	"github.com/blead/wfax/assets"
 	"github.com/blead/wfax/pkg/concurrency"
 	"github.com/disintegration/imaging"
 	"github.com/hashicorp/go-multierror"
@@ -25,31 +23,49 @@ import (
 const ENHANCED_99_RARITY = 6
 
 // SpriterConfig is the configuration for the spriter.
+// Sources are read like ExtractorConfig sources, without SrcPaths.
+// Profile is an export profile file or the name of a built-in profile whose sprites compose sprites onto rarity backgrounds,
+// Eliyabot is the same as the built-in eliyabot profile.
+// If DestPath ends with .zip, .tar.gz or .tgz, sprites are written into a single archive.
+// If ManifestPath is set, a manifest of written sprites with their hashes is written to it.
 type SpriterConfig struct {
-	SrcPath     string
-	DestPath    string
-	SpritePath  string
-	Scale       float32
-	Concurrency int
-	Eliyabot    bool
+	SrcPath      string
+	SrcFS        fs.FS
+	Archives     []string
+	DestPath     string
+	SpritePath   string
+	ManifestPath string
+	Scale        float32
+	Concurrency  int
+	Profile      string
+	Eliyabot     bool
 }
 
 // DefaultSpriterConfig generates a default configuration.
 func DefaultSpriterConfig() *SpriterConfig {
 	return &SpriterConfig{
-		SrcPath:     "",
-		DestPath:    "",
-		SpritePath:  "item/sprite_sheet",
-		Scale:       4,
-		Concurrency: 5,
-		Eliyabot:    false,
+		SrcPath:      "",
+		SrcFS:        nil,
+		Archives:     nil,
+		DestPath:     "",
+		SpritePath:   "item/sprite_sheet",
+		ManifestPath: "",
+		Scale:        4,
+		Concurrency:  5,
+		Profile:      "",
+		Eliyabot:     false,
 	}
 }
 
 // Spriter extracts and crops WF sprites.
 type Spriter struct {
-	config      *SpriterConfig
+	config *SpriterConfig
+	// sprites is nil if sprites are not composed onto backgrounds
+	sprites     *profileSprites
 	backgrounds map[int]image.Image
+	sink        sink
+	// manifest is nil if no manifest is written
+	manifest *outputManifest
 }
 
 // NewSpriter creates a new spriter with the supplied configuration.
@@ -64,25 +80,21 @@ func NewSpriter(config *SpriterConfig) (*Spriter, error) {
 		config = def
 	}
 
-	if config.SrcPath == "" || config.SrcPath == "." {
-		wd, err := os.Getwd()
-		if err != nil {
-			return nil, err
-		}
-		config.SrcPath = wd
+	var err error
+	config.SrcPath, config.SrcFS, err = sourceConfig(config.SrcPath, nil, config.SrcFS, config.Archives)
+	if err != nil {
+		return nil, err
 	}
-	config.SrcPath = filepath.Clean(config.SrcPath)
-	if config.DestPath == "" || config.DestPath == "." {
-		wd, err := os.Getwd()
-		if err != nil {
-			return nil, err
-		}
-		config.DestPath = wd
+	config.DestPath, err = workingPath(config.DestPath)
+	if err != nil {
+		return nil, err
 	}
-	config.DestPath = filepath.Clean(config.DestPath)
 	if config.SpritePath == "" {
 		config.SpritePath = "item/sprite_sheet"
 	}
+	if config.ManifestPath != "" {
+		config.ManifestPath = filepath.Clean(config.ManifestPath)
+	}
 
 	if config.Scale == 0 {
 		config.Scale = 4
@@ -92,41 +104,43 @@ func NewSpriter(config *SpriterConfig) (*Spriter, error) {
 		config.Concurrency = 5
 	}
 
-	backgrounds := make(map[int]image.Image)
+	profileName, err := profilePath(config.Profile, config.Eliyabot)
+	if err != nil {
+		return nil, err
+	}
+	if profileName == "" {
+		return &Spriter{config: config}, nil
+	}
+	profile, err := loadProfile(profileName)
+	if err != nil {
+		return nil, err
+	}
+	if profile.Sprites == nil {
+		return nil, fmt.Errorf("NewSpriter: profile has no sprites, profile=%s", profileName)
+	}
 
-	if config.Eliyabot {
-		var err error
-		backgrounds[1], err = imaging.Decode(bytes.NewReader(assets.ItemWhite))
+	names := map[int]string{}
+	for r, name := range profile.Sprites.Backgrounds {
+		rarity, err := strconv.Atoi(r)
 		if err != nil {
 			return nil, err
 		}
-		backgrounds[2], err = imaging.Decode(bytes.NewReader(assets.ItemBronze))
-		if err != nil {
-			return nil, err
-		}
-		backgrounds[3], err = imaging.Decode(bytes.NewReader(assets.ItemSilver))
-		if err != nil {
-			return nil, err
-		}
-		backgrounds[4], err = imaging.Decode(bytes.NewReader(assets.ItemGold))
-		if err != nil {
-			return nil, err
-		}
-		backgrounds[5], err = imaging.Decode(bytes.NewReader(assets.ItemRainbow))
-		if err != nil {
-			return nil, err
-		}
-		backgrounds[ENHANCED_99_RARITY], err = imaging.Decode(bytes.NewReader(assets.ItemRainbowEnhanced))
+		names[rarity] = name
+	}
+	if profile.Sprites.Enhanced != "" {
+		names[ENHANCED_99_RARITY] = profile.Sprites.Enhanced
+	}
+	size := int(float32(profile.Sprites.Size) * config.Scale)
+	backgrounds := make(map[int]image.Image)
+	for rarity, name := range names {
+		img, err := loadBackground(name)
 		if err != nil {
 			return nil, err
 		}
-		for i, img := range backgrounds {
-			size := int(24 * config.Scale)
-			backgrounds[i] = imaging.Resize(img, size, size, imaging.NearestNeighbor)
-		}
+		backgrounds[rarity] = imaging.Resize(img, size, size, imaging.NearestNeighbor)
 	}
 
-	return &Spriter{config: config, backgrounds: backgrounds}, nil
+	return &Spriter{config: config, sprites: profile.Sprites, backgrounds: backgrounds}, nil
 }
 
 type spriteParams struct {
@@ -139,55 +153,75 @@ type spriteParams struct {
 	rotate  bool
 }
 
-func parseAtlas(atlas []byte) ([]*spriteParams, error) {
+func parseSpriteParams(idx int, sprite *gabs.Container) (*spriteParams, error) {
+	var params spriteParams
+
+	x, err := sprite.Search("x").Data().(json.Number).Int64()
+	if err != nil {
+		return nil, fmt.Errorf("parseAtlas: unable to parse x, idx=%d, %w", idx, err)
+	}
+	params.x = int(x)
+	y, err := sprite.Search("y").Data().(json.Number).Int64()
+	if err != nil {
+		return nil, fmt.Errorf("parseAtlas: unable to parse y, idx=%d, %w", idx, err)
+	}
+	params.y = int(y)
+
+	var ok bool
+	params.name, ok = sprite.Search("n").Data().(string)
+	if !ok {
+		return nil, fmt.Errorf("parseAtlas: unable to parse name, idx=%d", idx)
+	}
+	params.devname = path.Base(params.name)
+	width, err := sprite.Search("w").Data().(json.Number).Int64()
+	if err != nil {
+		return nil, fmt.Errorf("parseAtlas: unable to parse width, idx=%d, devname=%s, %w", idx, params.name, err)
+	}
+	params.width = int(width)
+	height, err := sprite.Search("h").Data().(json.Number).Int64()
+	if err != nil {
+		return nil, fmt.Errorf("parseAtlas: unable to parse height, idx=%d, devname=%s, %w", idx, params.name, err)
+	}
+	params.height = int(height)
+
+	if sprite.Exists("r") && sprite.Search("r").String() == "true" {
+		params.rotate = true
+	}
+
+	return &params, nil
+}
+
+func parseAtlasJSON(atlas []byte) (*gabs.Container, error) {
 	dec := json.NewDecoder(bytes.NewReader(atlas))
 	dec.UseNumber()
-	jsonParsed, err := gabs.ParseJSONDecoder(dec)
+	return gabs.ParseJSONDecoder(dec)
+}
+
+func parseAtlas(atlas []byte) ([]*spriteParams, error) {
+	jsonParsed, err := parseAtlasJSON(atlas)
 	if err != nil {
 		return nil, err
 	}
 
 	sprites := make(map[string]*spriteParams)
 	for idx, sprite := range jsonParsed.Children() {
-		var params spriteParams
-
 		x, err := sprite.Search("x").Data().(json.Number).Int64()
 		if err != nil {
 			return nil, fmt.Errorf("parseAtlas: unable to parse x, idx=%d, %w", idx, err)
 		}
-		params.x = int(x)
 		y, err := sprite.Search("y").Data().(json.Number).Int64()
 		if err != nil {
 			return nil, fmt.Errorf("parseAtlas: unable to parse y, idx=%d, %w", idx, err)
 		}
-		params.y = int(y)
 
-		key := fmt.Sprintf("%d|%d", params.x, params.y)
+		key := fmt.Sprintf("%d|%d", x, y)
 
 		// ignore duplicates
 		if sprites[key] == nil {
-			var ok bool
-			params.name, ok = sprite.Search("n").Data().(string)
-			if !ok {
-				return nil, fmt.Errorf("parseAtlas: unable to parse name, idx=%d", idx)
-			}
-			params.devname = path.Base(params.name)
-			width, err := sprite.Search("w").Data().(json.Number).Int64()
+			sprites[key], err = parseSpriteParams(idx, sprite)
 			if err != nil {
-				return nil, fmt.Errorf("parseAtlas: unable to parse width, idx=%d, devname=%s, %w", idx, params.name, err)
-			}
-			params.width = int(width)
-			height, err := sprite.Search("h").Data().(json.Number).Int64()
-			if err != nil {
-				return nil, fmt.Errorf("parseAtlas: unable to parse height, idx=%d, devname=%s, %w", idx, params.name, err)
-			}
-			params.height = int(height)
-
-			if sprite.Exists("r") && sprite.Search("r").String() == "true" {
-				params.rotate = true
+				return nil, err
 			}
-
-			sprites[key] = &params
 		}
 	}
 
@@ -199,24 +233,58 @@ func parseAtlas(atlas []byte) ([]*spriteParams, error) {
 	return output, nil
 }
 
-func parseEquipmentMaps(equipmentsJSON []byte, equipmentEnhancementsJSON []byte) (rarityMap map[string]int, enhanced99Map map[string]bool, err error) {
-	equipmentsParsed, err := gabs.ParseJSON(equipmentsJSON)
+// parseAtlasNames maps names of all sprites in atlas, including duplicates, to their parameters.
+func parseAtlasNames(atlas []byte) (map[string]*spriteParams, error) {
+	jsonParsed, err := parseAtlasJSON(atlas)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
+	}
+
+	output := make(map[string]*spriteParams)
+	for idx, sprite := range jsonParsed.Children() {
+		params, err := parseSpriteParams(idx, sprite)
+		if err != nil {
+			return nil, err
+		}
+		output[params.name] = params
 	}
-	equipmentEnhancementsParsed, err := gabs.ParseJSON(equipmentEnhancementsJSON)
+	return output, nil
+}
+
+// cropSprite crops a sprite from sheet, rotating it back if it is stored rotated.
+func cropSprite(sheet image.Image, params *spriteParams) image.Image {
+	img := imaging.Crop(sheet, image.Rect(params.x, params.y, params.x+params.width, params.y+params.height))
+	if params.rotate {
+		return imaging.Rotate90(img)
+	}
+	return img
+}
+
+// parseEquipmentMaps reads rarities of devnames from the rarity table of sprites,
+// and devnames whose entry exists in the enhancement table if it is not nil.
+func parseEquipmentMaps(sprites *profileSprites, equipmentsJSON []byte, equipmentEnhancementsJSON []byte) (rarityMap map[string]int, enhanced99Map map[string]bool, err error) {
+	equipmentsParsed, err := gabs.ParseJSON(equipmentsJSON)
 	if err != nil {
 		return nil, nil, err
 	}
+	var equipmentEnhancementsParsed *gabs.Container
+	if equipmentEnhancementsJSON != nil {
+		equipmentEnhancementsParsed, err = gabs.ParseJSON(equipmentEnhancementsJSON)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
 
+	devnamePath := fmt.Sprintf("0.%d", sprites.DevnameColumn)
+	rarityPath := fmt.Sprintf("0.%d", sprites.RarityColumn)
 	rarityMap = make(map[string]int)
 	enhanced99Map = make(map[string]bool)
 	for id, equipment := range equipmentsParsed.ChildrenMap() {
-		devname, ok := equipment.Path("0.0").Data().(string)
+		devname, ok := equipment.Path(devnamePath).Data().(string)
 		if !ok {
 			return nil, nil, fmt.Errorf("parseEquipmentRarityMap: unable to parse devname, id=%s", id)
 		}
-		rarityStr, ok := equipment.Path("0.11").Data().(string)
+		rarityStr, ok := equipment.Path(rarityPath).Data().(string)
 		if !ok {
 			return nil, nil, fmt.Errorf("parseEquipmentRarityMap: unable to parse rarity, id=%s, devname=%s", id, devname)
 		}
@@ -226,7 +294,7 @@ func parseEquipmentMaps(equipmentsJSON []byte, equipmentEnhancementsJSON []byte)
 		}
 		rarityMap[devname] = int(rarity)
 
-		if equipmentEnhancementsParsed.Exists(id) {
+		if equipmentEnhancementsParsed != nil && equipmentEnhancementsParsed.Exists(id) {
 			enhanced99Map[devname] = true
 		}
 	}
@@ -241,16 +309,21 @@ func (spriter *Spriter) extractAssets() (spriteSheet []byte, spriteAtlas []byte,
 		{Data: &extractParams{path: spriter.config.SpritePath, parsers: []parser{&amf3Parser{ext: ".atlas"}}}},
 	}
 
-	if spriter.config.Eliyabot {
+	if spriter.sprites != nil {
 		targets = append(
 			targets,
 			&concurrency.Item[*extractParams, []byte]{
-				Data: &extractParams{path: "item/equipment", parsers: []parser{&orderedmapParser{}}},
-			},
-			&concurrency.Item[*extractParams, []byte]{
-				Data: &extractParams{path: "equipment_enhancement/equipment_enhancement", parsers: []parser{&orderedmapParser{}}},
+				Data: &extractParams{path: spriter.sprites.Table, parsers: []parser{&orderedmapParser{}}},
 			},
 		)
+		if spriter.sprites.EnhancementTable != "" {
+			targets = append(
+				targets,
+				&concurrency.Item[*extractParams, []byte]{
+					Data: &extractParams{path: spriter.sprites.EnhancementTable, parsers: []parser{&orderedmapParser{}}},
+				},
+			)
+		}
 	}
 
 	err = concurrency.Dispatcher(
@@ -263,22 +336,17 @@ func (spriter *Spriter) extractAssets() (spriteSheet []byte, spriteAtlas []byte,
 		},
 		func(i *concurrency.Item[*extractParams, []byte]) ([]byte, error) {
 			parser := i.Data.parsers[0]
-			src, err := parser.getSrc(i.Data.path, &ExtractorConfig{SrcPath: spriter.config.SrcPath})
+			config := &ExtractorConfig{SrcPath: spriter.config.SrcPath, SrcFS: spriter.config.SrcFS}
+			src, err := parser.getSrc(i.Data.path, config)
 			if err != nil {
 				return nil, err
 			}
 
-			srcFile, err := os.Open(src)
-			if err != nil {
-				return nil, fmt.Errorf("extractAssets: src open error, src=%s, %w", src, err)
-			}
-			defer srcFile.Close()
-
-			data, err := io.ReadAll(srcFile)
+			data, err := fs.ReadFile(config.srcFS(), src)
 			if err != nil {
 				return nil, fmt.Errorf("extractAssets: src read error, src=%s, %w", src, err)
 			}
-			data, err = parser.parse(data, &ExtractorConfig{})
+			data, err = parser.parse(i.Data.path, data, &ExtractorConfig{})
 			if err != nil {
 				return nil, fmt.Errorf("extractAssets: src parse error, src=%s, %w", src, err)
 			}
@@ -292,21 +360,24 @@ func (spriter *Spriter) extractAssets() (spriteSheet []byte, spriteAtlas []byte,
 		return nil, nil, nil, nil, err
 	}
 
-	if spriter.config.Eliyabot {
+	switch len(targets) {
+	case 4:
 		return targets[0].Output, targets[1].Output, targets[2].Output, targets[3].Output, nil
+	case 3:
+		return targets[0].Output, targets[1].Output, targets[2].Output, nil, nil
 	}
 	return targets[0].Output, targets[1].Output, nil, nil, nil
 }
 
 func (spriter *Spriter) processSprite(sheet image.Image, params *spriteParams, rarity int) error {
 	// skip non-equipment
-	if spriter.config.Eliyabot && rarity == 0 {
+	if spriter.sprites != nil && rarity == 0 {
 		return nil
 	}
 
 	destDir := spriter.config.SpritePath
-	if spriter.config.Eliyabot {
-		destDir = "eliyabot/item/equipment"
+	if spriter.sprites != nil {
+		destDir = spriter.sprites.Dest
 	}
 
 	abisoul := false
@@ -320,24 +391,7 @@ func (spriter *Spriter) processSprite(sheet image.Image, params *spriteParams, r
 		filename = filename + "_enhanced"
 	}
 
-	dest := addExt(filepath.Join(
-		spriter.config.DestPath,
-		outputAssetsDir,
-		filepath.FromSlash(destDir),
-		filename,
-	), ".png")
-
-	os.MkdirAll(filepath.Dir(dest), 0777)
-	destFile, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
-	if err != nil {
-		return fmt.Errorf("processSprite: dest open error, dest=%s, %w", dest, err)
-	}
-	defer func() {
-		err := destFile.Close()
-		if err != nil {
-			log.Fatal(fmt.Errorf("processSprite: dest close error, dest=%s, %w", dest, err))
-		}
-	}()
+	dest := addExt(path.Join(outputAssetsDir, destDir, filename), ".png")
 
 	img := imaging.Crop(sheet, image.Rect(params.x, params.y, params.x+params.width, params.y+params.height))
 	if params.rotate {
@@ -349,18 +403,37 @@ func (spriter *Spriter) processSprite(sheet image.Image, params *spriteParams, r
 	scaledHeight := int(float32(params.height) * spriter.config.Scale)
 	img = imaging.Resize(img, scaledWidth, scaledHeight, imaging.NearestNeighbor)
 
-	if spriter.config.Eliyabot {
-		var bg image.Image
-		if abisoul {
-			size := int(24 * spriter.config.Scale)
+	if spriter.sprites != nil {
+		bg, ok := spriter.backgrounds[rarity]
+		if abisoul || !ok {
+			size := int(float32(spriter.sprites.Size) * spriter.config.Scale)
 			bg = imaging.New(size, size, color.Transparent)
-		} else {
-			bg = spriter.backgrounds[rarity]
 		}
 		img = imaging.OverlayCenter(bg, img, 1)
 	}
 
-	return imaging.Encode(destFile, img, imaging.PNG, imaging.PNGCompressionLevel(png.BestCompression))
+	var output bytes.Buffer
+	err := imaging.Encode(&output, img, imaging.PNG, imaging.PNGCompressionLevel(png.BestCompression))
+	if err != nil {
+		return fmt.Errorf("processSprite: encode error, dest=%s, %w", dest, err)
+	}
+	err = spriter.sink.write(dest, output.Bytes())
+	if err != nil {
+		return fmt.Errorf("processSprite: dest write error, dest=%s, %w", dest, err)
+	}
+
+	if spriter.manifest != nil {
+		src, err := (&pngParser{}).getSrc(spriter.config.SpritePath, &ExtractorConfig{})
+		if err != nil {
+			return err
+		}
+		entry, err := newManifestEntry(dest, spriter.config.SpritePath, "sprite", src, output.Bytes())
+		if err != nil {
+			return err
+		}
+		spriter.manifest.add(entry)
+	}
+	return nil
 }
 
 func (spriter *Spriter) processAssets(sheet image.Image, atlas []*spriteParams, rarity map[string]int, enhanced99 map[string]bool) error {
@@ -419,8 +492,8 @@ func (spriter *Spriter) ExtractSprite() error {
 
 	var rarity map[string]int
 	var enhanced99 map[string]bool
-	if spriter.config.Eliyabot {
-		rarity, enhanced99, err = parseEquipmentMaps(equipmentsJSON, equipmentEnhancementsJSON)
+	if spriter.sprites != nil {
+		rarity, enhanced99, err = parseEquipmentMaps(spriter.sprites, equipmentsJSON, equipmentEnhancementsJSON)
 		if err != nil {
 			return err
 		}
@@ -429,5 +502,29 @@ func (spriter *Spriter) ExtractSprite() error {
 		enhanced99 = make(map[string]bool)
 	}
 
-	return spriter.processAssets(sheetImage, atlas, rarity, enhanced99)
+	spriter.sink, err = newSink(spriter.config.DestPath)
+	if err != nil {
+		return err
+	}
+	if spriter.config.ManifestPath != "" {
+		spriter.manifest = newOutputManifest()
+	}
+	err = spriter.processAssets(sheetImage, atlas, rarity, enhanced99)
+	if err != nil {
+		spriter.sink.discard()
+		return err
+	}
+	err = spriter.sink.close()
+	if err != nil {
+		return err
+	}
+
+	if spriter.manifest != nil {
+		destDir := spriter.config.DestPath
+		if archiveFormat(destDir) != "" {
+			destDir = ""
+		}
+		return spriter.manifest.write(spriter.config.ManifestPath, destDir, 0)
+	}
+	return nil
 }
@@ -0,0 +1,109 @@
+package wf
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"io/fs"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/blead/wfax/assets"
+	"github.com/blead/wfax/pkg/encoding"
+	"github.com/disintegration/imaging"
+)
+
+func TestSpriterProfile(t *testing.T) {
+	src := func(p string, ext string) string {
+		h, err := sha1Digest(addExt(p, ext), digestSalt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return dumpPath(h)
+	}
+	table := func(js string) []byte {
+		data, err := encoding.JSONToOrderedmap([]byte(js))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	sheet := image.NewNRGBA(image.Rect(0, 0, 4, 2))
+	for x := 0; x < 4; x++ {
+		for y := 0; y < 2; y++ {
+			sheet.Set(x, y, color.NRGBA{R: 0xff, A: 0xff})
+		}
+	}
+	var img bytes.Buffer
+	err := png.Encode(&img, sheet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	atlas, err := encoding.JSONToAmf3([]byte(`[{"n":"item/sword","x":0,"y":0,"w":2,"h":2},{"n":"item/stone","x":2,"y":0,"w":2,"h":2}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	atlasSrc, err := (&amf3Parser{ext: ".atlas"}).getSrc("item/sprite_sheet", &ExtractorConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	spriter, err := NewSpriter(&SpriterConfig{
+		SrcFS: fstest.MapFS{
+			src("item/sprite_sheet", ".png"): {Data: bytes.Replace(img.Bytes(), []byte("PNG"), []byte("png"), 1)},
+			atlasSrc:                         {Data: atlas},
+			// stone has no rarity and is skipped
+			src(toMasterTablePath("item/equipment"), ""):                              {Data: table(`{"1":[["sword","","","","","","","","","","","4"]]}`)},
+			src(toMasterTablePath("equipment_enhancement/equipment_enhancement"), ""): {Data: table(`{"1":[["1"]]}`)},
+		},
+		DestPath: dir,
+		Scale:    1,
+		Eliyabot: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = spriter.ExtractSprite()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backgrounds := map[string]string{"sword": "item_gold.png", "sword_enhanced99": "item_rainbow_enhanced.png"}
+	for name, bg := range backgrounds {
+		got, err := imaging.Open(filepath.Join(dir, outputAssetsDir, "eliyabot", "item", "equipment", name+".png"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b := got.Bounds(); b.Dx() != 24 || b.Dy() != 24 {
+			t.Errorf("%s size = %v, want 24x24", name, b)
+		}
+		if c := color.NRGBAModel.Convert(got.At(12, 12)); c != (color.NRGBA{R: 0xff, A: 0xff}) {
+			t.Errorf("%s center = %v, want sprite color", name, c)
+		}
+
+		data, err := fs.ReadFile(assets.Backgrounds, "backgrounds/"+bg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := imaging.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = imaging.Resize(want, 24, 24, imaging.NearestNeighbor)
+		if c, w := color.NRGBAModel.Convert(got.At(0, 0)), color.NRGBAModel.Convert(want.At(0, 0)); c != w {
+			t.Errorf("%s corner = %v, want %s %v", name, c, bg, w)
+		}
+	}
+	matches, err := filepath.Glob(filepath.Join(dir, outputAssetsDir, "eliyabot", "item", "equipment", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != len(backgrounds) {
+		t.Errorf("sprites = %v, want %d", matches, len(backgrounds))
+	}
+}
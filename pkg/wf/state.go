@@ -0,0 +1,228 @@
+package wf
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"sync"
+)
+
+const (
+	defaultStatePath = ".extractstate"
+	stateVersion     = 5
+)
+
+// extractStateEntry records a source parsed by a parser and the output it produced.
+type extractStateEntry struct {
+	Path    string `json:"path"`
+	Src     string `json:"src"`
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"modTime"`
+	SHA256  string `json:"sha256"`
+	// Dest is the written dest, which may differ from the key of the entry if the parser fell back to another format.
+	Dest    string     `json:"dest"`
+	Outputs []*pathRef `json:"outputs"`
+	// Deps maps other sources read by the parser to their sha256, empty if they do not exist.
+	Deps map[string]string `json:"deps,omitempty"`
+	// Output is the manifest entry of the written dest, nil if it was not written.
+	Output *manifestEntry `json:"output,omitempty"`
+}
+
+// extractState caches parsed sources of previous extractions keyed by dest,
+// which is unique per path and parser.
+type extractState struct {
+	Version int `json:"version"`
+	// Fingerprint identifies options affecting outputs, entries are discarded if it changes.
+	Fingerprint string                        `json:"fingerprint"`
+	Entries     map[string]*extractStateEntry `json:"entries"`
+
+	mu   sync.Mutex
+	prev map[string]*extractStateEntry
+	// deps caches hashes of dependencies during an extraction
+	deps map[string]string
+}
+
+// stateFingerprint hashes options of config and parsers which affect extracted outputs.
+func stateFingerprint(config *ExtractorConfig, s schemas, profile *exportProfile, keys keyDictionaries) (string, error) {
+	data, err := json.Marshal(struct {
+		SrcPath      string
+		SrcPaths     []string
+		Archives     []string
+		Indent       int
+		FlattenCSV   bool
+		NamedColumns bool
+		TypedValues  bool
+		OutputFormat string
+		Normalize    bool
+		SortKeys     bool
+		RawAssets    bool
+		Profile      *exportProfile
+		Keys         keyDictionaries
+		Graph        bool
+		Schemas      schemas
+	}{
+		SrcPath:      config.SrcPath,
+		SrcPaths:     config.SrcPaths,
+		Archives:     config.Archives,
+		Indent:       config.Indent,
+		FlattenCSV:   config.FlattenCSV,
+		NamedColumns: config.NamedColumns,
+		TypedValues:  config.TypedValues,
+		OutputFormat: config.OutputFormat,
+		Normalize:    config.Normalize,
+		SortKeys:     config.SortKeys,
+		RawAssets:    config.RawAssets,
+		Profile:      profile,
+		Keys:         keys,
+		Graph:        len(config.GraphPaths) > 0,
+		Schemas:      s,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	checksum, err := sha256Checksum(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(checksum), nil
+}
+
+// readExtractState reads the state file at path, previous entries are discarded if fingerprint differs.
+func readExtractState(path string, fingerprint string) (*extractState, error) {
+	state := &extractState{
+		Version:     stateVersion,
+		Fingerprint: fingerprint,
+		Entries:     map[string]*extractStateEntry{},
+		prev:        map[string]*extractStateEntry{},
+		deps:        map[string]string{},
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		// start from an empty state if it does not exist
+		if errors.Is(err, os.ErrNotExist) {
+			return state, nil
+		}
+		return nil, fmt.Errorf("readExtractState: read error, path=%s, %w", path, err)
+	}
+
+	prev := &extractState{}
+	err = json.Unmarshal(data, prev)
+	if err != nil {
+		return nil, fmt.Errorf("readExtractState: unmarshal error, path=%s, %w", path, err)
+	}
+	if prev.Version == stateVersion && prev.Fingerprint == fingerprint && prev.Entries != nil {
+		state.prev = prev.Entries
+	}
+
+	return state, nil
+}
+
+func (state *extractState) write(path string) error {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(path, data, 0666)
+	if err != nil {
+		return fmt.Errorf("write extractState: write error, path=%s, %w", path, err)
+	}
+	return nil
+}
+
+// dependencies returns hashes of dependency sources, hashing each source once per extraction.
+func (state *extractState) dependencies(fsys fs.FS, srcs []string) (map[string]string, error) {
+	if len(srcs) == 0 {
+		return nil, nil
+	}
+
+	output := make(map[string]string, len(srcs))
+	for _, src := range srcs {
+		state.mu.Lock()
+		h, ok := state.deps[src]
+		state.mu.Unlock()
+		if !ok {
+			data, err := fs.ReadFile(fsys, src)
+			switch {
+			case errors.Is(err, fs.ErrNotExist):
+			case err != nil:
+				return nil, fmt.Errorf("dependencies: read error, src=%s, %w", src, err)
+			default:
+				checksum, err := sha256Checksum(bytes.NewReader(data))
+				if err != nil {
+					return nil, err
+				}
+				h = hex.EncodeToString(checksum)
+			}
+			state.mu.Lock()
+			state.deps[src] = h
+			state.mu.Unlock()
+		}
+		output[src] = h
+	}
+	return output, nil
+}
+
+// cached returns the previous entry of dest if src and deps are unchanged and its written dest still exists.
+// data is read from src only if its size matches but its modification time does not.
+func (state *extractState) cached(fsys fs.FS, dest string, src string, info fs.FileInfo, deps map[string]string) (*extractStateEntry, error) {
+	state.mu.Lock()
+	entry, ok := state.prev[dest]
+	state.mu.Unlock()
+
+	if !ok || entry.Src != src || entry.Size != info.Size() || !maps.Equal(entry.Deps, deps) {
+		return nil, nil
+	}
+	if _, err := os.Stat(entry.Dest); err != nil {
+		return nil, nil
+	}
+
+	if entry.ModTime != info.ModTime().UnixNano() {
+		data, err := fs.ReadFile(fsys, src)
+		if err != nil {
+			return nil, err
+		}
+		checksum, err := sha256Checksum(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if hex.EncodeToString(checksum) != entry.SHA256 {
+			return nil, nil
+		}
+		entry.ModTime = info.ModTime().UnixNano()
+	}
+
+	state.set(dest, entry)
+	return entry, nil
+}
+
+// refs returns cached output paths of entry.
+func (entry *extractStateEntry) refs() []*pathRef {
+	if entry.Outputs == nil {
+		return []*pathRef{}
+	}
+	return entry.Outputs
+}
+
+// current returns the entry of dest set in this extraction, or nil if dest was not extracted yet.
+func (state *extractState) current(dest string) *extractStateEntry {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	return state.Entries[dest]
+}
+
+func (state *extractState) set(dest string, entry *extractStateEntry) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	state.Entries[dest] = entry
+}
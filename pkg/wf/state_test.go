@@ -0,0 +1,117 @@
+package wf
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/blead/wfax/pkg/encoding"
+)
+
+func TestIncrementalExtraction(t *testing.T) {
+	dir := t.TempDir()
+	scenarioPath := "story/main/1/scenario"
+	h, err := sha1Digest(scenarioPath, digestSalt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scenario, err := encoding.JSONToAmf3([]byte(`[{"a":"alk","b":"Hi there."}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dump := func(name string) fstest.MapFS {
+		fsys := testDump(t, map[string]string{characterTable: `{"1":[["alk","` + name + `"]]}`})
+		fsys[dumpPath(h)] = &fstest.MapFile{Data: scenario}
+		return fsys
+	}
+
+	output := filepath.Join(dir, "output")
+	md := filepath.Join(output, outputAssetsDir, "story", "main", "1", "scenario.md")
+	statePath := filepath.Join(dir, "state")
+	extract := func(fsys fstest.MapFS, indent int) {
+		pathList := filepath.Join(dir, "pathlist")
+		err := os.WriteFile(pathList, []byte(scenarioPath+"\n"+characterTable+"\n"), 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+		extractor, err := NewExtractor(&ExtractorConfig{
+			SrcFS:          fsys,
+			DestPath:       output,
+			PathList:       pathList,
+			NoDefaultPaths: true,
+			Incremental:    true,
+			StatePath:      statePath,
+			Indent:         indent,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = extractor.ExtractAssets()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	tamper := func() {
+		err := os.WriteFile(md, []byte("tampered"), 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func() string {
+		data, err := os.ReadFile(md)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	extract(dump("Alk"), 0)
+	if got := read(); !strings.Contains(got, "**Alk**") {
+		t.Fatalf("scenario = %q, want speaker Alk", got)
+	}
+
+	// unchanged sources are not parsed again
+	tamper()
+	extract(dump("Alk"), 0)
+	if got := read(); got != "tampered" {
+		t.Errorf("unchanged scenario rewritten, scenario = %q", got)
+	}
+
+	// speaker names depend on the character table
+	extract(dump("Alk2"), 0)
+	if got := read(); !strings.Contains(got, "**Alk2**") {
+		t.Errorf("scenario = %q, want speaker Alk2 after character table change", got)
+	}
+
+	// options affecting outputs invalidate the state
+	tamper()
+	extract(dump("Alk2"), 2)
+	if got := read(); got == "tampered" {
+		t.Errorf("scenario not rewritten after fingerprint change")
+	}
+
+	// entries of sources which no longer exist are removed
+	fsys := dump("Alk2")
+	delete(fsys, dumpPath(h))
+	extract(fsys, 2)
+	data, err := os.ReadFile(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var state extractState
+	err = json.Unmarshal(data, &state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for dest := range state.Entries {
+		if strings.Contains(dest, "scenario") {
+			t.Errorf("stale state entry, dest=%s", dest)
+		}
+	}
+	if len(state.Entries) != 1 {
+		t.Errorf("state entries = %d, want 1", len(state.Entries))
+	}
+}
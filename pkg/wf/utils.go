@@ -2,9 +2,11 @@ package wf
 
 import (
 	"archive/zip"
+	"bytes"
 	"crypto/sha1"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
@@ -12,7 +14,10 @@ import (
 	"path"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+
+	"github.com/blead/wfax/assets"
 )
 
 func addExt(p string, ext string) string {
@@ -23,19 +28,36 @@ func toMasterTablePath(p string) string {
 	return path.Clean(addExt(path.Join("master", p), ".orderedmap"))
 }
 
+// defaultPaths returns the non-empty paths of the embedded path list, which may contain CRLF line endings.
+func defaultPaths() []string {
+	var output []string
+	for _, p := range strings.Split(assets.PathList, "\n") {
+		p = strings.TrimSpace(p)
+		if p != "" {
+			output = append(output, p)
+		}
+	}
+	return output
+}
+
+// dumpPath returns the slash-separated path of a hashed asset in the dump, i.e. abcdef -> upload/ab/cdef.
+func dumpPath(hash string) string {
+	return path.Join(dumpAssetDir, hash[0:2], hash[2:])
+}
+
 func findAllPaths(b []byte) ([][]byte, error) {
 	pattern := regexp.MustCompile(`[.$a-zA-Z_0-9-]+?/[.$a-zA-Z_0-9/-]+`)
 	return pattern.FindAll(b, -1), nil
 }
 
-func matchPath(fullpath string, base string, ext string) (string, bool) {
-	if strings.HasPrefix(fullpath, base) && strings.HasSuffix(fullpath, ext) {
-		path, err := filepath.Rel(base, fullpath[0:len(fullpath)-len(ext)])
-		if err != nil {
-			log.Printf("[WARN] matchPath: filepath.Rel error, err=%v\n", err)
-		} else {
-			return path, true
-		}
+// matchPath returns the path between base and ext of a slash-separated path p.
+func matchPath(p string, base string, ext string) (string, bool) {
+	prefix := base
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	if len(p) > len(prefix)+len(ext) && strings.HasPrefix(p, prefix) && strings.HasSuffix(p, ext) {
+		return p[len(prefix) : len(p)-len(ext)], true
 	}
 	return "", false
 }
@@ -135,3 +157,77 @@ func unzip(src io.ReaderAt, size int64, dest string, modPath func(string) string
 
 	return nil
 }
+
+// lessKeyPath orders key paths of master table rows, e.g. 1.2#0, by their keys, numerically if both keys are numbers.
+func lessKeyPath(a string, b string) bool {
+	as := strings.FieldsFunc(a, func(r rune) bool { return r == '.' || r == '#' })
+	bs := strings.FieldsFunc(b, func(r rune) bool { return r == '.' || r == '#' })
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if as[i] == bs[i] {
+			continue
+		}
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		if aErr == nil && bErr == nil {
+			return an < bn
+		}
+		return as[i] < bs[i]
+	}
+	return len(as) < len(bs)
+}
+
+// marshalIndentNoEscape marshals v into JSON indented by indent spaces like json.MarshalIndent, without escaping <, > and &.
+func marshalIndentNoEscape(v any, indent int) ([]byte, error) {
+	var compact bytes.Buffer
+	enc := json.NewEncoder(&compact)
+	enc.SetEscapeHTML(false)
+	err := enc.Encode(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var output bytes.Buffer
+	err = json.Indent(&output, bytes.TrimSuffix(compact.Bytes(), []byte("\n")), "", strings.Repeat(" ", indent))
+	if err != nil {
+		return nil, err
+	}
+	return output.Bytes(), nil
+}
+
+// writeFile writes data to p, creating its parent directories.
+func writeFile(p string, data []byte) error {
+	err := os.MkdirAll(filepath.Dir(p), 0777)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(p, data, 0666)
+	if err != nil {
+		return fmt.Errorf("writeFile: write error, path=%s, %w", p, err)
+	}
+	return nil
+}
+
+// writeJSON writes v as unescaped JSON indented by indent spaces to p, creating its parent directories.
+func writeJSON(p string, v any, indent int) error {
+	data, err := marshalIndentNoEscape(v, indent)
+	if err != nil {
+		return err
+	}
+	return writeFile(p, data)
+}
+
+// decodeJSONNumbers decodes JSON of unknown layout, keeping numbers as json.Number.
+func decodeJSONNumbers(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	err := dec.Decode(&v)
+	return v, err
+}
+
+// decodeStrict decodes data into v, rejecting unknown fields.
+func decodeStrict(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}